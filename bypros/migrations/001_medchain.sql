@@ -0,0 +1,214 @@
+--
+-- Migration 1: MedChain views and indexes
+--
+-- The cothority schema stores the instructions generically, with their
+-- arguments as raw name/value rows. This migration adds the medchain schema,
+-- whose views decode the instructions on the MedChain contracts, and the
+-- indexes needed to select the instructions by contract, action and argument.
+--
+-- Migrations are numbered and applied in order, each one in a single
+-- transaction. A migration checks that the database is at the previous
+-- version, and records its own number in cothority.version. The current
+-- version of the database is the highest schema_version.
+--
+
+BEGIN;
+
+DO $$
+BEGIN
+    IF (SELECT max(schema_version) FROM cothority.version) <> 0 THEN
+        RAISE EXCEPTION 'migration 1 expects schema version 0';
+    END IF;
+END
+$$;
+
+--
+-- Indexes
+--
+
+CREATE INDEX instruction_contract_name_idx
+    ON cothority.instruction (contract_name);
+CREATE INDEX instruction_action_idx
+    ON cothority.instruction (action);
+CREATE INDEX instruction_instance_iid_idx
+    ON cothority.instruction (instance_iid);
+CREATE INDEX argument_instruction_name_idx
+    ON cothority.argument (instruction_id, name);
+CREATE INDEX argument_name_idx
+    ON cothority.argument (name);
+CREATE INDEX signer_instruction_idx
+    ON cothority.signer (instruction_id);
+
+CREATE SCHEMA medchain;
+ALTER SCHEMA medchain OWNER TO bypros;
+
+--
+-- Helpers
+--
+
+-- argument returns the value of the named argument of an instruction, or NULL.
+CREATE FUNCTION medchain.argument(instruction integer, argument_name character varying)
+    RETURNS bytea
+    LANGUAGE sql STABLE
+    AS $$
+        SELECT value FROM cothority.argument
+        WHERE argument.instruction_id = instruction
+            AND argument.name = argument_name
+        LIMIT 1
+    $$;
+ALTER FUNCTION medchain.argument(integer, character varying) OWNER TO bypros;
+
+-- text_argument returns the value of the named argument as text, or NULL.
+CREATE FUNCTION medchain.text_argument(instruction integer, argument_name character varying)
+    RETURNS text
+    LANGUAGE sql STABLE
+    AS $$
+        SELECT convert_from(medchain.argument(instruction, argument_name), 'UTF8')
+    $$;
+ALTER FUNCTION medchain.text_argument(integer, character varying) OWNER TO bypros;
+
+-- signers returns the identities that signed an instruction, separated by
+-- spaces.
+CREATE FUNCTION medchain.signers(instruction integer)
+    RETURNS text
+    LANGUAGE sql STABLE
+    AS $$
+        SELECT string_agg(signer.identity, ' ' ORDER BY signer.identity)
+        FROM cothority.signer
+        WHERE signer.instruction_id = instruction
+    $$;
+ALTER FUNCTION medchain.signers(integer) OWNER TO bypros;
+
+--
+-- Projects
+--
+-- The projects created by accepted transactions. The project ID is the
+-- instance ID derived by the spawn instruction.
+--
+
+CREATE VIEW medchain.projects AS
+SELECT
+    instruction.instruction_id,
+    block.hash AS block_hash,
+    encode(instruction.contract_iid, 'hex') AS project_id,
+    medchain.text_argument(instruction.instruction_id, 'name') AS name,
+    medchain.text_argument(instruction.instruction_id, 'description') AS description,
+    encode(instruction.instance_iid, 'hex') AS darc_id,
+    medchain.signers(instruction.instruction_id) AS signers
+FROM cothority.instruction
+JOIN cothority.transaction ON
+    transaction.transaction_id = instruction.transaction_id
+JOIN cothority.block ON
+    block.block_id = transaction.block_id
+WHERE instruction.action = 'spawn:project'
+    AND transaction.accepted;
+ALTER VIEW medchain.projects OWNER TO bypros;
+
+--
+-- Queries
+--
+-- The query spawns, including the ones refused by the chain. The query ID is
+-- computed as in contracts.NewQueryInstanceID. The last status is the one set
+-- by the last accepted update, NULL if the query was never updated.
+--
+
+CREATE VIEW medchain.queries AS
+SELECT
+    instruction.instruction_id,
+    block.hash AS block_hash,
+    transaction.accepted,
+    encode(query.iid, 'hex') AS query_iid,
+    encode(instruction.instance_iid, 'hex') AS project_id,
+    medchain.text_argument(instruction.instruction_id, 'userID') AS user_id,
+    medchain.text_argument(instruction.instruction_id, 'queryID') AS query_id,
+    medchain.text_argument(instruction.instruction_id, 'queryDefinition') AS query_definition,
+    medchain.text_argument(instruction.instruction_id, 'description') AS description,
+    medchain.text_argument(instruction.instruction_id, 'issuer') AS issuer,
+    medchain.text_argument(instruction.instruction_id, 'subjectHash') AS subject_hash,
+    (SELECT medchain.text_argument(last_update.instruction_id, 'status')
+        FROM cothority.instruction AS last_update
+        JOIN cothority.transaction AS update_transaction ON
+            update_transaction.transaction_id = last_update.transaction_id
+        WHERE last_update.action = 'invoke:query.update'
+            AND last_update.instance_iid = query.iid
+            AND update_transaction.accepted
+        ORDER BY last_update.instruction_id DESC
+        LIMIT 1) AS last_status,
+    medchain.signers(instruction.instruction_id) AS signers
+FROM cothority.instruction
+JOIN cothority.transaction ON
+    transaction.transaction_id = instruction.transaction_id
+JOIN cothority.block ON
+    block.block_id = transaction.block_id
+CROSS JOIN LATERAL (SELECT sha256(convert_to('query', 'UTF8') ||
+        instruction.instance_iid ||
+        coalesce(medchain.argument(instruction.instruction_id, 'queryID'), '')) AS iid
+    ) AS query
+WHERE instruction.action = 'spawn:query';
+ALTER VIEW medchain.queries OWNER TO bypros;
+
+--
+-- Authorization events
+--
+-- The grants and revocations of query terms on the projects, the decisions
+-- of the dataset custodians on the queries, and the changes of the identities
+-- bound to the UserIDs, including the ones refused by the chain.
+--
+
+CREATE VIEW medchain.authorization_events AS
+SELECT
+    instruction.instruction_id,
+    block.hash AS block_hash,
+    transaction.accepted,
+    instruction.action,
+    CASE instruction.action
+        WHEN 'invoke:project.add' THEN 'grant'
+        WHEN 'invoke:project.remove' THEN 'revoke'
+        WHEN 'invoke:query.approve' THEN 'approve'
+        WHEN 'invoke:query.deny' THEN 'deny'
+        WHEN 'invoke:user.addIdentity' THEN 'addIdentity'
+        WHEN 'invoke:user.removeIdentity' THEN 'removeIdentity'
+    END AS kind,
+    encode(instruction.instance_iid, 'hex') AS instance_id,
+    CASE instruction.contract_name
+        WHEN 'project' THEN medchain.text_argument(instruction.instruction_id, 'userID')
+        WHEN 'query' THEN (SELECT queries.user_id FROM medchain.queries
+            WHERE queries.query_iid = encode(instruction.instance_iid, 'hex')
+                AND queries.accepted
+            LIMIT 1)
+        WHEN 'user' THEN (SELECT medchain.text_argument(spawn.instruction_id, 'userID')
+            FROM cothority.instruction AS spawn
+            WHERE spawn.action = 'spawn:user'
+                AND sha256(convert_to('user', 'UTF8') ||
+                    coalesce(medchain.argument(spawn.instruction_id, 'userID'), '')) =
+                    instruction.instance_iid
+            LIMIT 1)
+    END AS user_id,
+    medchain.text_argument(instruction.instruction_id, 'queryTerm') AS query_terms,
+    encode(medchain.argument(instruction.instruction_id, 'datasetID'), 'hex') AS dataset_id,
+    medchain.text_argument(instruction.instruction_id, 'identity') AS identities,
+    medchain.signers(instruction.instruction_id) AS signers
+FROM cothority.instruction
+JOIN cothority.transaction ON
+    transaction.transaction_id = instruction.transaction_id
+JOIN cothority.block ON
+    block.block_id = transaction.block_id
+WHERE instruction.action IN (
+    'invoke:project.add',
+    'invoke:project.remove',
+    'invoke:query.approve',
+    'invoke:query.deny',
+    'invoke:user.addIdentity',
+    'invoke:user.removeIdentity');
+ALTER VIEW medchain.authorization_events OWNER TO bypros;
+
+--
+-- Read-only user
+--
+
+GRANT USAGE ON SCHEMA medchain TO proxy;
+GRANT SELECT ON ALL TABLES IN SCHEMA medchain TO proxy;
+
+INSERT INTO cothority.version (schema_version) VALUES (1);
+
+COMMIT;
@@ -0,0 +1,58 @@
+//go:build ignore
+// +build ignore
+
+// Gen writes the SQL migrations of the folder in sql.go, so that they are
+// compiled in the binaries. Run it with "go generate" after adding a
+// migration.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	names, err := filepath.Glob("*.sql")
+	if err != nil {
+		log.Fatalf("failed to list migrations: %v", err)
+	}
+
+	sort.Strings(names)
+
+	buf := new(bytes.Buffer)
+
+	fmt.Fprint(buf, "// Code generated by gen.go; DO NOT EDIT.\n\n")
+	fmt.Fprint(buf, "package migrations\n\n")
+	fmt.Fprint(buf, "var files = []file{\n")
+
+	for _, name := range names {
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatalf("failed to read %s: %v", name, err)
+		}
+
+		if strings.Contains(string(content), "`") {
+			log.Fatalf("%s contains a backquote", name)
+		}
+
+		fmt.Fprintf(buf, "\t{\n\t\tname: %q,\n\t\tsql: `%s`,\n\t},\n", name, content)
+	}
+
+	fmt.Fprint(buf, "}\n")
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("failed to format: %v", err)
+	}
+
+	err = ioutil.WriteFile("sql.go", out, 0644)
+	if err != nil {
+		log.Fatalf("failed to write sql.go: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package migrations applies the numbered SQL migrations of this folder to the
+// ByzCoin proxy (bypros) database.
+//
+// A migration is a file named <version>_<name>.sql, the versions starting at
+// 1 and following each other. Each migration runs in a single transaction,
+// checks that the database is at the previous version, and records its
+// version in cothority.version. The version of the database is the highest
+// recorded one, 0 being the version of the bypros schema.
+//
+// The migrations are compiled in the binaries with:
+//
+//	go generate ./bypros/migrations
+package migrations
+
+//go:generate go run gen.go
+
+import (
+	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
+
+	// the driver used by bypros
+	_ "github.com/jackc/pgx/stdlib"
+	"golang.org/x/xerrors"
+)
+
+// file is a migration file, as read by gen.go.
+type file struct {
+	name string
+	sql  string
+}
+
+// Migration is an SQL script that upgrades the database to its version.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// All returns the migrations compiled in the binary, ordered by version.
+func All() ([]Migration, error) {
+	migrations := make([]Migration, len(files))
+
+	for i, f := range files {
+		m, err := parse(f)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid migration %s: %v", f.name, err)
+		}
+
+		migrations[i] = m
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, xerrors.Errorf("expected migration %d, got %d", i+1, m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// Latest returns the version of the last migration compiled in the binary.
+func Latest() int {
+	return len(files)
+}
+
+func parse(f file) (Migration, error) {
+	parts := strings.SplitN(strings.TrimSuffix(f.name, ".sql"), "_", 2)
+	if len(parts) != 2 {
+		return Migration{}, xerrors.New("name must be <version>_<name>.sql")
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Migration{}, xerrors.Errorf("invalid version: %v", err)
+	}
+
+	return Migration{
+		Version: version,
+		Name:    parts[1],
+		SQL:     f.sql,
+	}, nil
+}
+
+// Runner applies the migrations to a database.
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewRunner returns a runner for the database at the given URL, with the
+// migrations compiled in the binary. The user of the URL needs to own the
+// cothority schema.
+func NewRunner(dbURL string) (*Runner, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read migrations: %v", err)
+	}
+
+	db, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open database: %v", err)
+	}
+
+	return &Runner{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Close closes the connection to the database.
+func (r *Runner) Close() error {
+	return r.db.Close()
+}
+
+// Version returns the version of the database.
+func (r *Runner) Version() (int, error) {
+	var version sql.NullInt64
+
+	err := r.db.QueryRow("select max(schema_version) from cothority.version").
+		Scan(&version)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to read version: %v", err)
+	}
+
+	if !version.Valid {
+		return 0, xerrors.New("no version recorded")
+	}
+
+	return int(version.Int64), nil
+}
+
+// Check returns the version of the database, or an error if it is ahead of
+// the migrations of the binary.
+func (r *Runner) Check() (int, error) {
+	version, err := r.Version()
+	if err != nil {
+		return 0, xerrors.Errorf("failed to get version: %v", err)
+	}
+
+	if version > len(r.migrations) {
+		return 0, xerrors.Errorf("database schema version %d is ahead of the "+
+			"binary, which knows up to version %d", version, len(r.migrations))
+	}
+
+	return version, nil
+}
+
+// Pending returns the migrations that are not applied to the database.
+func (r *Runner) Pending() ([]Migration, error) {
+	version, err := r.Check()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to check version: %v", err)
+	}
+
+	return r.migrations[version:], nil
+}
+
+// Up applies the pending migrations in order and returns them. It does
+// nothing if the database is up to date.
+func (r *Runner) Up() ([]Migration, error) {
+	pending, err := r.Pending()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get pending migrations: %v", err)
+	}
+
+	for i, m := range pending {
+		// the migration begins and commits its own transaction
+		_, err = r.db.Exec(m.SQL)
+		if err != nil {
+			return pending[:i], xerrors.Errorf("failed to apply migration %d: %v",
+				m.Version, err)
+		}
+
+		version, err := r.Version()
+		if err != nil {
+			return pending[:i], xerrors.Errorf("failed to get version: %v", err)
+		}
+
+		if version != m.Version {
+			return pending[:i], xerrors.Errorf("migration %d didn't record its "+
+				"version, database is at %d", m.Version, version)
+		}
+	}
+
+	return pending, nil
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAll(t *testing.T) {
+	migrations, err := All()
+	require.NoError(t, err)
+	require.Len(t, migrations, Latest())
+
+	for i, m := range migrations {
+		require.Equal(t, i+1, m.Version)
+		require.NotEmpty(t, m.Name)
+		require.Contains(t, m.SQL, fmt.Sprintf(
+			"INSERT INTO cothority.version (schema_version) VALUES (%d);", m.Version))
+	}
+}
+
+// The compiled migrations must be regenerated with "go generate" when a file
+// is added or changed.
+func TestAll_Generated(t *testing.T) {
+	names, err := filepath.Glob("*.sql")
+	require.NoError(t, err)
+	require.Len(t, files, len(names))
+
+	for i, name := range names {
+		content, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+
+		require.Equal(t, name, files[i].name)
+		require.Equal(t, string(content), files[i].sql, "run go generate")
+	}
+}
+
+func TestParse(t *testing.T) {
+	m, err := parse(file{name: "012_some_name.sql", sql: "sql"})
+	require.NoError(t, err)
+	require.Equal(t, Migration{Version: 12, Name: "some_name", SQL: "sql"}, m)
+
+	_, err = parse(file{name: "medchain.sql"})
+	require.EqualError(t, err, "name must be <version>_<name>.sql")
+
+	_, err = parse(file{name: "a_medchain.sql"})
+	require.Error(t, err)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ldsec/medchain/client"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var adminCommand = cli.Command{
+	Name:  "admin",
+	Usage: "manage the identities of the admin DARC",
+	Subcommands: []cli.Command{
+		{
+			Name:   "show",
+			Usage:  "print the latest version of the admin DARC",
+			Action: adminShow,
+		},
+		{
+			Name:      "replace",
+			Usage:     "propose to replace an admin identity, and sign the proposal",
+			ArgsUsage: "<old identity> <new identity>",
+			Action:    adminReplace,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "sign",
+			Usage:     "sign a proposal of the admins",
+			ArgsUsage: "<proposal ID>",
+			Action:    adminSign,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "exec",
+			Usage:     "apply a proposal signed by enough admins",
+			ArgsUsage: "<proposal ID>",
+			Action:    adminExec,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "proposal",
+			Usage:     "print a proposal and its signers",
+			ArgsUsage: "<proposal ID>",
+			Action:    adminProposal,
+		},
+	},
+}
+
+func adminShow(c *cli.Context) error {
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	d, err := cl.GetDarc(cfg.AdminDarc.GetBaseID())
+	if err != nil {
+		return xerrors.Errorf("failed to get admin DARC: %v", err)
+	}
+
+	fmt.Fprint(c.App.Writer, d)
+
+	return nil
+}
+
+// adminReplace proposes the evolution of the admin DARC with a deferred
+// transaction, signed by the proposer. The other admins sign it until the
+// threshold is reached, and any of them executes it.
+func adminReplace(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the old and the new identities")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	old, err := darc.ParseIdentity(c.Args().Get(0))
+	if err != nil {
+		return xerrors.Errorf("failed to parse old identity: %v", err)
+	}
+
+	replacement, err := darc.ParseIdentity(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to parse new identity: %v", err)
+	}
+
+	d, err := cl.GetDarc(cfg.AdminDarc.GetBaseID())
+	if err != nil {
+		return xerrors.Errorf("failed to get admin DARC: %v", err)
+	}
+
+	evolved, err := client.ReplaceIdentity(d, old, replacement)
+	if err != nil {
+		return xerrors.Errorf("failed to replace identity: %v", err)
+	}
+
+	id, err := cl.ProposeEvolution(evolved, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to propose evolution: %v", err)
+	}
+
+	err = cl.SignDeferred(id, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to sign proposal: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "proposal %s created and signed by %s\n", id, signer.Identity())
+	fmt.Fprintf(c.App.Writer, "the other admins sign it with 'medchain admin sign %s', "+
+		"then execute it with 'medchain admin exec %s'\n", id, id)
+
+	return nil
+}
+
+func adminSign(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the proposal ID")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse proposal ID: %v", err)
+	}
+
+	err = cl.SignDeferred(id, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to sign proposal: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "proposal %s signed by %s\n", id, signer.Identity())
+
+	return nil
+}
+
+func adminExec(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the proposal ID")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse proposal ID: %v", err)
+	}
+
+	err = cl.ExecDeferred(id, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to execute proposal: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "proposal %s executed\n", id)
+
+	return nil
+}
+
+func adminProposal(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the proposal ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse proposal ID: %v", err)
+	}
+
+	data, err := cl.GetDeferred(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get proposal: %v", err)
+	}
+
+	fmt.Fprint(c.App.Writer, data)
+
+	for i, inst := range data.ProposedTransaction.Instructions {
+		fmt.Fprintf(c.App.Writer, "- Signers of instruction %d:\n", i)
+
+		for _, identity := range inst.SignerIdentities {
+			fmt.Fprintf(c.App.Writer, "-- %s\n", identity)
+		}
+	}
+
+	return nil
+}
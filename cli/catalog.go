@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var catalogCommand = cli.Command{
+	Name:  "catalog",
+	Usage: "manage the catalogs of the valid query terms",
+	Description: "A catalog lists the query terms, with their label and ontology code. " +
+		"Once a project uses a catalog, only the terms of the catalog can be granted " +
+		"on the project.",
+	Subcommands: []cli.Command{
+		{
+			Name:      "create",
+			Usage:     "create an empty catalog and print its instance ID",
+			ArgsUsage: "<name>",
+			Action:    catalogCreate,
+			Flags: []cli.Flag{
+				signFlag,
+				cli.StringFlag{
+					Name:  "description",
+					Usage: "the description of the catalog",
+				},
+			},
+		},
+		{
+			Name:      "show",
+			Usage:     "print a catalog",
+			ArgsUsage: "<catalog instance ID>",
+			Action:    catalogShow,
+		},
+		{
+			Name:      "add",
+			Usage:     "add a term to the catalog, or update its label and code",
+			ArgsUsage: "<catalog instance ID> <term>",
+			Action:    catalogAdd,
+			Flags: []cli.Flag{
+				signFlag,
+				cli.StringFlag{
+					Name:  "label",
+					Usage: "the human readable name of the term",
+				},
+				cli.StringFlag{
+					Name:  "code",
+					Usage: "the ontology code of the term, for example SNOMED-CT:38341003",
+				},
+			},
+		},
+		{
+			Name: "import",
+			Usage: "add the terms of a CSV file to the catalog, one term per line " +
+				"with its label and code: term,label,code",
+			ArgsUsage: "<catalog instance ID> <file>",
+			Action:    catalogImport,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:         "remove",
+			Usage:        "remove a term from the catalog, the authorizations already granted are kept",
+			ArgsUsage:    "<catalog instance ID> <term>",
+			Action:       catalogRemove,
+			Flags:        []cli.Flag{signFlag},
+			BashComplete: completeCatalogTerms,
+		},
+		{
+			Name:      "search",
+			Usage:     "print the terms whose term, label or code contains the text",
+			ArgsUsage: "<catalog instance ID> [<text>]",
+			Action:    catalogSearch,
+		},
+	},
+}
+
+func catalogCreate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the name of the catalog")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.SpawnCatalog(cfg.AdminDarc.GetBaseID(), c.Args().First(),
+		c.String("description"), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to create catalog: %v", err)
+	}
+
+	fmt.Fprintln(c.App.Writer, id)
+
+	return nil
+}
+
+func catalogShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the catalog instance ID")
+	}
+
+	catalog, err := getCatalog(c)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprint(c.App.Writer, catalog)
+
+	return nil
+}
+
+func catalogAdd(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the catalog instance ID and the term")
+	}
+
+	term := contracts.CatalogTerm{
+		Term:  c.Args().Get(1),
+		Label: c.String("label"),
+		Code:  c.String("code"),
+	}
+
+	return addCatalogTerms(c, []contracts.CatalogTerm{term})
+}
+
+func catalogImport(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the catalog instance ID and the file")
+	}
+
+	f, err := os.Open(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to open file: %v", err)
+	}
+
+	defer f.Close()
+
+	terms, err := readCatalogTerms(f)
+	if err != nil {
+		return xerrors.Errorf("failed to read terms: %v", err)
+	}
+
+	return addCatalogTerms(c, terms)
+}
+
+func catalogRemove(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the catalog instance ID and the term")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse catalog ID: %v", err)
+	}
+
+	err = cl.RemoveCatalogTerm(id, c.Args().Get(1), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to remove term: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "term %s removed\n", c.Args().Get(1))
+
+	return nil
+}
+
+func catalogSearch(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return xerrors.New("please provide the catalog instance ID and the text")
+	}
+
+	catalog, err := getCatalog(c)
+	if err != nil {
+		return err
+	}
+
+	printCatalogTerms(c.App.Writer, catalog.Search(c.Args().Get(1)))
+
+	return nil
+}
+
+// getCatalog reads the catalog given as first argument.
+func getCatalog(c *cli.Context) (*contracts.CatalogContract, error) {
+	cl, err := getClient(c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse catalog ID: %v", err)
+	}
+
+	catalog, err := cl.GetCatalog(id)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get catalog: %v", err)
+	}
+
+	return catalog, nil
+}
+
+// addCatalogTerms adds the terms to the catalog given as first argument.
+func addCatalogTerms(c *cli.Context, terms []contracts.CatalogTerm) error {
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse catalog ID: %v", err)
+	}
+
+	err = cl.AddCatalogTerms(id, terms, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to add terms: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "%d terms added to catalog %s\n", len(terms), id)
+
+	return nil
+}
+
+// readCatalogTerms reads the terms of a CSV file with the term, its label and
+// its code on each line. The label and code are optional.
+func readCatalogTerms(r io.Reader) ([]contracts.CatalogTerm, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	var terms []contracts.CatalogTerm
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read CSV: %v", err)
+		}
+
+		if len(record) > 3 {
+			return nil, xerrors.Errorf("term %s has %d fields, expected term,label,code",
+				record[0], len(record))
+		}
+
+		record = append(record, "", "")
+
+		terms = append(terms, contracts.CatalogTerm{
+			Term:  strings.TrimSpace(record[0]),
+			Label: strings.TrimSpace(record[1]),
+			Code:  strings.TrimSpace(record[2]),
+		})
+	}
+
+	return terms, nil
+}
+
+func printCatalogTerms(w io.Writer, terms []*contracts.CatalogTerm) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "TERM\tLABEL\tCODE")
+
+	for _, term := range terms {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", term.Term, term.Label, term.Code)
+	}
+
+	tw.Flush()
+}
+
+// completeCatalogTerms completes the term argument with the terms of the
+// catalog given as first argument.
+func completeCatalogTerms(c *cli.Context) {
+	if c.NArg() != 1 {
+		return
+	}
+
+	catalog, err := getCatalog(c)
+	if err != nil {
+		return
+	}
+
+	for _, term := range catalog.Terms {
+		fmt.Fprintln(c.App.Writer, term.Term)
+	}
+}
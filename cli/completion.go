@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// bashCompletion is the script completing the commands, adapted from the one
+// of the cli package. The commands are completed by the binary itself, for
+// example the query terms by reading the catalog of the project.
+const bashCompletion = `_medchain_bash_autocomplete() {
+    local cur opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion 2>/dev/null )
+    COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    return 0
+}
+
+complete -F _medchain_bash_autocomplete %s
+`
+
+var completionCommand = cli.Command{
+	Name:  "completion",
+	Usage: "print the bash completion script",
+	Description: "Enable the completion of the commands and of the query terms with:\n\n" +
+		"   source <(medchain completion)",
+	Action: func(c *cli.Context) error {
+		fmt.Fprintf(c.App.Writer, bashCompletion, c.App.Name)
+		return nil
+	},
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var consentCommand = cli.Command{
+	Name:  "consent",
+	Usage: "manage the consent of the cohorts of the datasets",
+	Description: "A consent lists categories, like no-genetic-research, each mapped to " +
+		"the query terms it forbids or permits. A query is not authorized on a dataset " +
+		"if a category of the consent of the dataset refuses it.",
+	Subcommands: []cli.Command{
+		{
+			Name:      "create",
+			Usage:     "create the consent of a cohort, without categories, and print its instance ID",
+			ArgsUsage: "<cohort>",
+			Action:    consentCreate,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "show",
+			Usage:     "print a consent",
+			ArgsUsage: "<consent instance ID>",
+			Action:    consentShow,
+		},
+		{
+			Name:      "set",
+			Usage:     "add a category to the consent, or replace it",
+			ArgsUsage: "<consent instance ID> <category>",
+			Action:    consentSet,
+			Flags: []cli.Flag{
+				signFlag,
+				cli.StringFlag{
+					Name:  "description",
+					Usage: "the description of the category",
+				},
+				cli.StringFlag{
+					Name:  "forbid",
+					Usage: "the query terms the category forbids, separated by commas",
+				},
+				cli.StringFlag{
+					Name:  "permit",
+					Usage: "the only query terms the category permits, separated by commas",
+				},
+			},
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove a category from the consent",
+			ArgsUsage: "<consent instance ID> <category>",
+			Action:    consentRemove,
+			Flags:     []cli.Flag{signFlag},
+		},
+	},
+}
+
+func consentCreate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the cohort")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.SpawnConsent(cfg.AdminDarc.GetBaseID(), c.Args().First(), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to create consent: %v", err)
+	}
+
+	fmt.Fprintln(c.App.Writer, id)
+
+	return nil
+}
+
+func consentShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the consent instance ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse consent ID: %v", err)
+	}
+
+	consent, err := cl.GetConsent(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get consent: %v", err)
+	}
+
+	fmt.Fprint(c.App.Writer, consent)
+
+	return nil
+}
+
+func consentSet(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the consent instance ID and the category")
+	}
+
+	if c.String("forbid") == "" && c.String("permit") == "" {
+		return xerrors.New("--forbid or --permit is required")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse consent ID: %v", err)
+	}
+
+	rule := contracts.ConsentRule{
+		Category:    c.Args().Get(1),
+		Description: c.String("description"),
+		Forbidden:   splitList(c.String("forbid")),
+		Permitted:   splitList(c.String("permit")),
+	}
+
+	err = cl.SetConsentRule(id, rule, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to set category: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "category %s set\n", rule.Category)
+
+	return nil
+}
+
+func consentRemove(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the consent instance ID and the category")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse consent ID: %v", err)
+	}
+
+	err = cl.RemoveConsentRule(id, c.Args().Get(1), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to remove category: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "category %s removed\n", c.Args().Get(1))
+
+	return nil
+}
+
+// splitList splits a list of values separated by commas, ignoring the empty
+// ones.
+func splitList(s string) []string {
+	var res []string
+
+	for _, str := range strings.Split(s, ",") {
+		str = strings.TrimSpace(str)
+		if str != "" {
+			res = append(res, str)
+		}
+	}
+
+	return res
+}
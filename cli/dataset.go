@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ldsec/medchain/client"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var datasetCommand = cli.Command{
+	Name:  "dataset",
+	Usage: "read dataset instances and set their custodian and the consent of their cohort",
+	Subcommands: []cli.Command{
+		{
+			Name:      "show",
+			Usage:     "print a dataset",
+			ArgsUsage: "<dataset instance ID>",
+			Action:    datasetShow,
+		},
+		{
+			Name: "set-consent",
+			Usage: "set the consent of the cohort of the dataset, the queries are not " +
+				"restricted by consent anymore if no consent is given",
+			ArgsUsage: "<dataset instance ID> [<consent instance ID>]",
+			Action:    datasetSetConsent,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name: "set-custodian",
+			Usage: "set the custodian who approves the queries on the dataset, the queries " +
+				"don't need an approval anymore if no custodian is given",
+			ArgsUsage: "<dataset instance ID> [<custodian identity>]",
+			Action:    datasetSetCustodian,
+			Flags:     []cli.Flag{signFlag},
+		},
+	},
+}
+
+func datasetShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the dataset instance ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	dataset, err := cl.GetDataset(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get dataset: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "- InstanceID: %s\n", id)
+	fmt.Fprint(c.App.Writer, dataset)
+
+	return nil
+}
+
+func datasetSetConsent(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return xerrors.New("please provide the dataset instance ID and the consent instance ID")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	var consentID *byzcoin.InstanceID
+
+	if c.NArg() == 2 {
+		parsed, err := client.ParseInstanceID(c.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("failed to parse consent ID: %v", err)
+		}
+
+		consentID = &parsed
+	}
+
+	err = cl.SetDatasetConsent(id, consentID, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to set consent: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "consent of dataset %s updated\n", id)
+
+	return nil
+}
+
+func datasetSetCustodian(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return xerrors.New("please provide the dataset instance ID and the custodian identity")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	var custodian *darc.Identity
+
+	if c.NArg() == 2 {
+		parsed, err := darc.ParseIdentity(c.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("failed to parse custodian: %v", err)
+		}
+
+		custodian = &parsed
+	}
+
+	err = cl.SetDatasetCustodian(id, custodian, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to set custodian: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "custodian of dataset %s updated\n", id)
+
+	return nil
+}
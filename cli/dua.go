@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/ldsec/medchain/client"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var duaCommand = cli.Command{
+	Name:  "dua",
+	Usage: "manage the data use agreements and their attestations",
+	Description: "A data use agreement (DUA) stores the SHA-256 of each version of the " +
+		"agreement document. A project referencing a DUA rejects the queries of the " +
+		"users who didn't attest its current version.",
+	Subcommands: []cli.Command{
+		{
+			Name:      "create",
+			Usage:     "create an agreement whose first version is the document, and print its instance ID",
+			ArgsUsage: "<name> <document>",
+			Action:    duaCreate,
+			Flags:     []cli.Flag{signFlag, urlFlag},
+		},
+		{
+			Name:      "publish",
+			Usage:     "publish a new version of the agreement, which the users must attest again",
+			ArgsUsage: "<dua instance ID> <document>",
+			Action:    duaPublish,
+			Flags:     []cli.Flag{signFlag, urlFlag},
+		},
+		{
+			Name:      "show",
+			Usage:     "print an agreement",
+			ArgsUsage: "<dua instance ID>",
+			Action:    duaShow,
+		},
+		{
+			Name:      "attest",
+			Usage:     "attest the current version of the agreement as a user, and print the instance ID of the attestation",
+			ArgsUsage: "<dua instance ID> <document>",
+			Action:    duaAttest,
+			Flags: []cli.Flag{
+				signFlag,
+				cli.StringFlag{
+					Name:  "user",
+					Usage: "the UserID attesting the agreement, --sign must be one of its identities",
+				},
+			},
+		},
+		{
+			Name:      "attestation",
+			Usage:     "print the attestation of the agreement by a user, for the current version by default",
+			ArgsUsage: "<dua instance ID> <UserID> [<version>]",
+			Action:    duaAttestation,
+		},
+	},
+}
+
+var urlFlag = cli.StringFlag{
+	Name:  "url",
+	Usage: "where the agreement document can be read",
+}
+
+func duaCreate(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the name and the document")
+	}
+
+	hash, err := hashDocument(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to hash document: %v", err)
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.SpawnDUA(cfg.AdminDarc.GetBaseID(), c.Args().First(), hash,
+		c.String("url"), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to create dua: %v", err)
+	}
+
+	fmt.Fprintln(c.App.Writer, id)
+
+	return nil
+}
+
+func duaPublish(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the dua instance ID and the document")
+	}
+
+	hash, err := hashDocument(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to hash document: %v", err)
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse dua ID: %v", err)
+	}
+
+	err = cl.PublishDUA(id, hash, c.String("url"), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to publish: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "version %s published\n", hash)
+
+	return nil
+}
+
+func duaShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the dua instance ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse dua ID: %v", err)
+	}
+
+	dua, err := cl.GetDUA(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get dua: %v", err)
+	}
+
+	fmt.Fprint(c.App.Writer, dua)
+
+	return nil
+}
+
+func duaAttest(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the dua instance ID and the document")
+	}
+
+	if c.String("sign") == "" || c.String("user") == "" {
+		return xerrors.New("--sign and --user are required")
+	}
+
+	// the user attests the document it read, which must be the current
+	// version of the agreement
+	hash, err := hashDocument(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to hash document: %v", err)
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse dua ID: %v", err)
+	}
+
+	attestationID, err := cl.AttestDUA(id, c.String("user"), hash, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to attest: %v", err)
+	}
+
+	fmt.Fprintln(c.App.Writer, attestationID)
+
+	return nil
+}
+
+func duaAttestation(c *cli.Context) error {
+	if c.NArg() < 2 || c.NArg() > 3 {
+		return xerrors.New("please provide the dua instance ID, the UserID and optionally the version")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse dua ID: %v", err)
+	}
+
+	var version int
+
+	if c.NArg() == 3 {
+		version, err = strconv.Atoi(c.Args().Get(2))
+		if err != nil {
+			return xerrors.Errorf("failed to parse version: %v", err)
+		}
+	} else {
+		dua, err := cl.GetDUA(id)
+		if err != nil {
+			return xerrors.Errorf("failed to get dua: %v", err)
+		}
+
+		version = dua.Current().Version
+	}
+
+	attestation, err := cl.GetAttestation(id, c.Args().Get(1), version)
+	if err != nil {
+		return xerrors.Errorf("failed to get attestation: %v", err)
+	}
+
+	fmt.Fprint(c.App.Writer, attestation)
+
+	return nil
+}
+
+// hashDocument returns the hex-encoded SHA-256 of the file.
+func hashDocument(path string) (string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", xerrors.Errorf("failed to read %s: %v", path, err)
+	}
+
+	h := sha256.Sum256(buf)
+
+	return hex.EncodeToString(h[:]), nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/gateway"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var gatewayCommand = cli.Command{
+	Name:  "gateway",
+	Usage: "submit queries on behalf of users authenticated with OpenID Connect",
+	Description: "The gateway validates the JWT of the users against the issuers of " +
+		"the config and spawns their queries with the service key. The service " +
+		"key must be registered as an identity of the users.",
+	Action: gatewayRun,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "gateway-config",
+			Usage: "the TOML file listing the trusted issuers (required)",
+		},
+		cli.StringFlag{
+			Name:  "sign",
+			Usage: "the identity of the gateway's service key, required without --profiles",
+		},
+		cli.StringFlag{
+			Name: "profiles",
+			Usage: "serve the chains of the profiles, separated by commas, at " +
+				"/chains/<profile>/queries, signing with the signer of each profile",
+		},
+		cli.StringFlag{
+			Name:  "listen",
+			Value: ":8080",
+			Usage: "the address the gateway listens on",
+		},
+	},
+}
+
+func gatewayRun(c *cli.Context) error {
+	if c.String("gateway-config") == "" {
+		return xerrors.New("--gateway-config is required")
+	}
+
+	config, err := gateway.LoadConfig(c.String("gateway-config"))
+	if err != nil {
+		return xerrors.Errorf("failed to load gateway config: %v", err)
+	}
+
+	verifier := gateway.NewVerifier(config.Issuers, &http.Client{Timeout: 10 * time.Second})
+
+	mux := http.NewServeMux()
+
+	if c.String("profiles") == "" {
+		if c.String("sign") == "" {
+			return xerrors.New("--sign is required")
+		}
+
+		cl, err := getClient(c)
+		if err != nil {
+			return xerrors.Errorf("failed to get client: %v", err)
+		}
+
+		signer, err := loadKey(c.String("sign"))
+		if err != nil {
+			return xerrors.Errorf("failed to load key: %v", err)
+		}
+
+		mux.Handle("/queries", gateway.NewGateway(verifier, cl, *signer))
+
+		log.Infof("gateway listening on %s with identity %s", c.String("listen"),
+			signer.Identity())
+
+		return http.ListenAndServe(c.String("listen"), mux)
+	}
+
+	profiles, err := client.LoadProfiles(profilesFile())
+	if err != nil {
+		return xerrors.Errorf("failed to load profiles: %v", err)
+	}
+
+	// one gateway per chain, each with the service key of its profile
+	for _, name := range strings.Split(c.String("profiles"), ",") {
+		profile, err := profiles.Get(strings.TrimSpace(name))
+		if err != nil {
+			return xerrors.Errorf("failed to get profile: %v", err)
+		}
+
+		cl, _, err := profile.Open()
+		if err != nil {
+			return xerrors.Errorf("failed to open profile %s: %v", profile.Name, err)
+		}
+
+		id := profile.Signer
+		if c.String("sign") != "" {
+			id = c.String("sign")
+		}
+
+		if id == "" {
+			return xerrors.Errorf("profile %s has no signer, use --sign", profile.Name)
+		}
+
+		signer, err := loadKey(id)
+		if err != nil {
+			return xerrors.Errorf("failed to load key: %v", err)
+		}
+
+		path := "/chains/" + profile.Name + "/queries"
+		mux.Handle(path, gateway.NewGateway(verifier, cl, *signer))
+
+		log.Infof("gateway serving %s with identity %s", path, signer.Identity())
+	}
+
+	log.Infof("gateway listening on %s", c.String("listen"))
+
+	return http.ListenAndServe(c.String("listen"), mux)
+}
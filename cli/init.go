@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ldsec/medchain/client"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var initCommand = cli.Command{
+	Name:      "init",
+	Usage:     "create a ledger with the admin DARC and the rules of the MedChain contracts",
+	ArgsUsage: "<roster file>",
+	Action:    initChain,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "admins",
+			Usage: "the identities of the admins, at most 7, separated by commas, defaults to the new key owning the genesis DARC",
+		},
+		cli.IntFlag{
+			Name:  "threshold",
+			Usage: "the number of admins that must sign, defaults to all of them",
+		},
+		cli.DurationFlag{
+			Name:  "interval",
+			Value: 5 * time.Second,
+			Usage: "the block interval of the ledger",
+		},
+		cli.StringFlag{
+			Name:  "description",
+			Value: "MedChain admin",
+			Usage: "the description of the admin DARC",
+		},
+		cli.BoolFlag{
+			Name:  "encrypt",
+			Usage: "encrypt the new key with a passphrase, see 'medchain key encrypt'",
+		},
+	},
+}
+
+// initChain creates the ledger like "bcadmin create", with a new key owning
+// the genesis DARC, then spawns the admin DARC. The config written uses the
+// admin DARC, so that the commands of the CLI and bcadmin act on it.
+func initChain(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the roster file")
+	}
+
+	roster, err := readRoster(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to read roster: %v", err)
+	}
+
+	owner := darc.NewSignerEd25519(nil, nil)
+
+	admins := []darc.Identity{owner.Identity()}
+	if c.String("admins") != "" {
+		admins, err = parseIdentities(c.String("admins"))
+		if err != nil {
+			return xerrors.Errorf("failed to parse admins: %v", err)
+		}
+	}
+
+	threshold := c.Int("threshold")
+	if threshold == 0 {
+		threshold = len(admins)
+	}
+
+	adminDarc, err := client.NewAdminDarc(admins, threshold, c.String("description"))
+	if err != nil {
+		return xerrors.Errorf("failed to create admin darc: %v", err)
+	}
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		nil, owner.Identity())
+	if err != nil {
+		return xerrors.Errorf("failed to create genesis message: %v", err)
+	}
+
+	genesisMsg.BlockInterval = c.Duration("interval")
+
+	bcl, resp, err := byzcoin.NewLedger(genesisMsg, false)
+	if err != nil {
+		return xerrors.Errorf("failed to create ledger: %v", err)
+	}
+
+	err = saveKey(owner, c.Bool("encrypt"))
+	if err != nil {
+		return xerrors.Errorf("failed to save key: %v", err)
+	}
+
+	err = client.NewClient(bcl, nil).SpawnDarc(genesisMsg.GenesisDarc.GetBaseID(),
+		adminDarc, owner)
+	if err != nil {
+		return xerrors.Errorf("failed to spawn admin darc: %v", err)
+	}
+
+	cfg := lib.Config{
+		ByzCoinID:     resp.Skipblock.SkipChainID(),
+		Roster:        *roster,
+		AdminDarc:     *adminDarc,
+		AdminIdentity: owner.Identity(),
+	}
+
+	fn, err := lib.SaveConfig(cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to save config: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "ByzCoin ID: %x\n", cfg.ByzCoinID)
+	fmt.Fprintf(c.App.Writer, "genesis DARC: %s\n", genesisMsg.GenesisDarc.GetIdentityString())
+	fmt.Fprintf(c.App.Writer, "admin DARC: %s\n", adminDarc.GetIdentityString())
+	fmt.Fprintf(c.App.Writer, "owner of the genesis DARC: %s\n", owner.Identity())
+	fmt.Fprintf(c.App.Writer, "admins: %d of %d\n", threshold, len(admins))
+
+	for _, admin := range admins {
+		fmt.Fprintf(c.App.Writer, "  %s\n", admin)
+	}
+
+	fmt.Fprintf(c.App.Writer, "\nexport BC=\"%s\"\n", fn)
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ldsec/medchain/secrets"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var keyCommand = cli.Command{
+	Name:  "key",
+	Usage: "protect the key files with a passphrase",
+	Description: "The passphrase is read from MEDCHAIN_PASSPHRASE, from the file given by " +
+		"MEDCHAIN_PASSPHRASE_FILE, or asked on the terminal. Encrypted keys can't be " +
+		"used by bcadmin.",
+	Subcommands: []cli.Command{
+		{
+			Name:      "encrypt",
+			Usage:     "encrypt the key file of an identity",
+			ArgsUsage: "<identity>",
+			Action: func(c *cli.Context) error {
+				return convertKey(c, true)
+			},
+		},
+		{
+			Name:      "decrypt",
+			Usage:     "decrypt the key file of an identity",
+			ArgsUsage: "<identity>",
+			Action: func(c *cli.Context) error {
+				return convertKey(c, false)
+			},
+		},
+	},
+}
+
+// convertKey encrypts or decrypts the key file of an identity in place.
+func convertKey(c *cli.Context, encrypt bool) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the identity")
+	}
+
+	fn := keyFile(c.Args().First())
+
+	raw, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return xerrors.Errorf("failed to read key: %v", err)
+	}
+
+	if encrypt && secrets.IsEncrypted(raw) {
+		return xerrors.Errorf("%s is already encrypted", fn)
+	}
+
+	if !encrypt && !secrets.IsEncrypted(raw) {
+		return xerrors.Errorf("%s is not encrypted", fn)
+	}
+
+	signer, err := loadKey(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to load key: %v", err)
+	}
+
+	// the key file is only replaced once the new one is written
+	err = saveKey(*signer, encrypt)
+	if err != nil {
+		return xerrors.Errorf("failed to save key: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "Wrote key file to %s\n", fn)
+
+	return nil
+}
+
+// keyFile returns the path of the key file of the identity, like bcadmin.
+func keyFile(id string) string {
+	return filepath.Join(lib.ConfigPath, fmt.Sprintf("key-%s.cfg", id))
+}
+
+// loadKey is lib.LoadKeyFromString for key files that may be encrypted.
+func loadKey(id string) (*darc.Signer, error) {
+	buf, err := secrets.ReadFile(keyFile(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var signer darc.Signer
+
+	err = protobuf.DecodeWithConstructors(buf, &signer,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode key: %v", err)
+	}
+
+	return &signer, nil
+}
+
+// saveKey is lib.SaveKey with an optional encryption.
+func saveKey(signer darc.Signer, encrypt bool) error {
+	err := os.MkdirAll(lib.ConfigPath, 0755)
+	if err != nil {
+		return xerrors.Errorf("failed to create folder: %v", err)
+	}
+
+	buf, err := protobuf.Encode(&signer)
+	if err != nil {
+		return xerrors.Errorf("failed to encode key: %v", err)
+	}
+
+	// read-only as there is key material inside
+	return secrets.WriteFile(keyFile(signer.Identity().String()), buf, 0400, encrypt)
+}
@@ -0,0 +1,199 @@
+// Medchain is the command line interface to interact with the MedChain smart
+// contracts. It relies on the ByzCoin configuration created by bcadmin, which
+// can be provided with the --bc flag or the BC environment variable, or by a
+// named profile when the user takes part in several consortia.
+//
+// Build it with:
+//
+//	go build -o medchain ./cli
+package main
+
+import (
+	"os"
+
+	"github.com/ldsec/medchain/client"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"go.dedis.ch/onet/v3/cfgpath"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+const (
+	// DefaultName is the name of the binary we produce.
+	DefaultName = "medchain"
+)
+
+var gitTag = ""
+
+func main() {
+	cliApp := cli.NewApp()
+	cliApp.Name = DefaultName
+	cliApp.Usage = "interact with the MedChain smart contracts"
+	if gitTag == "" {
+		cliApp.Version = "unknown"
+	} else {
+		cliApp.Version = gitTag
+	}
+
+	cliApp.Commands = []cli.Command{
+		initCommand,
+		projectCommand,
+		queryCommand,
+		datasetCommand,
+		catalogCommand,
+		consentCommand,
+		duaCommand,
+		userCommand,
+		gatewayCommand,
+		proofCommand,
+		verifyCommand,
+		reportCommand,
+		adminCommand,
+		nodeCommand,
+		keyCommand,
+		profileCommand,
+		completionCommand,
+	}
+	cliApp.EnableBashCompletion = true
+	cliApp.Flags = []cli.Flag{
+		cli.IntFlag{
+			Name:  "debug, d",
+			Value: 0,
+			Usage: "debug-level: 1 for terse, 5 for maximal",
+		},
+		cli.StringFlag{
+			Name:  "config, c",
+			Value: cfgpath.GetConfigPath(lib.BcaName),
+			Usage: "path to the folder containing the bcadmin keys",
+		},
+		cli.StringFlag{
+			Name:   "bc",
+			EnvVar: "BC",
+			Usage:  "the ByzCoin config to use (required)",
+		},
+		cli.StringFlag{
+			Name:  "proxy",
+			Usage: "address of the node running bypros, defaults to the first node of the roster",
+		},
+		cli.StringFlag{
+			Name:   "profile, p",
+			EnvVar: "MEDCHAIN_PROFILE",
+			Usage:  "the chain profile to use instead of --bc, see 'medchain profile'",
+		},
+	}
+	cliApp.Before = func(c *cli.Context) error {
+		log.SetDebugVisible(c.Int("debug"))
+		lib.ConfigPath = c.String("config")
+		return nil
+	}
+
+	err := cliApp.Run(os.Args)
+	log.ErrFatal(err)
+}
+
+// getClient creates a MedChain client from the ByzCoin config given with the
+// global flags.
+func getClient(c *cli.Context) (*client.Client, error) {
+	cl, _, err := loadConfig(c)
+	return cl, err
+}
+
+// loadConfig loads the ByzCoin config of the profile given with the global
+// flags and creates a MedChain client.
+func loadConfig(c *cli.Context) (*client.Client, lib.Config, error) {
+	profile, err := getProfile(c)
+	if err != nil {
+		return nil, lib.Config{}, err
+	}
+
+	return profile.Open()
+}
+
+// getProfile returns the profile given with --profile, or the one of the --bc
+// flag, or the default profile. The --proxy flag overrides the proxy of the
+// profile.
+func getProfile(c *cli.Context) (client.Profile, error) {
+	var profile client.Profile
+
+	if c.GlobalString("profile") != "" || c.GlobalString("bc") == "" {
+		profiles, err := client.LoadProfiles(profilesFile())
+		if err != nil {
+			return client.Profile{}, xerrors.Errorf("failed to load profiles: %v", err)
+		}
+
+		if c.GlobalString("profile") == "" && profiles.Default == "" {
+			return client.Profile{}, xerrors.New("--bc flag or a profile is required")
+		}
+
+		profile, err = profiles.Get(c.GlobalString("profile"))
+		if err != nil {
+			return client.Profile{}, xerrors.Errorf("failed to get profile: %v", err)
+		}
+	} else {
+		profile = client.Profile{Config: c.GlobalString("bc")}
+	}
+
+	if c.GlobalString("proxy") != "" {
+		profile.Proxy = c.GlobalString("proxy")
+	}
+
+	return profile, nil
+}
+
+// getSigner loads the key given with the --sign flag, or the signer of the
+// profile, or the admin key of the ByzCoin config if none is set.
+func getSigner(c *cli.Context, cfg lib.Config) (*darc.Signer, error) {
+	id := c.String("sign")
+	if id == "" {
+		profile, err := getProfile(c)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get profile: %v", err)
+		}
+
+		id = profile.Signer
+	}
+
+	if id != "" {
+		signer, err := loadKey(id)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to load key: %v", err)
+		}
+
+		return signer, nil
+	}
+
+	signer, err := loadKey(cfg.AdminIdentity.String())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load admin key: %v", err)
+	}
+
+	return signer, nil
+}
+
+// signFlag is the flag used by the commands that send transactions.
+var signFlag = cli.StringFlag{
+	Name:  "sign",
+	Usage: "the identity of the signer, defaults to the one of the profile or the admin identity of the config",
+}
+
+// readRoster reads a roster from a group file, like the public.toml of the
+// nodes.
+func readRoster(path string) (*onet.Roster, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open file: %v", err)
+	}
+
+	defer f.Close()
+
+	group, err := app.ReadGroupDescToml(f)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode group: %v", err)
+	}
+
+	return group.Roster, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var nodeCommand = cli.Command{
+	Name:  "node",
+	Usage: "manage the nodes of the roster",
+	Subcommands: []cli.Command{
+		{
+			Name: "update",
+			Usage: "replace a node of the roster by the one of its public.toml, " +
+				"after 'conode rotate-keys'",
+			ArgsUsage: "<public.toml>",
+			Action:    nodeUpdate,
+			Flags:     []cli.Flag{signFlag},
+		},
+	},
+}
+
+// nodeUpdate updates the service keys of a node in the roster of the chain.
+// The signer needs the "invoke:config.update_config" rule of the genesis DARC,
+// given to the key created by init.
+func nodeUpdate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the public.toml of the node")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	roster, err := readRoster(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to read roster: %v", err)
+	}
+
+	if len(roster.List) != 1 {
+		return xerrors.Errorf("expected one node, got %d", len(roster.List))
+	}
+
+	node := roster.List[0]
+
+	err = cl.UpdateNode(node, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to update node: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "node %s updated, restart it with its new private.toml\n",
+		node.Address)
+
+	return nil
+}
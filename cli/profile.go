@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/ldsec/medchain/client"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// profilesFileName is the file of the profiles, in the config folder.
+const profilesFileName = "profiles.toml"
+
+var profileCommand = cli.Command{
+	Name:  "profile",
+	Usage: "manage the chains of the consortia the user takes part in",
+	Description: "A profile names the ByzCoin config of a chain, with its proxy and signer. " +
+		"The commands use the profile given with --profile, or the default one " +
+		"if neither --profile nor --bc is given.",
+	Subcommands: []cli.Command{
+		{
+			Name:      "add",
+			Usage:     "add a profile, the first one becomes the default profile",
+			ArgsUsage: "<name>",
+			Action:    profileAdd,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "bc",
+					Usage: "the ByzCoin config of the chain (required)",
+				},
+				cli.StringFlag{
+					Name:  "proxy",
+					Usage: "address of the node running bypros, defaults to the first node of the roster",
+				},
+				cli.StringFlag{
+					Name:  "signer",
+					Usage: "the identity signing the transactions, defaults to the admin identity of the config",
+				},
+			},
+		},
+		{
+			Name:   "list",
+			Usage:  "print the profiles",
+			Action: profileList,
+		},
+		{
+			Name:      "use",
+			Usage:     "set the default profile",
+			ArgsUsage: "<name>",
+			Action:    profileUse,
+		},
+		{
+			Name:      "remove",
+			Usage:     "remove a profile",
+			ArgsUsage: "<name>",
+			Action:    profileRemove,
+		},
+	},
+}
+
+// profilesFile returns the path of the profiles of the user.
+func profilesFile() string {
+	return filepath.Join(lib.ConfigPath, profilesFileName)
+}
+
+// updateProfiles applies the change to the profiles and saves them.
+func updateProfiles(change func(*client.Profiles) error) error {
+	profiles, err := client.LoadProfiles(profilesFile())
+	if err != nil {
+		return xerrors.Errorf("failed to load profiles: %v", err)
+	}
+
+	err = change(profiles)
+	if err != nil {
+		return err
+	}
+
+	err = profiles.Save(profilesFile())
+	if err != nil {
+		return xerrors.Errorf("failed to save profiles: %v", err)
+	}
+
+	return nil
+}
+
+func profileAdd(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the name of the profile")
+	}
+
+	if c.String("bc") == "" {
+		return xerrors.New("--bc flag is required")
+	}
+
+	config, err := filepath.Abs(c.String("bc"))
+	if err != nil {
+		return xerrors.Errorf("failed to get path: %v", err)
+	}
+
+	profile := client.Profile{
+		Name:   c.Args().First(),
+		Config: config,
+		Proxy:  c.String("proxy"),
+		Signer: c.String("signer"),
+	}
+
+	// the profile must be usable
+	_, cfg, err := profile.Open()
+	if err != nil {
+		return xerrors.Errorf("failed to open profile: %v", err)
+	}
+
+	err = updateProfiles(func(profiles *client.Profiles) error {
+		return profiles.Add(profile)
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to add profile: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "profile %s added for chain %x\n", profile.Name, cfg.ByzCoinID)
+
+	return nil
+}
+
+func profileList(c *cli.Context) error {
+	profiles, err := client.LoadProfiles(profilesFile())
+	if err != nil {
+		return xerrors.Errorf("failed to load profiles: %v", err)
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "\tNAME\tCONFIG\tPROXY\tSIGNER")
+
+	for _, profile := range profiles.Profiles {
+		mark := ""
+		if profile.Name == profiles.Default {
+			mark = "*"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, profile.Name, profile.Config,
+			profile.Proxy, profile.Signer)
+	}
+
+	return w.Flush()
+}
+
+func profileUse(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the name of the profile")
+	}
+
+	err := updateProfiles(func(profiles *client.Profiles) error {
+		return profiles.SetDefault(c.Args().First())
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to set default profile: %v", err)
+	}
+
+	return nil
+}
+
+func profileRemove(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the name of the profile")
+	}
+
+	err := updateProfiles(func(profiles *client.Profiles) error {
+		return profiles.Remove(c.Args().First())
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to remove profile: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ldsec/medchain/client"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var projectCommand = cli.Command{
+	Name:  "project",
+	Usage: "read project instances",
+	Subcommands: []cli.Command{
+		{
+			Name:      "show",
+			Usage:     "print a project",
+			ArgsUsage: "<project instance ID or name>",
+			Action:    projectShow,
+		},
+		{
+			Name: "resolve",
+			Usage: "print the instance IDs of the projects with the given name, " +
+				"or the name of the project with the given instance ID",
+			ArgsUsage: "<project instance ID or name>",
+			Action:    projectResolve,
+		},
+		{
+			Name: "grant",
+			Usage: "authorize a user to query the terms on the project, which must be " +
+				"in the catalog of the project if it has one",
+			ArgsUsage:    "<project instance ID or name> <userID> <term>...",
+			Action:       projectGrant,
+			Flags:        []cli.Flag{signFlag},
+			BashComplete: completeProjectTerms,
+		},
+		{
+			Name:      "revoke",
+			Usage:     "remove the authorization of a user to query a term on the project",
+			ArgsUsage: "<project instance ID or name> <userID> <term>",
+			Action:    projectRevoke,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name: "set-catalog",
+			Usage: "set the catalog of the valid query terms of the project, " +
+				"any term can be granted again if no catalog is given",
+			ArgsUsage: "<project instance ID or name> [<catalog instance ID>]",
+			Action:    projectSetCatalog,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name: "set-dua",
+			Usage: "set the data use agreement the users of the project must attest, " +
+				"no attestation is required anymore if no agreement is given",
+			ArgsUsage: "<project instance ID or name> [<dua instance ID>]",
+			Action:    projectSetDUA,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "terms",
+			Usage:     "print the terms of the catalog of the project that contain the text",
+			ArgsUsage: "<project instance ID or name> [<text>]",
+			Action:    projectTerms,
+		},
+		{
+			Name:      "migrate",
+			Usage:     "rewrite a project with the latest version of its format",
+			ArgsUsage: "<project instance ID or name>",
+			Action:    projectMigrate,
+			Flags:     []cli.Flag{signFlag},
+		},
+	},
+}
+
+func projectShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the project instance ID or name")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	project, err := cl.GetProject(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get project: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "- InstanceID: %s\n", id)
+	fmt.Fprint(c.App.Writer, project)
+
+	return nil
+}
+
+func projectResolve(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the project instance ID or name")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	idOrName := c.Args().First()
+
+	id, err := client.ParseInstanceID(idOrName)
+	if err == nil {
+		name, err := cl.ProjectName(id)
+		if err == nil {
+			fmt.Fprintln(c.App.Writer, name)
+			return nil
+		}
+	}
+
+	ids, err := cl.ProjectIDs(idOrName)
+	if err != nil {
+		return xerrors.Errorf("failed to get project IDs: %v", err)
+	}
+
+	if len(ids) == 0 {
+		return xerrors.Errorf("project '%s' not found", idOrName)
+	}
+
+	for _, id := range ids {
+		fmt.Fprintln(c.App.Writer, id)
+	}
+
+	return nil
+}
+
+func projectMigrate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the project instance ID or name")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	err = cl.MigrateProject(id, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to migrate: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "project %s migrated\n", id)
+
+	return nil
+}
+
+func projectGrant(c *cli.Context) error {
+	if c.NArg() < 3 {
+		return xerrors.New("please provide the project instance ID or name, the userID and the terms")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	terms := c.Args()[2:]
+
+	// the chain refuses the unknown terms anyway, but it can't tell which
+	catalog, err := cl.GetProjectCatalog(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get catalog: %v", err)
+	}
+
+	if catalog != nil {
+		for _, term := range terms {
+			if catalog.Find(term) == nil {
+				return xerrors.Errorf("unknown query term '%s', see 'medchain project terms'", term)
+			}
+		}
+	}
+
+	err = cl.GrantQueryTerms(id, c.Args().Get(1), terms, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to grant terms: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "terms %v granted to %s\n", terms, c.Args().Get(1))
+
+	return nil
+}
+
+func projectRevoke(c *cli.Context) error {
+	if c.NArg() != 3 {
+		return xerrors.New("please provide the project instance ID or name, the userID and the term")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	err = cl.RevokeQueryTerm(id, c.Args().Get(1), c.Args().Get(2), *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to revoke term: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "term %s revoked from %s\n", c.Args().Get(2), c.Args().Get(1))
+
+	return nil
+}
+
+func projectSetCatalog(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return xerrors.New("please provide the project instance ID or name and the catalog instance ID")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	var catalogID *byzcoin.InstanceID
+
+	if c.NArg() == 2 {
+		parsed, err := client.ParseInstanceID(c.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("failed to parse catalog ID: %v", err)
+		}
+
+		catalogID = &parsed
+	}
+
+	err = cl.SetProjectCatalog(id, catalogID, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to set catalog: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "catalog of project %s updated\n", id)
+
+	return nil
+}
+
+func projectSetDUA(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return xerrors.New("please provide the project instance ID or name and the dua instance ID")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	var duaID *byzcoin.InstanceID
+
+	if c.NArg() == 2 {
+		parsed, err := client.ParseInstanceID(c.Args().Get(1))
+		if err != nil {
+			return xerrors.Errorf("failed to parse dua ID: %v", err)
+		}
+
+		duaID = &parsed
+	}
+
+	err = cl.SetProjectDUA(id, duaID, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to set dua: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "dua of project %s updated\n", id)
+
+	return nil
+}
+
+func projectTerms(c *cli.Context) error {
+	if c.NArg() < 1 || c.NArg() > 2 {
+		return xerrors.New("please provide the project instance ID or name and the text")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to resolve project: %v", err)
+	}
+
+	catalog, err := cl.GetProjectCatalog(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get catalog: %v", err)
+	}
+
+	if catalog == nil {
+		return xerrors.Errorf("project %s has no catalog", id)
+	}
+
+	printCatalogTerms(c.App.Writer, catalog.Search(c.Args().Get(1)))
+
+	return nil
+}
+
+// completeProjectTerms completes the terms of "project grant" with the terms
+// of the catalog of the project that are not given yet.
+func completeProjectTerms(c *cli.Context) {
+	if c.NArg() < 2 {
+		return
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return
+	}
+
+	id, err := cl.ResolveProject(c.Args().First())
+	if err != nil {
+		return
+	}
+
+	catalog, err := cl.GetProjectCatalog(id)
+	if err != nil || catalog == nil {
+		return
+	}
+
+	given := make(map[string]bool)
+	for _, term := range c.Args()[2:] {
+		given[term] = true
+	}
+
+	for _, term := range catalog.Terms {
+		if !given[term.Term] {
+			fmt.Fprintln(c.App.Writer, term.Term)
+		}
+	}
+}
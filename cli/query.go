@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var queryCommand = cli.Command{
+	Name:  "query",
+	Usage: "read query instances",
+	Subcommands: []cli.Command{
+		{
+			Name:      "show",
+			Usage:     "print a query, either from its instance ID or its queryID",
+			ArgsUsage: "<queryID or query instance ID>",
+			Action:    queryShow,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "project",
+					Usage: "the project instance ID or name, needed to find a query by its queryID",
+				},
+			},
+		},
+		{
+			Name:      "approve",
+			Usage:     "approve a query as the custodian of a dataset",
+			ArgsUsage: "<query instance ID>",
+			Action:    queryDecide,
+			Flags:     decideFlags,
+		},
+		{
+			Name:      "deny",
+			Usage:     "deny a query as the custodian of a dataset, which rejects the query",
+			ArgsUsage: "<query instance ID>",
+			Action:    queryDecide,
+			Flags:     decideFlags,
+		},
+		{
+			Name:      "receipt",
+			Usage:     "write a receipt proving the query and its status",
+			ArgsUsage: "<query instance ID>",
+			Action:    queryReceipt,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "out, o",
+					Value: "receipt.bin",
+					Usage: "the file to write the receipt to",
+				},
+			},
+		},
+		{
+			Name:      "verify-receipt",
+			Usage:     "verify a query receipt offline",
+			ArgsUsage: "<receipt file>",
+			Action:    queryVerifyReceipt,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "roster",
+					Usage: "the trusted roster of the genesis block, as a public.toml file (required)",
+				},
+				cli.StringFlag{
+					Name:  "id",
+					Usage: "the trusted ByzCoin ID, in hex (required)",
+				},
+			},
+		},
+		{
+			Name:      "migrate",
+			Usage:     "rewrite a query with the latest version of its format",
+			ArgsUsage: "<query instance ID>",
+			Action:    queryMigrate,
+			Flags: []cli.Flag{
+				signFlag,
+				cli.StringFlag{
+					Name: "project",
+					Usage: "the project instance ID or name, needed for queries " +
+						"stored before versioning",
+				},
+			},
+		},
+	},
+}
+
+var decideFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "sign",
+		Usage: "the identity of the dataset's custodian (required)",
+	},
+	cli.StringFlag{
+		Name:  "dataset",
+		Usage: "the dataset instance ID (required)",
+	},
+}
+
+func queryShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the queryID or query instance ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	var query *contracts.QueryContract
+
+	if c.String("project") != "" {
+		projectID, err := cl.ResolveProject(c.String("project"))
+		if err != nil {
+			return xerrors.Errorf("failed to resolve project: %v", err)
+		}
+
+		query, err = cl.GetQueryByID(projectID, c.Args().First())
+		if err != nil {
+			return xerrors.Errorf("failed to get query: %v", err)
+		}
+	} else {
+		id, err := client.ParseInstanceID(c.Args().First())
+		if err != nil {
+			return xerrors.Errorf("failed to parse instance ID "+
+				"(use --project to find a query by its queryID): %v", err)
+		}
+
+		query, err = cl.GetQuery(id)
+		if err != nil {
+			return xerrors.Errorf("failed to get query: %v", err)
+		}
+	}
+
+	// queries stored before versioning must be migrated to know their project
+	if query.ProjectID == "" {
+		fmt.Fprint(c.App.Writer, query)
+		return nil
+	}
+
+	// The project name stored on the query is the one at the time of the
+	// spawn, we display the current one.
+	_, project, err := cl.GetQueryProject(query)
+	if err != nil {
+		return xerrors.Errorf("failed to get query's project: %v", err)
+	}
+
+	query.ProjectName = project.Name
+
+	fmt.Fprint(c.App.Writer, query)
+
+	return nil
+}
+
+func queryMigrate(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the query instance ID")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	var projectID *byzcoin.InstanceID
+
+	if c.String("project") != "" {
+		id, err := cl.ResolveProject(c.String("project"))
+		if err != nil {
+			return xerrors.Errorf("failed to resolve project: %v", err)
+		}
+
+		projectID = &id
+	}
+
+	err = cl.MigrateQuery(id, projectID, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to migrate: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "query %s migrated\n", id)
+
+	return nil
+}
+
+// queryDecide approves or denies a query, depending on the command name.
+func queryDecide(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the query instance ID")
+	}
+
+	if c.String("sign") == "" || c.String("dataset") == "" {
+		return xerrors.New("--sign and --dataset are required")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	custodian, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	datasetID, err := client.ParseInstanceID(c.String("dataset"))
+	if err != nil {
+		return xerrors.Errorf("failed to parse dataset ID: %v", err)
+	}
+
+	if c.Command.Name == "deny" {
+		err = cl.DenyQuery(id, datasetID, *custodian)
+	} else {
+		err = cl.ApproveQuery(id, datasetID, *custodian)
+	}
+
+	if err != nil {
+		return xerrors.Errorf("failed to %s query: %v", c.Command.Name, err)
+	}
+
+	query, err := cl.GetQuery(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get query: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "query %s is %s\n", id, query.Status)
+
+	return nil
+}
+
+func queryReceipt(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the query instance ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	receipt, err := cl.QueryReceipt(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get receipt: %v", err)
+	}
+
+	buf, err := client.EncodeReceipt(receipt)
+	if err != nil {
+		return xerrors.Errorf("failed to encode receipt: %v", err)
+	}
+
+	err = ioutil.WriteFile(c.String("out"), buf, 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to write receipt: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "receipt for query %s with status '%s' at block %d "+
+		"written to %s\n", id, receipt.Status, receipt.BlockIndex, c.String("out"))
+
+	return nil
+}
+
+// queryVerifyReceipt verifies a receipt without any network access.
+func queryVerifyReceipt(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the receipt file")
+	}
+
+	if c.String("roster") == "" || c.String("id") == "" {
+		return xerrors.New("--roster and --id are required")
+	}
+
+	roster, err := readRoster(c.String("roster"))
+	if err != nil {
+		return xerrors.Errorf("failed to read roster: %v", err)
+	}
+
+	byzcoinID, err := hex.DecodeString(c.String("id"))
+	if err != nil {
+		return xerrors.Errorf("failed to decode ByzCoin ID: %v", err)
+	}
+
+	buf, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to read receipt: %v", err)
+	}
+
+	receipt, err := client.DecodeReceipt(buf)
+	if err != nil {
+		return xerrors.Errorf("failed to decode receipt: %v", err)
+	}
+
+	err = receipt.Verify(byzcoinID, roster)
+	if err != nil {
+		return xerrors.Errorf("invalid receipt: %v", err)
+	}
+
+	query, err := receipt.Query()
+	if err != nil {
+		return xerrors.Errorf("failed to read query: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "receipt is valid, query %s is '%s' at block %d\n",
+		receipt.InstanceID, receipt.Status, receipt.BlockIndex)
+	fmt.Fprint(c.App.Writer, query)
+
+	return nil
+}
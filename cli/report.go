@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/ldsec/medchain/report"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// dateLayout is the layout of the --from and --to flags.
+const dateLayout = "2006-01-02"
+
+var reportCommand = cli.Command{
+	Name:  "report",
+	Usage: "generate an audit report of the grants, revocations and queries",
+	Description: "The instructions are read from the ByzCoin proxy. The HTML " +
+		"format is styled to be printed or converted to PDF.",
+	Action: reportGenerate,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "from",
+			Usage: "the first day of the report, as " + dateLayout,
+		},
+		cli.StringFlag{
+			Name:  "to",
+			Usage: "the last day of the report, included, as " + dateLayout,
+		},
+		cli.StringFlag{
+			Name:  "project",
+			Usage: "only report the events of this project, by instance ID or name",
+		},
+		cli.StringFlag{
+			Name:  "user",
+			Usage: "only report the events of this UserID",
+		},
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: report.FormatCSV,
+			Usage: "the format of the report: csv, json or html",
+		},
+		cli.StringFlag{
+			Name:  "out, o",
+			Usage: "the file to write the report to, defaults to the standard output",
+		},
+	},
+}
+
+func reportGenerate(c *cli.Context) error {
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	filter := report.Filter{
+		UserID: c.String("user"),
+	}
+
+	if c.String("from") != "" {
+		filter.From, err = time.Parse(dateLayout, c.String("from"))
+		if err != nil {
+			return xerrors.Errorf("failed to parse --from: %v", err)
+		}
+	}
+
+	if c.String("to") != "" {
+		to, err := time.Parse(dateLayout, c.String("to"))
+		if err != nil {
+			return xerrors.Errorf("failed to parse --to: %v", err)
+		}
+
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	if c.String("project") != "" {
+		id, err := cl.ResolveProject(c.String("project"))
+		if err != nil {
+			return xerrors.Errorf("failed to resolve project: %v", err)
+		}
+
+		filter.ProjectID = id.String()
+	}
+
+	r, err := report.NewGenerator(cl, cl).Generate(filter)
+	if err != nil {
+		return xerrors.Errorf("failed to generate report: %v", err)
+	}
+
+	var w io.Writer = c.App.Writer
+
+	if c.String("out") != "" {
+		f, err := os.Create(c.String("out"))
+		if err != nil {
+			return xerrors.Errorf("failed to create file: %v", err)
+		}
+
+		defer f.Close()
+
+		w = f
+	}
+
+	err = r.Write(w, c.String("format"))
+	if err != nil {
+		return xerrors.Errorf("failed to write report: %v", err)
+	}
+
+	return nil
+}
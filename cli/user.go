@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var userCommand = cli.Command{
+	Name:  "user",
+	Usage: "manage the identities bound to the UserIDs",
+	Subcommands: []cli.Command{
+		{
+			Name:      "show",
+			Usage:     "print a user",
+			ArgsUsage: "<userID>",
+			Action:    userShow,
+		},
+		{
+			Name:      "register",
+			Usage:     "bind a UserID to identities",
+			ArgsUsage: "<userID> <identity>[,<identity>...]",
+			Action:    userRegister,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "add",
+			Usage:     "allow more identities to act as the user",
+			ArgsUsage: "<userID> <identity>[,<identity>...]",
+			Action:    userAdd,
+			Flags:     []cli.Flag{signFlag},
+		},
+		{
+			Name:      "remove",
+			Usage:     "revoke an identity of the user",
+			ArgsUsage: "<userID> <identity>",
+			Action:    userRemove,
+			Flags:     []cli.Flag{signFlag},
+		},
+	},
+}
+
+func userShow(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the userID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	user, err := cl.GetUser(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to get user: %v", err)
+	}
+
+	fmt.Fprint(c.App.Writer, user)
+
+	return nil
+}
+
+func userRegister(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the userID and the identities")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	identities, err := parseIdentities(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to parse identities: %v", err)
+	}
+
+	err = cl.RegisterUser(cfg.AdminDarc.GetBaseID(), c.Args().First(), identities, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to register user: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "user %s registered\n", c.Args().First())
+
+	return nil
+}
+
+func userAdd(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the userID and the identities")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	identities, err := parseIdentities(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to parse identities: %v", err)
+	}
+
+	err = cl.AddUserIdentities(c.Args().First(), identities, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to add identities: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "identities added to user %s\n", c.Args().First())
+
+	return nil
+}
+
+func userRemove(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return xerrors.New("please provide the userID and the identity")
+	}
+
+	cl, cfg, err := loadConfig(c)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	signer, err := getSigner(c, cfg)
+	if err != nil {
+		return xerrors.Errorf("failed to get signer: %v", err)
+	}
+
+	identity, err := darc.ParseIdentity(c.Args().Get(1))
+	if err != nil {
+		return xerrors.Errorf("failed to parse identity: %v", err)
+	}
+
+	err = cl.RemoveUserIdentity(c.Args().First(), identity, *signer)
+	if err != nil {
+		return xerrors.Errorf("failed to remove identity: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "identity removed from user %s\n", c.Args().First())
+
+	return nil
+}
+
+// parseIdentities parses a coma separated list of identities.
+func parseIdentities(s string) ([]darc.Identity, error) {
+	var identities []darc.Identity
+
+	for _, str := range strings.Split(s, ",") {
+		identity, err := darc.ParseIdentity(strings.TrimSpace(str))
+		if err != nil {
+			return nil, xerrors.Errorf("invalid identity '%s': %v", str, err)
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ldsec/medchain/client"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var proofCommand = cli.Command{
+	Name:      "proof",
+	Usage:     "write the proof of an instance, to be verified offline with 'verify'",
+	ArgsUsage: "<instance ID>",
+	Action:    proofWrite,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "out, o",
+			Value: "proof.bin",
+			Usage: "the file to write the proof to",
+		},
+		cli.StringFlag{
+			Name:  "genesis",
+			Usage: "if set, the file to write the genesis block to",
+		},
+	},
+}
+
+var verifyCommand = cli.Command{
+	Name:  "verify",
+	Usage: "verify the proof of a project or query offline and print its state",
+	Description: "The proof is verified against a trusted genesis block, or a " +
+		"trusted roster of the genesis block and ByzCoin ID. No network access " +
+		"is needed.",
+	ArgsUsage: "<proof file>",
+	Action:    verifyProof,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "genesis",
+			Usage: "the trusted genesis block, as written by 'proof --genesis'",
+		},
+		cli.StringFlag{
+			Name:  "roster",
+			Usage: "the trusted roster of the genesis block, as a public.toml file",
+		},
+		cli.StringFlag{
+			Name:  "id",
+			Usage: "the trusted ByzCoin ID, in hex, needed with --roster",
+		},
+		cli.StringFlag{
+			Name:  "instance",
+			Usage: "if set, the instance ID the proof must be about",
+		},
+	},
+}
+
+func proofWrite(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the instance ID")
+	}
+
+	cl, err := getClient(c)
+	if err != nil {
+		return xerrors.Errorf("failed to get client: %v", err)
+	}
+
+	id, err := client.ParseInstanceID(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to parse instance ID: %v", err)
+	}
+
+	proof, err := cl.GetProof(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	buf, err := client.EncodeProof(proof)
+	if err != nil {
+		return xerrors.Errorf("failed to encode proof: %v", err)
+	}
+
+	err = ioutil.WriteFile(c.String("out"), buf, 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to write proof: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "proof at block %d written to %s\n",
+		proof.Latest.Index, c.String("out"))
+
+	if c.String("genesis") == "" {
+		return nil
+	}
+
+	genesis, err := cl.GetGenesis()
+	if err != nil {
+		return xerrors.Errorf("failed to get genesis: %v", err)
+	}
+
+	buf, err = client.EncodeGenesis(genesis)
+	if err != nil {
+		return xerrors.Errorf("failed to encode genesis: %v", err)
+	}
+
+	err = ioutil.WriteFile(c.String("genesis"), buf, 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to write genesis: %v", err)
+	}
+
+	fmt.Fprintf(c.App.Writer, "genesis block written to %s\n", c.String("genesis"))
+
+	return nil
+}
+
+// verifyProof verifies a proof without any network access.
+func verifyProof(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return xerrors.New("please provide the proof file")
+	}
+
+	buf, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return xerrors.Errorf("failed to read proof: %v", err)
+	}
+
+	proof, err := client.DecodeProof(buf)
+	if err != nil {
+		return xerrors.Errorf("failed to decode proof: %v", err)
+	}
+
+	var instance *client.Instance
+
+	switch {
+	case c.String("genesis") != "":
+		buf, err := ioutil.ReadFile(c.String("genesis"))
+		if err != nil {
+			return xerrors.Errorf("failed to read genesis: %v", err)
+		}
+
+		genesis, err := client.DecodeGenesis(buf)
+		if err != nil {
+			return xerrors.Errorf("failed to decode genesis: %v", err)
+		}
+
+		instance, err = client.VerifyProofFromGenesis(proof, genesis)
+		if err != nil {
+			return xerrors.Errorf("invalid proof: %v", err)
+		}
+	case c.String("roster") != "" && c.String("id") != "":
+		roster, err := readRoster(c.String("roster"))
+		if err != nil {
+			return xerrors.Errorf("failed to read roster: %v", err)
+		}
+
+		byzcoinID, err := hex.DecodeString(c.String("id"))
+		if err != nil {
+			return xerrors.Errorf("failed to decode ByzCoin ID: %v", err)
+		}
+
+		instance, err = client.VerifyProof(proof, byzcoinID, roster)
+		if err != nil {
+			return xerrors.Errorf("invalid proof: %v", err)
+		}
+	default:
+		return xerrors.New("either --genesis, or --roster and --id are required")
+	}
+
+	if c.String("instance") != "" && c.String("instance") != instance.ID.String() {
+		return xerrors.Errorf("proof is for instance %s, not %s", instance.ID,
+			c.String("instance"))
+	}
+
+	fmt.Fprintf(c.App.Writer, "proof is valid at block %d\n", instance.BlockIndex)
+	fmt.Fprint(c.App.Writer, instance)
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// AdminRules are the rules of the admin DARC guarding the actions of the
+// MedChain contracts.
+//
+// The spawn:query and invoke:query.update rules are not enforced yet: queries
+// are spawned through their project, which checks the identities of the user
+// instead of a DARC, and the update of a query isn't verified by a DARC. They
+// are reserved for when the update gets a DARC check (see the TODO of the
+// query contract), so that existing chains don't need a DARC evolution then.
+var AdminRules = []darc.Action{
+	spawnRule(contracts.ProjectContractID),
+	invokeRule(contracts.ProjectContractID, contracts.ProjectAddAction),
+	invokeRule(contracts.ProjectContractID, contracts.ProjectRemoveAction),
+	invokeRule(contracts.ProjectContractID, contracts.ProjectAddDatasetAction),
+	invokeRule(contracts.ProjectContractID, contracts.ProjectRemoveDatasetAction),
+	invokeRule(contracts.ProjectContractID, contracts.ProjectSetCatalogAction),
+	invokeRule(contracts.ProjectContractID, contracts.ProjectSetDUAAction),
+	invokeRule(contracts.ProjectContractID, contracts.MigrateAction),
+	spawnRule(contracts.QueryContractID),
+	invokeRule(contracts.QueryContractID, contracts.QueryUpdateAction),
+	invokeRule(contracts.QueryContractID, contracts.MigrateAction),
+	spawnRule(contracts.DatasetContractID),
+	invokeRule(contracts.DatasetContractID, contracts.DatasetAddAction),
+	invokeRule(contracts.DatasetContractID, contracts.DatasetRemoveAction),
+	invokeRule(contracts.DatasetContractID, contracts.DatasetSetConsentAction),
+	invokeRule(contracts.DatasetContractID, contracts.DatasetSetCustodianAction),
+	invokeRule(contracts.DatasetContractID, contracts.MigrateAction),
+	spawnRule(contracts.ConsentContractID),
+	invokeRule(contracts.ConsentContractID, contracts.ConsentSetAction),
+	invokeRule(contracts.ConsentContractID, contracts.ConsentRemoveAction),
+	invokeRule(contracts.ConsentContractID, contracts.MigrateAction),
+	spawnRule(contracts.CatalogContractID),
+	invokeRule(contracts.CatalogContractID, contracts.CatalogAddAction),
+	invokeRule(contracts.CatalogContractID, contracts.CatalogRemoveAction),
+	invokeRule(contracts.CatalogContractID, contracts.MigrateAction),
+	spawnRule(contracts.DUAContractID),
+	invokeRule(contracts.DUAContractID, contracts.DUAPublishAction),
+	invokeRule(contracts.DUAContractID, contracts.MigrateAction),
+	spawnRule(contracts.UserContractID),
+	invokeRule(contracts.UserContractID, contracts.UserAddIdentityAction),
+	invokeRule(contracts.UserContractID, contracts.UserRemoveIdentityAction),
+	invokeRule(contracts.UserContractID, contracts.MigrateAction),
+}
+
+// deferredRules let any admin propose a transaction, sign it, and execute it
+// once it gathered enough signatures.
+var deferredRules = []darc.Action{
+	spawnRule(byzcoin.ContractDeferredID),
+	invokeRule(byzcoin.ContractDeferredID, "addProof"),
+	invokeRule(byzcoin.ContractDeferredID, "execProposedTx"),
+}
+
+// NewAdminDarc creates the DARC of the MedChain administrators. The
+// AdminRules, signing and evolving the DARC need the signatures of at least
+// threshold of the identities. As the signatures can be gathered with a
+// deferred transaction, any of the identities can use the deferred contract.
+func NewAdminDarc(identities []darc.Identity, threshold int, desc string) (*darc.Darc, error) {
+	expr, err := ThresholdExpr(identities, threshold)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create expression: %v", err)
+	}
+
+	anyExpr, err := ThresholdExpr(identities, 1)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create expression: %v", err)
+	}
+
+	rules := darc.NewRules()
+
+	actions := append([]darc.Action{"_sign", "invoke:darc.evolve"}, AdminRules...)
+	for _, action := range actions {
+		err = rules.AddRule(action, expr)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to add rule %s: %v", action, err)
+		}
+	}
+
+	for _, action := range deferredRules {
+		err = rules.AddRule(action, anyExpr)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to add rule %s: %v", action, err)
+		}
+	}
+
+	return darc.NewDarc(rules, []byte(desc)), nil
+}
+
+// MaxAdmins is the maximum number of identities of a threshold expression.
+// The expression lists every subset of threshold identities, so it grows with
+// the binomial coefficient: with 7 identities, the admin DARC is already about
+// 360kB, and it doubles with each additional identity.
+const MaxAdmins = 7
+
+// ThresholdExpr returns an expression that is satisfied by the signatures of
+// at least threshold of the identities. It fails for more than MaxAdmins
+// identities.
+func ThresholdExpr(identities []darc.Identity, threshold int) (expression.Expr, error) {
+	if len(identities) > MaxAdmins {
+		return nil, xerrors.Errorf("at most %d identities are supported, got %d",
+			MaxAdmins, len(identities))
+	}
+
+	if threshold < 1 || threshold > len(identities) {
+		return nil, xerrors.Errorf("threshold must be between 1 and %d, got %d",
+			len(identities), threshold)
+	}
+
+	ids := make([]string, len(identities))
+	seen := make(map[string]bool)
+
+	for i, identity := range identities {
+		ids[i] = identity.String()
+
+		if seen[ids[i]] {
+			return nil, xerrors.Errorf("duplicate identity %s", ids[i])
+		}
+
+		seen[ids[i]] = true
+	}
+
+	var groups []string
+
+	for _, group := range combinations(ids, threshold) {
+		groups = append(groups, "("+string(expression.InitAndExpr(group...))+")")
+	}
+
+	return expression.InitOrExpr(groups...), nil
+}
+
+// combinations returns the subsets of k elements of the list, in order.
+func combinations(list []string, k int) [][]string {
+	if k == 0 {
+		return [][]string{{}}
+	}
+
+	var res [][]string
+
+	for i := 0; i <= len(list)-k; i++ {
+		for _, rest := range combinations(list[i+1:], k-1) {
+			res = append(res, append([]string{list[i]}, rest...))
+		}
+	}
+
+	return res
+}
+
+// SpawnDarc spawns the DARC. It needs the "spawn:darc" rule on the parent
+// DARC.
+func (c *Client) SpawnDarc(parentID darc.ID, d *darc.Darc, signers ...darc.Signer) error {
+	buf, err := protobuf.Encode(d)
+	if err != nil {
+		return xerrors.Errorf("failed to encode darc: %v", err)
+	}
+
+	_, err = c.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(parentID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDarcID,
+			Args: byzcoin.Arguments{{
+				Name:  "darc",
+				Value: buf,
+			}},
+		},
+	}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to spawn darc: %v", err)
+	}
+
+	return nil
+}
+
+func spawnRule(contractID string) darc.Action {
+	return darc.Action("spawn:" + contractID)
+}
+
+func invokeRule(contractID, command string) darc.Action {
+	return darc.Action("invoke:" + contractID + "." + command)
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestThresholdExpr(t *testing.T) {
+	a := darc.NewIdentityEd25519(darc.NewSignerEd25519(nil, nil).Ed25519.Point)
+	b := darc.NewIdentityEd25519(darc.NewSignerEd25519(nil, nil).Ed25519.Point)
+	c := darc.NewIdentityEd25519(darc.NewSignerEd25519(nil, nil).Ed25519.Point)
+
+	expr, err := ThresholdExpr([]darc.Identity{a, b, c}, 2)
+	require.NoError(t, err)
+	require.Equal(t, expression.Expr("("+a.String()+" & "+b.String()+") | ("+
+		a.String()+" & "+c.String()+") | ("+b.String()+" & "+c.String()+")"), expr)
+
+	expr, err = ThresholdExpr([]darc.Identity{a}, 1)
+	require.NoError(t, err)
+	require.Equal(t, expression.Expr("("+a.String()+")"), expr)
+
+	_, err = ThresholdExpr([]darc.Identity{a, b}, 3)
+	require.EqualError(t, err, "threshold must be between 1 and 2, got 3")
+
+	_, err = ThresholdExpr([]darc.Identity{a, b}, 0)
+	require.Error(t, err)
+
+	_, err = ThresholdExpr([]darc.Identity{a, a}, 1)
+	require.EqualError(t, err, "duplicate identity "+a.String())
+
+	ids := make([]darc.Identity, MaxAdmins+1)
+	for i := range ids {
+		ids[i] = darc.NewSignerEd25519(nil, nil).Identity()
+	}
+
+	_, err = ThresholdExpr(ids, 2)
+	require.EqualError(t, err, "at most 7 identities are supported, got 8")
+}
+
+func TestClient_SpawnDarc(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		nil, owner.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	admins := []darc.Signer{
+		darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil),
+	}
+
+	identities := make([]darc.Identity, len(admins))
+	for i, admin := range admins {
+		identities[i] = admin.Identity()
+	}
+
+	adminDarc, err := NewAdminDarc(identities, 2, "admin")
+	require.NoError(t, err)
+
+	for _, rule := range AdminRules {
+		require.True(t, adminDarc.Rules.Contains(rule), rule)
+	}
+
+	// the query rules are installed even if they are not enforced yet
+	require.True(t, adminDarc.Rules.Contains("spawn:query"))
+	require.True(t, adminDarc.Rules.Contains("invoke:query.update"))
+
+	require.NoError(t, cl.SpawnDarc(gDarc.GetBaseID(), adminDarc, owner))
+
+	spawnProject := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(adminDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}
+
+	// one admin is not enough
+	_, err = cl.SendInstruction(spawnProject, admins[0])
+	require.Error(t, err)
+
+	_, err = cl.SendInstruction(spawnProject, admins[0], admins[2])
+	require.NoError(t, err)
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+)
+
+// GetCatalog returns the catalog stored at the given instance ID.
+func (c *Client) GetCatalog(id byzcoin.InstanceID) (*contracts.CatalogContract, error) {
+	buf, err := c.getInstance(id, contracts.CatalogContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get catalog: %v", err)
+	}
+
+	return contracts.DecodeCatalogContract(buf)
+}
+
+// GetProjectCatalog returns the catalog of the project, or nil if the project
+// has none.
+func (c *Client) GetProjectCatalog(projectID byzcoin.InstanceID) (*contracts.CatalogContract, error) {
+	project, err := c.GetProject(projectID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get project: %v", err)
+	}
+
+	if project.Catalog == "" {
+		return nil, nil
+	}
+
+	catalogID, err := ParseInstanceID(project.Catalog)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid catalog ID: %v", err)
+	}
+
+	return c.GetCatalog(catalogID)
+}
+
+// SpawnCatalog spawns an empty catalog and returns its instance ID. It needs
+// the "spawn:catalog" rule on the DARC.
+func (c *Client) SpawnCatalog(darcID darc.ID, name, description string,
+	signers ...darc.Signer) (byzcoin.InstanceID, error) {
+
+	ctx, err := c.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.CatalogContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.CatalogNameKey,
+				Value: []byte(name),
+			}, {
+				Name:  contracts.CatalogDescriptionKey,
+				Value: []byte(description),
+			}},
+		},
+	}, signers...)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to spawn catalog: %v", err)
+	}
+
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// AddCatalogTerms adds the terms to the catalog in a single transaction. The
+// label and code of the terms already in the catalog are updated. It needs
+// the "invoke:catalog.add" rule.
+func (c *Client) AddCatalogTerms(id byzcoin.InstanceID, terms []contracts.CatalogTerm,
+	signers ...darc.Signer) error {
+
+	if len(terms) == 0 {
+		return nil
+	}
+
+	insts := make([]byzcoin.Instruction, len(terms))
+
+	for i, term := range terms {
+		insts[i] = byzcoin.Instruction{
+			InstanceID: id,
+			Invoke: &byzcoin.Invoke{
+				ContractID: contracts.CatalogContractID,
+				Command:    contracts.CatalogAddAction,
+				Args: byzcoin.Arguments{{
+					Name:  contracts.CatalogTermKey,
+					Value: []byte(term.Term),
+				}, {
+					Name:  contracts.CatalogLabelKey,
+					Value: []byte(term.Label),
+				}, {
+					Name:  contracts.CatalogCodeKey,
+					Value: []byte(term.Code),
+				}},
+			},
+		}
+	}
+
+	_, err := c.SendInstructions(insts, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to add terms: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveCatalogTerm removes the term from the catalog. The authorizations
+// already granted on the term are kept. It needs the "invoke:catalog.remove"
+// rule.
+func (c *Client) RemoveCatalogTerm(id byzcoin.InstanceID, term string,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(id, contracts.CatalogContractID, contracts.CatalogRemoveAction,
+		byzcoin.Arguments{{
+			Name:  contracts.CatalogTermKey,
+			Value: []byte(term),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to remove term: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestClient_Catalog(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:catalog", "invoke:catalog.add",
+			"invoke:catalog.remove", "invoke:project.add", "invoke:project.remove",
+			"invoke:project.setCatalog"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: []byzcoin.Argument{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	catalogID, err := cl.SpawnCatalog(gDarc.GetBaseID(), "catalog", "desc", signer)
+	require.NoError(t, err)
+
+	// the terms are added in a single transaction
+	terms := []contracts.CatalogTerm{
+		{Term: "q1", Label: "Hypertension", Code: "SNOMED-CT:38341003"},
+		{Term: "q2", Label: "Diabetes", Code: "SNOMED-CT:73211009"},
+		{Term: "q3"},
+	}
+	require.NoError(t, cl.AddCatalogTerms(catalogID, terms, signer))
+	require.NoError(t, cl.RemoveCatalogTerm(catalogID, "q3", signer))
+
+	catalog, err := cl.GetCatalog(catalogID)
+	require.NoError(t, err)
+	require.Equal(t, "catalog", catalog.Name)
+	require.Equal(t, []*contracts.CatalogTerm{&terms[0], &terms[1]}, catalog.Terms)
+
+	// a catalog is not a project
+	_, err = cl.GetProject(catalogID)
+	require.Error(t, err)
+
+	catalog, err = cl.GetProjectCatalog(projectID)
+	require.NoError(t, err)
+	require.Nil(t, catalog)
+
+	require.NoError(t, cl.SetProjectCatalog(projectID, &catalogID, signer))
+
+	catalog, err = cl.GetProjectCatalog(projectID)
+	require.NoError(t, err)
+	require.Equal(t, "catalog", catalog.Name)
+
+	require.NoError(t, cl.GrantQueryTerms(projectID, "userID", []string{"q1", "q2"}, signer))
+	require.Error(t, cl.GrantQueryTerms(projectID, "userID", []string{"q3"}, signer))
+	require.NoError(t, cl.RevokeQueryTerm(projectID, "userID", "q1", signer))
+
+	project, err := cl.GetProject(projectID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"q2"}, project.Authorizations.Find("userID").QueryTerms)
+
+	require.NoError(t, cl.SetProjectCatalog(projectID, nil, signer))
+
+	catalog, err = cl.GetProjectCatalog(projectID)
+	require.NoError(t, err)
+	require.Nil(t, catalog)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
@@ -0,0 +1,601 @@
+// Package client provides a Go API to read and resolve the MedChain smart
+// contract instances stored on a ByzCoin chain.
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// Client is a client for the MedChain smart contracts.
+//
+// Reading instances only needs the ByzCoin client. Resolving a project from its
+// name needs to browse the chain, which is done with the ByzCoin proxy (bypros)
+// running on the proxy node.
+type Client struct {
+	bcl   *byzcoin.Client
+	proxy *network.ServerIdentity
+}
+
+// NewClient creates a new MedChain client. The proxy is the node running
+// bypros. It can be nil, in which case the first node of the roster is used.
+func NewClient(bcl *byzcoin.Client, proxy *network.ServerIdentity) *Client {
+	if proxy == nil && len(bcl.Roster.List) > 0 {
+		proxy = bcl.Roster.List[0]
+	}
+
+	return &Client{
+		bcl:   bcl,
+		proxy: proxy,
+	}
+}
+
+// ByzCoin returns the underlying ByzCoin client.
+func (c *Client) ByzCoin() *byzcoin.Client {
+	return c.bcl
+}
+
+// GetProject returns the project stored at the given instance ID.
+func (c *Client) GetProject(id byzcoin.InstanceID) (*contracts.ProjectContract, error) {
+	buf, err := c.getInstance(id, contracts.ProjectContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get project: %v", err)
+	}
+
+	return contracts.DecodeProjectContract(buf)
+}
+
+// GetQuery returns the query stored at the given instance ID.
+func (c *Client) GetQuery(id byzcoin.InstanceID) (*contracts.QueryContract, error) {
+	buf, err := c.getInstance(id, contracts.QueryContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get query: %v", err)
+	}
+
+	return contracts.DecodeQueryContract(buf)
+}
+
+// GetSpawnedQuery returns the query stored at the given instance ID as it was
+// spawned, which is read from the state change of the spawn.
+func (c *Client) GetSpawnedQuery(id byzcoin.InstanceID) (*contracts.QueryContract, error) {
+	var reply byzcoin.GetInstanceVersionResponse
+
+	// the version of an instance starts at 0 when it is spawned
+	err := c.bcl.SendProtobuf(c.bcl.Roster.List[0], &byzcoin.GetInstanceVersion{
+		SkipChainID: c.bcl.ID,
+		InstanceID:  id,
+		Version:     0,
+	}, &reply)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get state change: %v", err)
+	}
+
+	sc := reply.StateChange
+	if sc.StateAction != byzcoin.Create || sc.ContractID != contracts.QueryContractID {
+		return nil, xerrors.Errorf("instance %s is not a spawned query", id)
+	}
+
+	return contracts.DecodeQueryContract(sc.Value)
+}
+
+// GetDataset returns the dataset stored at the given instance ID.
+func (c *Client) GetDataset(id byzcoin.InstanceID) (*contracts.DatasetContract, error) {
+	buf, err := c.getInstance(id, contracts.DatasetContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get dataset: %v", err)
+	}
+
+	return contracts.DecodeDatasetContract(buf)
+}
+
+// GetUser returns the user registered with the given UserID.
+func (c *Client) GetUser(userID string) (*contracts.UserContract, error) {
+	buf, err := c.getInstance(contracts.NewUserInstanceID(userID), contracts.UserContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get user: %v", err)
+	}
+
+	return contracts.DecodeUserContract(buf)
+}
+
+// GetQueryByID returns the query with the given queryID on a project.
+func (c *Client) GetQueryByID(projectID byzcoin.InstanceID,
+	queryID string) (*contracts.QueryContract, error) {
+
+	return c.GetQuery(contracts.NewQueryInstanceID(projectID, queryID))
+}
+
+// GetQueryProject returns the instance ID of the project that spawned the
+// query, along with the project itself.
+func (c *Client) GetQueryProject(query *contracts.QueryContract) (byzcoin.InstanceID,
+	*contracts.ProjectContract, error) {
+
+	projectID, err := ParseInstanceID(query.ProjectID)
+	if err != nil {
+		return byzcoin.InstanceID{}, nil, xerrors.Errorf("invalid project ID: %v", err)
+	}
+
+	project, err := c.GetProject(projectID)
+	if err != nil {
+		return byzcoin.InstanceID{}, nil, xerrors.Errorf("failed to get project: %v", err)
+	}
+
+	return projectID, project, nil
+}
+
+// ProjectName returns the name of the project stored at the given instance ID.
+func (c *Client) ProjectName(id byzcoin.InstanceID) (string, error) {
+	project, err := c.GetProject(id)
+	if err != nil {
+		return "", xerrors.Errorf("failed to get project: %v", err)
+	}
+
+	return project.Name, nil
+}
+
+// ProjectIDs returns the instance IDs of the projects spawned with the given
+// name. Names are not unique, which is why a list is returned.
+func (c *Client) ProjectIDs(name string) ([]byzcoin.InstanceID, error) {
+	// The name is hex-encoded to prevent any injection in the query.
+	query := fmt.Sprintf(`select encode(instruction.contract_iid, 'hex') as id
+from cothority.instruction
+join cothority."transaction" on
+	"transaction".transaction_id = instruction.transaction_id
+join cothority.argument on
+	argument.instruction_id = instruction.instruction_id
+where "transaction".accepted = true
+and instruction.action = 'spawn:%s'
+and argument.name = '%s'
+and argument.value = decode('%s', 'hex')`, contracts.ProjectContractID,
+		contracts.ProjectNameKey, hex.EncodeToString([]byte(name)))
+
+	res, err := c.ProxyQuery(query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query proxy: %v", err)
+	}
+
+	var rows []struct {
+		ID string `json:"id"`
+	}
+
+	err = json.Unmarshal(res, &rows)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode result: %v", err)
+	}
+
+	ids := make([]byzcoin.InstanceID, 0, len(rows))
+
+	for _, row := range rows {
+		id, err := ParseInstanceID(row.ID)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid instance ID: %v", err)
+		}
+
+		// the project might have been spawned and the instruction stored, but
+		// we make sure the instance really holds a project with that name.
+		project, err := c.GetProject(id)
+		if err != nil || project.Name != name {
+			continue
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ProxyQuery runs a read-only SQL query on the ByzCoin proxy and returns the
+// JSON-encoded rows.
+func (c *Client) ProxyQuery(query string) ([]byte, error) {
+	if c.proxy == nil {
+		return nil, xerrors.New("no proxy node to browse the chain")
+	}
+
+	res, err := bypros.NewClient().Query(c.proxy, query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query proxy: %v", err)
+	}
+
+	return res, nil
+}
+
+// BlockTime returns the index and the timestamp of the block with the given
+// hash.
+func (c *Client) BlockTime(hash skipchain.SkipBlockID) (int, time.Time, error) {
+	block, err := skipchain.NewClient().GetSingleBlock(&c.bcl.Roster, hash)
+	if err != nil {
+		return 0, time.Time{}, xerrors.Errorf("failed to get block: %v", err)
+	}
+
+	var header byzcoin.DataHeader
+
+	err = protobuf.Decode(block.Data, &header)
+	if err != nil {
+		return 0, time.Time{}, xerrors.Errorf("failed to decode header: %v", err)
+	}
+
+	return block.Index, time.Unix(0, header.Timestamp), nil
+}
+
+// ResolveProject returns the instance ID of a project given either its
+// hex-encoded instance ID or its name. An error is returned if the name is
+// ambiguous.
+func (c *Client) ResolveProject(idOrName string) (byzcoin.InstanceID, error) {
+	id, err := ParseInstanceID(idOrName)
+	if err == nil {
+		_, err = c.GetProject(id)
+		if err == nil {
+			return id, nil
+		}
+	}
+
+	ids, err := c.ProjectIDs(idOrName)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to find project: %v", err)
+	}
+
+	switch len(ids) {
+	case 0:
+		return byzcoin.InstanceID{}, xerrors.Errorf("project '%s' not found", idOrName)
+	case 1:
+		return ids[0], nil
+	default:
+		return byzcoin.InstanceID{}, xerrors.Errorf("%d projects are named '%s', "+
+			"use the instance ID instead", len(ids), idOrName)
+	}
+}
+
+// MigrateProject rewrites a project instance with the latest version of its
+// format. It needs the "invoke:project.migrate" rule.
+func (c *Client) MigrateProject(id byzcoin.InstanceID, signers ...darc.Signer) error {
+	_, err := c.Invoke(id, contracts.ProjectContractID, contracts.MigrateAction,
+		nil, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to migrate project: %v", err)
+	}
+
+	return nil
+}
+
+// GrantQueryTerms authorizes the user to query the terms on the project. It
+// needs the "invoke:project.add" rule. If the project has a catalog, the terms
+// must be in the catalog.
+func (c *Client) GrantQueryTerms(projectID byzcoin.InstanceID, userID string,
+	terms []string, signers ...darc.Signer) error {
+
+	_, err := c.Invoke(projectID, contracts.ProjectContractID, contracts.ProjectAddAction,
+		byzcoin.Arguments{{
+			Name:  contracts.ProjectUserIDKey,
+			Value: []byte(userID),
+		}, {
+			Name:  contracts.ProjectQueryTermKey,
+			Value: []byte(strings.Join(terms, ",")),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to grant query terms: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeQueryTerm removes the authorization of the user to query the term on
+// the project. It needs the "invoke:project.remove" rule.
+func (c *Client) RevokeQueryTerm(projectID byzcoin.InstanceID, userID, term string,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(projectID, contracts.ProjectContractID, contracts.ProjectRemoveAction,
+		byzcoin.Arguments{{
+			Name:  contracts.ProjectUserIDKey,
+			Value: []byte(userID),
+		}, {
+			Name:  contracts.ProjectQueryTermKey,
+			Value: []byte(term),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to revoke query term: %v", err)
+	}
+
+	return nil
+}
+
+// SetProjectCatalog sets the catalog of the valid query terms of the project.
+// The project accepts any term again if catalogID is nil. It needs the
+// "invoke:project.setCatalog" rule.
+func (c *Client) SetProjectCatalog(projectID byzcoin.InstanceID,
+	catalogID *byzcoin.InstanceID, signers ...darc.Signer) error {
+
+	var args byzcoin.Arguments
+	if catalogID != nil {
+		args = byzcoin.Arguments{{
+			Name:  contracts.ProjectCatalogIDKey,
+			Value: catalogID.Slice(),
+		}}
+	}
+
+	_, err := c.Invoke(projectID, contracts.ProjectContractID,
+		contracts.ProjectSetCatalogAction, args, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to set catalog: %v", err)
+	}
+
+	return nil
+}
+
+// SetDatasetCustodian sets the custodian whose approval the queries on the
+// dataset need. The queries don't need an approval anymore if custodian is
+// nil. It needs the "invoke:dataset.setCustodian" rule.
+func (c *Client) SetDatasetCustodian(datasetID byzcoin.InstanceID,
+	custodian *darc.Identity, signers ...darc.Signer) error {
+
+	var args byzcoin.Arguments
+	if custodian != nil {
+		args = byzcoin.Arguments{{
+			Name:  contracts.DatasetCustodianKey,
+			Value: []byte(custodian.String()),
+		}}
+	}
+
+	_, err := c.Invoke(datasetID, contracts.DatasetContractID,
+		contracts.DatasetSetCustodianAction, args, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to set custodian: %v", err)
+	}
+
+	return nil
+}
+
+// MigrateQuery rewrites a query instance with the latest version of its
+// format. It needs the "invoke:query.migrate" rule. Queries stored before
+// versioning don't know the instance ID of their project, which must then be
+// provided with projectID. It is ignored if nil.
+func (c *Client) MigrateQuery(id byzcoin.InstanceID, projectID *byzcoin.InstanceID,
+	signers ...darc.Signer) error {
+
+	var args byzcoin.Arguments
+	if projectID != nil {
+		args = byzcoin.Arguments{{
+			Name:  contracts.QueryProjectIDKey,
+			Value: projectID.Slice(),
+		}}
+	}
+
+	_, err := c.Invoke(id, contracts.QueryContractID, contracts.MigrateAction,
+		args, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to migrate query: %v", err)
+	}
+
+	return nil
+}
+
+// ApproveQuery records the approval of the query by the custodian of the
+// dataset. The signer must be the custodian.
+func (c *Client) ApproveQuery(id, datasetID byzcoin.InstanceID, custodian darc.Signer) error {
+	_, err := c.Invoke(id, contracts.QueryContractID, contracts.QueryApproveAction,
+		byzcoin.Arguments{{Name: contracts.QueryDatasetIDKey, Value: datasetID.Slice()}},
+		custodian)
+	if err != nil {
+		return xerrors.Errorf("failed to approve query: %v", err)
+	}
+
+	return nil
+}
+
+// DenyQuery records the denial of the query by the custodian of the dataset,
+// which rejects the query. The signer must be the custodian.
+func (c *Client) DenyQuery(id, datasetID byzcoin.InstanceID, custodian darc.Signer) error {
+	_, err := c.Invoke(id, contracts.QueryContractID, contracts.QueryDenyAction,
+		byzcoin.Arguments{{Name: contracts.QueryDatasetIDKey, Value: datasetID.Slice()}},
+		custodian)
+	if err != nil {
+		return xerrors.Errorf("failed to deny query: %v", err)
+	}
+
+	return nil
+}
+
+// RegisterUser binds the UserID to the identities. It needs the "spawn:user"
+// rule on the DARC.
+func (c *Client) RegisterUser(darcID darc.ID, userID string, identities []darc.Identity,
+	signers ...darc.Signer) error {
+
+	_, err := c.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.UserContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.UserUserIDKey,
+				Value: []byte(userID),
+			}, {
+				Name:  contracts.UserIdentityKey,
+				Value: []byte(joinIdentities(identities)),
+			}},
+		},
+	}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to register user: %v", err)
+	}
+
+	return nil
+}
+
+// AddUserIdentities allows more identities to act as the user. It needs the
+// "invoke:user.addIdentity" rule.
+func (c *Client) AddUserIdentities(userID string, identities []darc.Identity,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(contracts.NewUserInstanceID(userID), contracts.UserContractID,
+		contracts.UserAddIdentityAction, byzcoin.Arguments{{
+			Name:  contracts.UserIdentityKey,
+			Value: []byte(joinIdentities(identities)),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to add identities: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveUserIdentity revokes an identity of the user. It needs the
+// "invoke:user.removeIdentity" rule.
+func (c *Client) RemoveUserIdentity(userID string, identity darc.Identity,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(contracts.NewUserInstanceID(userID), contracts.UserContractID,
+		contracts.UserRemoveIdentityAction, byzcoin.Arguments{{
+			Name:  contracts.UserIdentityKey,
+			Value: []byte(identity.String()),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to remove identity: %v", err)
+	}
+
+	return nil
+}
+
+// SpawnQuery spawns a query on the project and returns its instance ID. The
+// signer must be an identity registered for the user.
+func (c *Client) SpawnQuery(projectID byzcoin.InstanceID, userID, queryID,
+	queryDefinition, description string, signer darc.Signer) (byzcoin.InstanceID, error) {
+
+	_, err := c.SendInstruction(byzcoin.Instruction{
+		InstanceID: projectID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.QueryContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.QueryDescriptionKey,
+				Value: []byte(description),
+			}, {
+				Name:  contracts.QueryUserIDKey,
+				Value: []byte(userID),
+			}, {
+				Name:  contracts.QueryQueryIDKey,
+				Value: []byte(queryID),
+			}, {
+				Name:  contracts.QueryQueryDefinitionKey,
+				Value: []byte(queryDefinition),
+			}},
+		},
+	}, signer)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to spawn query: %v", err)
+	}
+
+	return contracts.NewQueryInstanceID(projectID, queryID), nil
+}
+
+// Invoke sends an invoke instruction signed by the signers and waits for it to
+// be included.
+func (c *Client) Invoke(id byzcoin.InstanceID, contractID, command string,
+	args byzcoin.Arguments, signers ...darc.Signer) (byzcoin.ClientTransaction, error) {
+
+	return c.SendInstruction(byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contractID,
+			Command:    command,
+			Args:       args,
+		},
+	}, signers...)
+}
+
+// SendInstruction fills the signer counters of the instruction, signs it with
+// the signers, and waits for it to be included.
+func (c *Client) SendInstruction(inst byzcoin.Instruction,
+	signers ...darc.Signer) (byzcoin.ClientTransaction, error) {
+
+	return c.SendInstructions([]byzcoin.Instruction{inst}, signers...)
+}
+
+// SendInstructions sends the instructions in a single transaction, which is
+// either accepted or refused as a whole. The signer counters are filled in the
+// order of the instructions.
+func (c *Client) SendInstructions(insts []byzcoin.Instruction,
+	signers ...darc.Signer) (byzcoin.ClientTransaction, error) {
+
+	ids := make([]string, len(signers))
+	for i, signer := range signers {
+		ids[i] = signer.Identity().String()
+	}
+
+	counters, err := c.bcl.GetSignerCounters(ids...)
+	if err != nil {
+		return byzcoin.ClientTransaction{}, xerrors.Errorf("failed to get counters: %v", err)
+	}
+
+	for i := range insts {
+		insts[i].SignerCounter = make([]uint64, len(counters.Counters))
+		for j, counter := range counters.Counters {
+			insts[i].SignerCounter[j] = counter + uint64(i) + 1
+		}
+	}
+
+	ctx, err := c.bcl.CreateTransaction(insts...)
+	if err != nil {
+		return byzcoin.ClientTransaction{}, xerrors.Errorf("failed to create transaction: %v", err)
+	}
+
+	err = ctx.FillSignersAndSignWith(signers...)
+	if err != nil {
+		return byzcoin.ClientTransaction{}, xerrors.Errorf("failed to sign: %v", err)
+	}
+
+	_, err = c.bcl.AddTransactionAndWait(ctx, 10)
+	if err != nil {
+		return byzcoin.ClientTransaction{}, xerrors.Errorf("failed to add transaction: %v", err)
+	}
+
+	return ctx, nil
+}
+
+// getInstance fetches the instance, checks that it belongs to the expected
+// contract, and returns its value.
+func (c *Client) getInstance(id byzcoin.InstanceID, contractID string) ([]byte, error) {
+	resp, err := c.bcl.GetProofFromLatest(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	if !resp.Proof.InclusionProof.Match(id.Slice()) {
+		return nil, xerrors.Errorf("instance %s not found", id)
+	}
+
+	buf, cid, _, err := resp.Proof.Get(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get value: %v", err)
+	}
+
+	if cid != contractID {
+		return nil, xerrors.Errorf("instance is not a %s: %s", contractID, cid)
+	}
+
+	return buf, nil
+}
+
+// ParseInstanceID parses a hex-encoded instance ID.
+func ParseInstanceID(s string) (byzcoin.InstanceID, error) {
+	return contracts.ParseInstanceID(s)
+}
+
+// joinIdentities returns the coma separated list of identities expected by the
+// user contract.
+func joinIdentities(identities []darc.Identity) string {
+	ids := make([]string, len(identities))
+	for i, id := range identities {
+		ids[i] = id.String()
+	}
+
+	return strings.Join(ids, ",")
+}
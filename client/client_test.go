@@ -0,0 +1,159 @@
+package client
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// The proxy service needs a database to start, which is not available in the
+// tests. Resolving projects by name is therefore not tested here.
+func TestMain(m *testing.M) {
+	err := onet.UnregisterService(bypros.ServiceName)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestClient_Get(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:user", "invoke:project.migrate"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	ctx, err := bcl.CreateTransaction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: []byzcoin.Argument{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+		SignerCounter: []uint64{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = bcl.AddTransactionAndWait(ctx, 10)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	cl := NewClient(bcl, nil)
+
+	user := darc.NewSignerEd25519(nil, nil)
+
+	err = cl.RegisterUser(gDarc.GetBaseID(), "userID", []darc.Identity{user.Identity()}, signer)
+	require.NoError(t, err)
+
+	u, err := cl.GetUser("userID")
+	require.NoError(t, err)
+	require.Equal(t, []string{user.Identity().String()}, u.Identities)
+
+	_, err = cl.GetUser("unknown")
+	require.Error(t, err)
+
+	// only the user can spawn its queries
+	_, err = cl.SpawnQuery(projectID, "userID", "queryID", "", "", signer)
+	require.Error(t, err)
+
+	queryID, err := cl.SpawnQuery(projectID, "userID", "queryID", "", "", user)
+	require.NoError(t, err)
+	require.Equal(t, contracts.NewQueryInstanceID(projectID, "queryID"), queryID)
+
+	project, err := cl.GetProject(projectID)
+	require.NoError(t, err)
+	require.Equal(t, "name", project.Name)
+
+	name, err := cl.ProjectName(projectID)
+	require.NoError(t, err)
+	require.Equal(t, "name", name)
+
+	id, err := cl.ResolveProject(projectID.String())
+	require.NoError(t, err)
+	require.Equal(t, projectID, id)
+
+	query, err := cl.GetQueryByID(projectID, "queryID")
+	require.NoError(t, err)
+	require.Equal(t, "userID", query.UserID)
+	require.Equal(t, projectID.String(), query.ProjectID)
+	require.Equal(t, "name", query.ProjectName)
+
+	id, project, err = cl.GetQueryProject(query)
+	require.NoError(t, err)
+	require.Equal(t, projectID, id)
+	require.Equal(t, "name", project.Name)
+
+	_, err = cl.Invoke(queryID, contracts.QueryContractID, contracts.QueryUpdateAction,
+		byzcoin.Arguments{{Name: contracts.QueryStatusKey, Value: []byte(contracts.QuerySuccessStatus)}},
+		user)
+	require.NoError(t, err)
+
+	// the query as spawned is kept in the state changes
+	spawned, err := cl.GetSpawnedQuery(queryID)
+	require.NoError(t, err)
+	require.Equal(t, query.Status, spawned.Status)
+
+	query, err = cl.GetQuery(queryID)
+	require.NoError(t, err)
+	require.Equal(t, contracts.QuerySuccessStatus, query.Status)
+
+	_, err = cl.GetSpawnedQuery(projectID)
+	require.Error(t, err)
+
+	// a project is not a query
+	_, err = cl.GetQuery(projectID)
+	require.Error(t, err)
+
+	_, err = cl.GetDataset(projectID)
+	require.Error(t, err)
+
+	_, err = cl.GetQueryByID(projectID, "unknown")
+	require.Error(t, err)
+
+	err = cl.MigrateProject(projectID, signer)
+	require.NoError(t, err)
+
+	// no "invoke:query.migrate" rule
+	err = cl.MigrateQuery(contracts.NewQueryInstanceID(projectID, "queryID"), nil, signer)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
+
+func TestParseInstanceID(t *testing.T) {
+	id := byzcoin.NewInstanceID([]byte("some id"))
+
+	res, err := ParseInstanceID(id.String())
+	require.NoError(t, err)
+	require.Equal(t, id, res)
+
+	_, err = ParseInstanceID("not hex")
+	require.Error(t, err)
+
+	_, err = ParseInstanceID("aabb")
+	require.EqualError(t, err, "wrong length: 2")
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+)
+
+// GetConsent returns the consent stored at the given instance ID.
+func (c *Client) GetConsent(id byzcoin.InstanceID) (*contracts.ConsentContract, error) {
+	buf, err := c.getInstance(id, contracts.ConsentContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get consent: %v", err)
+	}
+
+	return contracts.DecodeConsentContract(buf)
+}
+
+// SpawnConsent spawns the consent of a cohort, without rules, and returns its
+// instance ID. It needs the "spawn:consent" rule on the DARC.
+func (c *Client) SpawnConsent(darcID darc.ID, cohort string,
+	signers ...darc.Signer) (byzcoin.InstanceID, error) {
+
+	ctx, err := c.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ConsentContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ConsentCohortKey,
+				Value: []byte(cohort),
+			}},
+		},
+	}, signers...)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to spawn consent: %v", err)
+	}
+
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// SetConsentRule adds the rule to the consent, or replaces the rule of the same
+// category. It needs the "invoke:consent.set" rule.
+func (c *Client) SetConsentRule(id byzcoin.InstanceID, rule contracts.ConsentRule,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(id, contracts.ConsentContractID, contracts.ConsentSetAction,
+		byzcoin.Arguments{{
+			Name:  contracts.ConsentCategoryKey,
+			Value: []byte(rule.Category),
+		}, {
+			Name:  contracts.ConsentDescriptionKey,
+			Value: []byte(rule.Description),
+		}, {
+			Name:  contracts.ConsentForbiddenKey,
+			Value: []byte(strings.Join(rule.Forbidden, ",")),
+		}, {
+			Name:  contracts.ConsentPermittedKey,
+			Value: []byte(strings.Join(rule.Permitted, ",")),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to set rule: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveConsentRule removes the rule of the category from the consent. It
+// needs the "invoke:consent.remove" rule.
+func (c *Client) RemoveConsentRule(id byzcoin.InstanceID, category string,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(id, contracts.ConsentContractID, contracts.ConsentRemoveAction,
+		byzcoin.Arguments{{
+			Name:  contracts.ConsentCategoryKey,
+			Value: []byte(category),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to remove rule: %v", err)
+	}
+
+	return nil
+}
+
+// SetDatasetConsent sets the consent of the cohort of the dataset. The queries
+// on the dataset are not restricted by consent anymore if consentID is nil. It
+// needs the "invoke:dataset.setConsent" rule.
+func (c *Client) SetDatasetConsent(datasetID byzcoin.InstanceID,
+	consentID *byzcoin.InstanceID, signers ...darc.Signer) error {
+
+	var args byzcoin.Arguments
+	if consentID != nil {
+		args = byzcoin.Arguments{{
+			Name:  contracts.DatasetConsentIDKey,
+			Value: consentID.Slice(),
+		}}
+	}
+
+	_, err := c.Invoke(datasetID, contracts.DatasetContractID,
+		contracts.DatasetSetConsentAction, args, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to set consent: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestClient_Consent(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:dataset", "spawn:consent", "invoke:consent.set",
+			"invoke:consent.remove", "invoke:dataset.setConsent"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.DatasetContractID,
+			Args: []byzcoin.Argument{{
+				Name:  contracts.DatasetNameKey,
+				Value: []byte("dataset"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	datasetID := ctx.Instructions[0].DeriveID("")
+
+	consentID, err := cl.SpawnConsent(gDarc.GetBaseID(), "cohort", signer)
+	require.NoError(t, err)
+
+	rules := []contracts.ConsentRule{
+		{Category: "no-genetic-research", Description: "desc", Forbidden: []string{"genetic", "dna"}},
+		{Category: "cardio-only", Permitted: []string{"q1"}},
+	}
+
+	for _, rule := range rules {
+		require.NoError(t, cl.SetConsentRule(consentID, rule, signer))
+	}
+
+	require.NoError(t, cl.RemoveConsentRule(consentID, "cardio-only", signer))
+
+	consent, err := cl.GetConsent(consentID)
+	require.NoError(t, err)
+	require.Equal(t, "cohort", consent.Cohort)
+	require.Equal(t, []*contracts.ConsentRule{&rules[0]}, consent.Rules)
+
+	require.NoError(t, cl.SetDatasetConsent(datasetID, &consentID, signer))
+
+	dataset, err := cl.GetDataset(datasetID)
+	require.NoError(t, err)
+	require.Equal(t, consentID.String(), dataset.Consent)
+
+	// a dataset is not a consent
+	require.Error(t, cl.SetDatasetConsent(datasetID, &datasetID, signer))
+
+	require.NoError(t, cl.SetDatasetConsent(datasetID, nil, signer))
+
+	dataset, err = cl.GetDataset(datasetID)
+	require.NoError(t, err)
+	require.Empty(t, dataset.Consent)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+)
+
+// GetDUA returns the data use agreement stored at the given instance ID.
+func (c *Client) GetDUA(id byzcoin.InstanceID) (*contracts.DUAContract, error) {
+	buf, err := c.getInstance(id, contracts.DUAContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get dua: %v", err)
+	}
+
+	return contracts.DecodeDUAContract(buf)
+}
+
+// GetAttestation returns the attestation of the version of the agreement by
+// the user.
+func (c *Client) GetAttestation(duaID byzcoin.InstanceID, userID string,
+	version int) (*contracts.AttestationContract, error) {
+
+	id := contracts.NewAttestationInstanceID(duaID, userID, version)
+
+	buf, err := c.getInstance(id, contracts.AttestationContractID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get attestation: %v", err)
+	}
+
+	return contracts.DecodeAttestationContract(buf)
+}
+
+// SpawnDUA spawns a data use agreement, whose first version is the document
+// with the given hex-encoded SHA-256, and returns its instance ID. It needs the
+// "spawn:dua" rule on the DARC.
+func (c *Client) SpawnDUA(darcID darc.ID, name, hash, url string,
+	signers ...darc.Signer) (byzcoin.InstanceID, error) {
+
+	ctx, err := c.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(darcID),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.DUAContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.DUANameKey,
+				Value: []byte(name),
+			}, {
+				Name:  contracts.DUAHashKey,
+				Value: []byte(hash),
+			}, {
+				Name:  contracts.DUAURLKey,
+				Value: []byte(url),
+			}},
+		},
+	}, signers...)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to spawn dua: %v", err)
+	}
+
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// PublishDUA publishes a new version of the agreement, which the users must
+// attest again. It needs the "invoke:dua.publish" rule.
+func (c *Client) PublishDUA(id byzcoin.InstanceID, hash, url string,
+	signers ...darc.Signer) error {
+
+	_, err := c.Invoke(id, contracts.DUAContractID, contracts.DUAPublishAction,
+		byzcoin.Arguments{{
+			Name:  contracts.DUAHashKey,
+			Value: []byte(hash),
+		}, {
+			Name:  contracts.DUAURLKey,
+			Value: []byte(url),
+		}}, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to publish: %v", err)
+	}
+
+	return nil
+}
+
+// AttestDUA records that the user signed the current version of the agreement,
+// identified by its hash, and returns the instance ID of the attestation. The
+// signer must be an identity registered for the user.
+func (c *Client) AttestDUA(id byzcoin.InstanceID, userID, hash string,
+	signer darc.Signer) (byzcoin.InstanceID, error) {
+
+	dua, err := c.GetDUA(id)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to get dua: %v", err)
+	}
+
+	current := dua.Current()
+	if current == nil || current.Hash != hash {
+		return byzcoin.InstanceID{}, xerrors.Errorf("hash %s is not the one of the current version", hash)
+	}
+
+	_, err = c.SendInstruction(byzcoin.Instruction{
+		InstanceID: id,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.AttestationContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.DUAUserIDKey,
+				Value: []byte(userID),
+			}, {
+				Name:  contracts.DUAHashKey,
+				Value: []byte(hash),
+			}},
+		},
+	}, signer)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to attest: %v", err)
+	}
+
+	return contracts.NewAttestationInstanceID(id, userID, current.Version), nil
+}
+
+// SetProjectDUA sets the data use agreement the users of the project must
+// attest. No attestation is required anymore if duaID is nil. It needs the
+// "invoke:project.setDUA" rule.
+func (c *Client) SetProjectDUA(projectID byzcoin.InstanceID,
+	duaID *byzcoin.InstanceID, signers ...darc.Signer) error {
+
+	var args byzcoin.Arguments
+	if duaID != nil {
+		args = byzcoin.Arguments{{
+			Name:  contracts.ProjectDUAIDKey,
+			Value: duaID.Slice(),
+		}}
+	}
+
+	_, err := c.Invoke(projectID, contracts.ProjectContractID,
+		contracts.ProjectSetDUAAction, args, signers...)
+	if err != nil {
+		return xerrors.Errorf("failed to set dua: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestClient_DUA(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	user := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:user", "spawn:dua", "invoke:dua.publish",
+			"invoke:project.add", "invoke:project.setDUA"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: []byzcoin.Argument{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("project"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	require.NoError(t, cl.RegisterUser(gDarc.GetBaseID(), "userID",
+		[]darc.Identity{user.Identity()}, signer))
+	require.NoError(t, cl.GrantQueryTerms(projectID, "userID", []string{"q1"}, signer))
+
+	v1 := sha256.Sum256([]byte("v1"))
+	v2 := sha256.Sum256([]byte("v2"))
+
+	duaID, err := cl.SpawnDUA(gDarc.GetBaseID(), "dua", hex.EncodeToString(v1[:]),
+		"https://dua.example/v1", signer)
+	require.NoError(t, err)
+
+	require.NoError(t, cl.SetProjectDUA(projectID, &duaID, signer))
+
+	project, err := cl.GetProject(projectID)
+	require.NoError(t, err)
+	require.Equal(t, duaID.String(), project.DUA)
+
+	queryID, err := cl.SpawnQuery(projectID, "userID", "1", "q1", "", user)
+	require.NoError(t, err)
+
+	query, err := cl.GetQuery(queryID)
+	require.NoError(t, err)
+	require.Equal(t, contracts.QueryRejectedStatus, query.Status)
+
+	// the admin can't attest for the user
+	_, err = cl.AttestDUA(duaID, "userID", hex.EncodeToString(v1[:]), signer)
+	require.Error(t, err)
+
+	attestationID, err := cl.AttestDUA(duaID, "userID", hex.EncodeToString(v1[:]), user)
+	require.NoError(t, err)
+
+	attestation, err := cl.GetAttestation(duaID, "userID", 1)
+	require.NoError(t, err)
+	require.Equal(t, hex.EncodeToString(v1[:]), attestation.Hash)
+
+	queryID, err = cl.SpawnQuery(projectID, "userID", "2", "q1", "", user)
+	require.NoError(t, err)
+
+	query, err = cl.GetQuery(queryID)
+	require.NoError(t, err)
+	require.Equal(t, contracts.QueryPendingStatus, query.Status)
+	require.Equal(t, attestationID.String(), query.Attestation)
+
+	require.NoError(t, cl.PublishDUA(duaID, hex.EncodeToString(v2[:]), "", signer))
+
+	dua, err := cl.GetDUA(duaID)
+	require.NoError(t, err)
+	require.Len(t, dua.Versions, 2)
+
+	// only the current version can be attested
+	_, err = cl.AttestDUA(duaID, "userID", hex.EncodeToString(v1[:]), user)
+	require.Error(t, err)
+
+	_, err = cl.GetAttestation(duaID, "userID", 2)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
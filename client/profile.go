@@ -0,0 +1,172 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"golang.org/x/xerrors"
+)
+
+// Profile is a named MedChain chain. A node can take part in several
+// consortia, each with its own ByzCoin chain and admin DARC, and the
+// operations are routed to one of them by the name of its profile.
+type Profile struct {
+	Name string
+	// Config is the path of the ByzCoin config written by bcadmin or
+	// "medchain init".
+	Config string
+	// Proxy is the address of the node running bypros. The first node of the
+	// roster is used if it is empty.
+	Proxy string `toml:",omitempty"`
+	// Signer is the identity that signs the transactions. The admin identity
+	// of the config is used if it is empty.
+	Signer string `toml:",omitempty"`
+}
+
+// Open loads the ByzCoin config of the profile and creates a client for its
+// chain.
+func (p Profile) Open() (*Client, lib.Config, error) {
+	cfg, bcl, err := lib.LoadConfig(p.Config)
+	if err != nil {
+		return nil, lib.Config{}, xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	if p.Proxy == "" {
+		return NewClient(bcl, nil), cfg, nil
+	}
+
+	for _, si := range cfg.Roster.List {
+		if si.Address.NetworkAddress() == p.Proxy || si.Address.String() == p.Proxy {
+			return NewClient(bcl, si), cfg, nil
+		}
+	}
+
+	return nil, lib.Config{}, xerrors.Errorf("proxy '%s' not found in the roster", p.Proxy)
+}
+
+// Profiles are the chains known by a user, stored in a TOML file.
+type Profiles struct {
+	// Default is the name of the profile used when none is given.
+	Default  string
+	Profiles []Profile `toml:"Profile"`
+}
+
+// LoadProfiles reads the profiles from the file. No profile is returned if the
+// file doesn't exist.
+func LoadProfiles(path string) (*Profiles, error) {
+	profiles := &Profiles{}
+
+	_, err := toml.DecodeFile(path, profiles)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode profiles: %v", err)
+	}
+
+	return profiles, nil
+}
+
+// Save writes the profiles to the file.
+func (p *Profiles) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return xerrors.Errorf("failed to create folder: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to open file: %v", err)
+	}
+
+	err = toml.NewEncoder(f).Encode(p)
+	if err != nil {
+		f.Close()
+		return xerrors.Errorf("failed to encode profiles: %v", err)
+	}
+
+	return f.Close()
+}
+
+// Get returns the profile with the given name, or the default one if the name
+// is empty.
+func (p *Profiles) Get(name string) (Profile, error) {
+	if name == "" {
+		name = p.Default
+	}
+
+	if name == "" {
+		return Profile{}, xerrors.New("no default profile")
+	}
+
+	for _, profile := range p.Profiles {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+
+	return Profile{}, xerrors.Errorf("profile '%s' not found", name)
+}
+
+// Add adds a profile. The first one becomes the default profile.
+func (p *Profiles) Add(profile Profile) error {
+	if profile.Name == "" {
+		return xerrors.New("the profile has no name")
+	}
+
+	if profile.Config == "" {
+		return xerrors.Errorf("profile '%s' has no config", profile.Name)
+	}
+
+	_, err := p.Get(profile.Name)
+	if err == nil {
+		return xerrors.Errorf("profile '%s' already exists", profile.Name)
+	}
+
+	p.Profiles = append(p.Profiles, profile)
+
+	if p.Default == "" {
+		p.Default = profile.Name
+	}
+
+	return nil
+}
+
+// Remove removes a profile. There is no default profile anymore if it was the
+// default one.
+func (p *Profiles) Remove(name string) error {
+	for i, profile := range p.Profiles {
+		if profile.Name != name {
+			continue
+		}
+
+		p.Profiles = append(p.Profiles[:i], p.Profiles[i+1:]...)
+
+		if p.Default == name {
+			p.Default = ""
+		}
+
+		return nil
+	}
+
+	return xerrors.Errorf("profile '%s' not found", name)
+}
+
+// SetDefault sets the profile used when none is given.
+func (p *Profiles) SetDefault(name string) error {
+	if name == "" {
+		return xerrors.New("the profile has no name")
+	}
+
+	_, err := p.Get(name)
+	if err != nil {
+		return err
+	}
+
+	p.Default = name
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin/bcadmin/lib"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.toml")
+
+	profiles, err := LoadProfiles(path)
+	require.NoError(t, err)
+	require.Empty(t, profiles.Profiles)
+
+	_, err = profiles.Get("")
+	require.EqualError(t, err, "no default profile")
+
+	require.NoError(t, profiles.Add(Profile{Name: "hospitals", Config: "bc-1.cfg"}))
+	require.NoError(t, profiles.Add(Profile{Name: "research", Config: "bc-2.cfg",
+		Proxy: "tls://127.0.0.1:7770", Signer: "ed25519:abc"}))
+
+	require.EqualError(t, profiles.Add(Profile{Name: "research", Config: "bc-3.cfg"}),
+		"profile 'research' already exists")
+	require.EqualError(t, profiles.Add(Profile{Name: "other"}), "profile 'other' has no config")
+
+	// the first profile is the default one
+	profile, err := profiles.Get("")
+	require.NoError(t, err)
+	require.Equal(t, "hospitals", profile.Name)
+
+	require.NoError(t, profiles.SetDefault("research"))
+	require.EqualError(t, profiles.SetDefault("unknown"), "profile 'unknown' not found")
+
+	require.NoError(t, profiles.Save(path))
+
+	profiles, err = LoadProfiles(path)
+	require.NoError(t, err)
+
+	profile, err = profiles.Get("")
+	require.NoError(t, err)
+	require.Equal(t, Profile{Name: "research", Config: "bc-2.cfg",
+		Proxy: "tls://127.0.0.1:7770", Signer: "ed25519:abc"}, profile)
+
+	require.NoError(t, profiles.Remove("research"))
+	require.EqualError(t, profiles.Remove("research"), "profile 'research' not found")
+	require.Equal(t, "", profiles.Default)
+	require.Len(t, profiles.Profiles, 1)
+}
+
+func TestProfile_Open(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	_, roster, _ := local.GenTree(2, false)
+
+	lib.ConfigPath = t.TempDir()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+
+	file, err := lib.SaveConfig(lib.Config{
+		Roster:        *roster,
+		ByzCoinID:     []byte("chain"),
+		AdminIdentity: signer.Identity(),
+	})
+	require.NoError(t, err)
+
+	cl, cfg, err := Profile{Name: "name", Config: file}.Open()
+	require.NoError(t, err)
+	require.Equal(t, signer.Identity().String(), cfg.AdminIdentity.String())
+	require.True(t, roster.List[0].Equal(cl.proxy))
+
+	cl, _, err = Profile{Config: file, Proxy: roster.List[1].Address.NetworkAddress()}.Open()
+	require.NoError(t, err)
+	require.True(t, roster.List[1].Equal(cl.proxy))
+
+	_, _, err = Profile{Config: file, Proxy: "unknown:7770"}.Open()
+	require.EqualError(t, err, "proxy 'unknown:7770' not found in the roster")
+}
@@ -0,0 +1,186 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// Instance is a contract instance read from a verified proof.
+type Instance struct {
+	ID         byzcoin.InstanceID
+	ContractID string
+	// BlockIndex is the index of the block whose state the proof is taken
+	// from.
+	BlockIndex int
+	// State is the decoded state of the MedChain contracts, or nil for other
+	// contracts.
+	State fmt.Stringer
+}
+
+func (i Instance) String() string {
+	if i.State == nil {
+		return fmt.Sprintf("- InstanceID: %s\n- ContractID: %s\n", i.ID, i.ContractID)
+	}
+
+	return fmt.Sprintf("- InstanceID: %s\n%s", i.ID, i.State)
+}
+
+// GetProof returns the proof of the instance from the genesis block to the
+// latest block, to be verified offline with VerifyProof.
+func (c *Client) GetProof(id byzcoin.InstanceID) (*byzcoin.Proof, error) {
+	resp, err := c.bcl.GetProof(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	return &resp.Proof, nil
+}
+
+// GetGenesis returns the genesis block of the chain, to be used as the trust
+// anchor of VerifyProofFromGenesis.
+func (c *Client) GetGenesis() (*skipchain.SkipBlock, error) {
+	genesis, err := skipchain.NewClient().GetSingleBlock(&c.bcl.Roster, c.bcl.ID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get genesis block: %v", err)
+	}
+
+	return genesis, nil
+}
+
+// VerifyProof verifies the proof offline. It checks that the forward links
+// from the genesis block with the given ID to the latest block of the proof are
+// signed, starting with the roster of the genesis block, and that the Merkle
+// proof matches the state trie root of the latest block. It then decodes the
+// instance proven by the proof. The caller must check that it is the expected
+// instance, as a proof of absence of an instance can prove the presence of
+// another one.
+func VerifyProof(proof *byzcoin.Proof, byzcoinID skipchain.SkipBlockID,
+	roster *onet.Roster) (*Instance, error) {
+
+	if len(proof.Links) == 0 {
+		return nil, xerrors.New("proof has no forward link")
+	}
+
+	// The first link is synthetic and provides the roster of the genesis
+	// block, it is replaced by the trusted one.
+	p := *proof
+	p.Links = append([]skipchain.ForwardLink{}, proof.Links...)
+	p.Links[0].NewRoster = roster
+
+	err := p.Verify(byzcoinID)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid proof: %v", err)
+	}
+
+	key, value, contractID, _, err := p.KeyValue()
+	if err != nil {
+		return nil, xerrors.Errorf("instance not in proof: %v", err)
+	}
+
+	if !p.InclusionProof.Match(key) {
+		return nil, xerrors.Errorf("instance %x doesn't exist", key)
+	}
+
+	instance := &Instance{
+		ID:         byzcoin.NewInstanceID(key),
+		ContractID: contractID,
+		BlockIndex: p.Latest.Index,
+	}
+
+	instance.State, err = decodeState(contractID, value)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode state: %v", err)
+	}
+
+	return instance, nil
+}
+
+// VerifyProofFromGenesis verifies the proof offline with the trusted genesis
+// block. See VerifyProof.
+func VerifyProofFromGenesis(proof *byzcoin.Proof,
+	genesis *skipchain.SkipBlock) (*Instance, error) {
+
+	if genesis.Index != 0 {
+		return nil, xerrors.Errorf("block %d is not a genesis block", genesis.Index)
+	}
+
+	return VerifyProof(proof, genesis.CalculateHash(), genesis.Roster)
+}
+
+// decodeState decodes the state of the MedChain contracts.
+func decodeState(contractID string, value []byte) (fmt.Stringer, error) {
+	switch contractID {
+	case contracts.ProjectContractID:
+		return contracts.DecodeProjectContract(value)
+	case contracts.QueryContractID:
+		return contracts.DecodeQueryContract(value)
+	case contracts.DatasetContractID:
+		return contracts.DecodeDatasetContract(value)
+	case contracts.CatalogContractID:
+		return contracts.DecodeCatalogContract(value)
+	case contracts.ConsentContractID:
+		return contracts.DecodeConsentContract(value)
+	case contracts.DUAContractID:
+		return contracts.DecodeDUAContract(value)
+	case contracts.AttestationContractID:
+		return contracts.DecodeAttestationContract(value)
+	case contracts.UserContractID:
+		return contracts.DecodeUserContract(value)
+	default:
+		return nil, nil
+	}
+}
+
+// EncodeProof serializes a proof, to be stored in a file.
+func EncodeProof(proof *byzcoin.Proof) ([]byte, error) {
+	buf, err := protobuf.Encode(proof)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode proof: %v", err)
+	}
+
+	return buf, nil
+}
+
+// DecodeProof deserializes a proof created with EncodeProof.
+func DecodeProof(buf []byte) (*byzcoin.Proof, error) {
+	var proof byzcoin.Proof
+
+	err := protobuf.DecodeWithConstructors(buf, &proof,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode proof: %v", err)
+	}
+
+	return &proof, nil
+}
+
+// EncodeGenesis serializes a genesis block, to be stored in a file.
+func EncodeGenesis(genesis *skipchain.SkipBlock) ([]byte, error) {
+	buf, err := protobuf.Encode(genesis)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode block: %v", err)
+	}
+
+	return buf, nil
+}
+
+// DecodeGenesis deserializes a genesis block created with EncodeGenesis.
+func DecodeGenesis(buf []byte) (*skipchain.SkipBlock, error) {
+	var genesis skipchain.SkipBlock
+
+	err := protobuf.DecodeWithConstructors(buf, &genesis,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode block: %v", err)
+	}
+
+	return &genesis, nil
+}
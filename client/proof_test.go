@@ -0,0 +1,107 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestVerifyProof(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	_, otherRoster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	proof, err := cl.GetProof(projectID)
+	require.NoError(t, err)
+
+	genesis, err := cl.GetGenesis()
+	require.NoError(t, err)
+
+	// the proof and the genesis block go through files
+	buf, err := EncodeProof(proof)
+	require.NoError(t, err)
+
+	proof, err = DecodeProof(buf)
+	require.NoError(t, err)
+
+	buf, err = EncodeGenesis(genesis)
+	require.NoError(t, err)
+
+	genesis, err = DecodeGenesis(buf)
+	require.NoError(t, err)
+
+	instance, err := VerifyProofFromGenesis(proof, genesis)
+	require.NoError(t, err)
+	require.Equal(t, projectID, instance.ID)
+	require.Equal(t, contracts.ProjectContractID, instance.ContractID)
+	require.Equal(t, proof.Latest.Index, instance.BlockIndex)
+	require.Equal(t, "name", instance.State.(*contracts.ProjectContract).Name)
+
+	instance, err = VerifyProof(proof, bcl.ID, roster)
+	require.NoError(t, err)
+	require.Equal(t, projectID, instance.ID)
+
+	_, err = VerifyProof(proof, bcl.ID, otherRoster)
+	require.Error(t, err)
+
+	_, err = VerifyProofFromGenesis(proof, &proof.Latest)
+	require.Error(t, err)
+
+	// the DARC is not a MedChain contract
+	proof, err = cl.GetProof(byzcoin.NewInstanceID(gDarc.GetBaseID()))
+	require.NoError(t, err)
+
+	instance, err = VerifyProofFromGenesis(proof, genesis)
+	require.NoError(t, err)
+	require.Equal(t, byzcoin.ContractDarcID, instance.ContractID)
+	require.Nil(t, instance.State)
+
+	// A proof of absence doesn't prove the state of the requested instance. It
+	// either proves nothing, or the state of the instance found at its place.
+	unknownID := contracts.NewUserInstanceID("unknown")
+
+	proof, err = cl.GetProof(unknownID)
+	require.NoError(t, err)
+
+	instance, err = VerifyProofFromGenesis(proof, genesis)
+	if err == nil {
+		require.NotEqual(t, unknownID, instance.ID)
+	}
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
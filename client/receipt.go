@@ -0,0 +1,130 @@
+package client
+
+import (
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// Receipt is a portable proof that a query is stored on the chain with a given
+// status. It contains the ByzCoin proof of the query instance, made of the
+// Merkle proof of the instance in the state trie and of the forward links,
+// collectively signed by the roster, from the genesis block to the block
+// holding the state. It can therefore be verified offline by anyone trusting
+// the roster of the genesis block.
+type Receipt struct {
+	// ByzCoinID is the ID of the genesis block of the chain.
+	ByzCoinID skipchain.SkipBlockID
+	// InstanceID is the instance ID of the query.
+	InstanceID byzcoin.InstanceID
+	// BlockIndex is the index of the block whose state the proof is taken
+	// from.
+	BlockIndex int
+	// Status is the status of the query in this block.
+	Status string
+	Proof  byzcoin.Proof
+}
+
+// QueryReceipt returns a receipt for the query, taken from the latest block.
+func (c *Client) QueryReceipt(id byzcoin.InstanceID) (*Receipt, error) {
+	resp, err := c.bcl.GetProof(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	receipt := &Receipt{
+		ByzCoinID:  c.bcl.ID,
+		InstanceID: id,
+		BlockIndex: resp.Proof.Latest.Index,
+		Proof:      resp.Proof,
+	}
+
+	query, err := receipt.Query()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read query: %v", err)
+	}
+
+	receipt.Status = query.Status
+
+	return receipt, nil
+}
+
+// Query decodes the query stored in the proof of the receipt. It doesn't
+// verify the receipt.
+func (r Receipt) Query() (*contracts.QueryContract, error) {
+	buf, contractID, _, err := r.Proof.Get(r.InstanceID.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("instance not in proof: %v", err)
+	}
+
+	if contractID != contracts.QueryContractID {
+		return nil, xerrors.Errorf("instance is not a query: %s", contractID)
+	}
+
+	return contracts.DecodeQueryContract(buf)
+}
+
+// Verify checks that the receipt comes from the chain with the given ID and
+// that its proof is signed by the roster, which is the roster of the genesis
+// block. Rosters changes that happened later on the chain are followed with the
+// forward links. It also checks that the proof is for the query of the receipt
+// and matches its status. It doesn't need any network access.
+func (r Receipt) Verify(byzcoinID skipchain.SkipBlockID, roster *onet.Roster) error {
+	if !r.ByzCoinID.Equal(byzcoinID) {
+		return xerrors.Errorf("receipt is for chain %x, not %x", r.ByzCoinID, byzcoinID)
+	}
+
+	instance, err := VerifyProof(&r.Proof, byzcoinID, roster)
+	if err != nil {
+		return xerrors.Errorf("failed to verify proof: %v", err)
+	}
+
+	if !instance.ID.Equal(r.InstanceID) {
+		return xerrors.Errorf("proof is for instance %s, not %s", instance.ID,
+			r.InstanceID)
+	}
+
+	if instance.BlockIndex != r.BlockIndex {
+		return xerrors.Errorf("proof is for block %d, not %d", instance.BlockIndex,
+			r.BlockIndex)
+	}
+
+	query, err := r.Query()
+	if err != nil {
+		return xerrors.Errorf("failed to read query: %v", err)
+	}
+
+	if query.Status != r.Status {
+		return xerrors.Errorf("query status is '%s', not '%s'", query.Status, r.Status)
+	}
+
+	return nil
+}
+
+// EncodeReceipt serializes the receipt, to be stored in a file.
+func EncodeReceipt(r *Receipt) ([]byte, error) {
+	buf, err := protobuf.Encode(r)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode receipt: %v", err)
+	}
+
+	return buf, nil
+}
+
+// DecodeReceipt deserializes a receipt created with EncodeReceipt.
+func DecodeReceipt(buf []byte) (*Receipt, error) {
+	var r Receipt
+
+	err := protobuf.DecodeWithConstructors(buf, &r,
+		network.DefaultConstructors(cothority.Suite))
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode receipt: %v", err)
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+func TestClient_QueryReceipt(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+	_, otherRoster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:user"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	err = cl.RegisterUser(gDarc.GetBaseID(), "userID", []darc.Identity{signer.Identity()}, signer)
+	require.NoError(t, err)
+
+	queryID, err := cl.SpawnQuery(projectID, "userID", "queryID", "queryDef", "", signer)
+	require.NoError(t, err)
+
+	receipt, err := cl.QueryReceipt(queryID)
+	require.NoError(t, err)
+	require.Equal(t, contracts.QueryRejectedStatus, receipt.Status)
+	require.NotZero(t, receipt.BlockIndex)
+
+	buf, err := EncodeReceipt(receipt)
+	require.NoError(t, err)
+
+	receipt, err = DecodeReceipt(buf)
+	require.NoError(t, err)
+
+	require.NoError(t, receipt.Verify(bcl.ID, roster))
+
+	query, err := receipt.Query()
+	require.NoError(t, err)
+	require.Equal(t, "queryDef", query.QueryDefinition)
+
+	// the proof is not signed by this roster
+	require.Error(t, receipt.Verify(bcl.ID, otherRoster))
+
+	require.Error(t, receipt.Verify(projectID.Slice(), roster))
+
+	receipt.Status = contracts.QueryPendingStatus
+	require.EqualError(t, receipt.Verify(bcl.ID, roster),
+		"query status is 'rejected', not 'pending'")
+
+	// a project instance can't be used as a receipt
+	receipt.InstanceID = projectID
+	require.Error(t, receipt.Verify(bcl.ID, roster))
+
+	_, err = cl.QueryReceipt(projectID)
+	require.Error(t, err)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"encoding/binary"
+	"regexp"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/darc/expression"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// UpdateNode replaces the node of the roster of the chain that has the same
+// public key as the given one, for example to rotate its service keys. The
+// signer needs the "invoke:config.update_config" rule of the genesis DARC.
+// The node must be restarted with its new keys once the update is included.
+func (c *Client) UpdateNode(si *network.ServerIdentity, signer darc.Signer) error {
+	config, err := c.bcl.GetChainConfig()
+	if err != nil {
+		return xerrors.Errorf("failed to get chain config: %v", err)
+	}
+
+	i, old := config.Roster.Search(si.ID)
+	if i < 0 {
+		return xerrors.Errorf("node %s is not in the roster", si.Address)
+	}
+
+	if old.Equal(si) && sameServiceKeys(old, si) {
+		return xerrors.Errorf("node %s is already up to date", si.Address)
+	}
+
+	list := make([]*network.ServerIdentity, len(config.Roster.List))
+	copy(list, config.Roster.List)
+	list[i] = si
+
+	config.Roster = *onet.NewRoster(list)
+
+	buf, err := protobuf.Encode(config)
+	if err != nil {
+		return xerrors.Errorf("failed to encode config: %v", err)
+	}
+
+	_, err = c.Invoke(byzcoin.ConfigInstanceID, byzcoin.ContractConfigID, "update_config",
+		byzcoin.Arguments{{Name: "config", Value: buf}}, signer)
+	if err != nil {
+		return xerrors.Errorf("failed to update config: %v", err)
+	}
+
+	return nil
+}
+
+func sameServiceKeys(a, b *network.ServerIdentity) bool {
+	if len(a.ServiceIdentities) != len(b.ServiceIdentities) {
+		return false
+	}
+
+	for i, sid := range a.ServiceIdentities {
+		other := b.ServiceIdentities[i]
+		if sid.Name != other.Name || !sid.Public.Equal(other.Public) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetDarc returns the latest version of the DARC.
+func (c *Client) GetDarc(id darc.ID) (*darc.Darc, error) {
+	buf, err := c.getInstance(byzcoin.NewInstanceID(id), byzcoin.ContractDarcID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get instance: %v", err)
+	}
+
+	d, err := darc.NewFromProtobuf(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode darc: %v", err)
+	}
+
+	return d, nil
+}
+
+// ReplaceIdentity returns the evolution of the DARC where the old identity is
+// replaced by the replacement in every rule, so that the thresholds are kept.
+func ReplaceIdentity(d *darc.Darc, old, replacement darc.Identity) (*darc.Darc, error) {
+	oldRe := identityRegexp(old)
+
+	if identityRegexp(replacement).MatchString(rulesString(d)) {
+		return nil, xerrors.Errorf("identity %s is already in the DARC", replacement)
+	}
+
+	evolved := d.Copy()
+	evolved.Rules = darc.NewRules()
+
+	found := false
+
+	for _, rule := range d.Rules.List {
+		expr := string(rule.Expr)
+		if oldRe.MatchString(expr) {
+			found = true
+			expr = oldRe.ReplaceAllString(expr, "${1}"+replacement.String()+"${2}")
+		}
+
+		err := evolved.Rules.AddRule(rule.Action, expression.Expr(expr))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to add rule %s: %v", rule.Action, err)
+		}
+	}
+
+	if !found {
+		return nil, xerrors.Errorf("identity %s is not in the DARC", old)
+	}
+
+	err := evolved.EvolveFrom(d)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to evolve darc: %v", err)
+	}
+
+	return evolved, nil
+}
+
+// identityRegexp matches the identity as a whole term of an expression.
+func identityRegexp(identity darc.Identity) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[\s()&|])` + regexp.QuoteMeta(identity.String()) +
+		`($|[\s()&|])`)
+}
+
+func rulesString(d *darc.Darc) string {
+	var s string
+	for _, rule := range d.Rules.List {
+		s += string(rule.Expr) + "\n"
+	}
+
+	return s
+}
+
+// ProposeEvolution proposes the evolution of the DARC with a deferred
+// transaction, which the identities of the DARC sign until they reach its
+// evolution threshold. The proposer needs the "spawn:deferred" rule on the
+// DARC. It returns the instance ID of the deferred transaction.
+func (c *Client) ProposeEvolution(evolved *darc.Darc, proposer darc.Signer) (byzcoin.InstanceID, error) {
+	buf, err := protobuf.Encode(evolved)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to encode darc: %v", err)
+	}
+
+	proposed := byzcoin.ClientTransaction{
+		Instructions: byzcoin.Instructions{{
+			InstanceID: byzcoin.NewInstanceID(evolved.GetBaseID()),
+			Invoke: &byzcoin.Invoke{
+				ContractID: byzcoin.ContractDarcID,
+				Command:    "evolve",
+				Args:       byzcoin.Arguments{{Name: "darc", Value: buf}},
+			},
+		}},
+	}
+
+	proposedBuf, err := protobuf.Encode(&proposed)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to encode transaction: %v", err)
+	}
+
+	ctx, err := c.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(evolved.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: byzcoin.ContractDeferredID,
+			Args: byzcoin.Arguments{{
+				Name:  "proposedTransaction",
+				Value: proposedBuf,
+			}},
+		},
+	}, proposer)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to spawn deferred: %v", err)
+	}
+
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// GetDeferred returns the deferred transaction.
+func (c *Client) GetDeferred(id byzcoin.InstanceID) (*byzcoin.DeferredData, error) {
+	buf, err := c.getInstance(id, byzcoin.ContractDeferredID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get instance: %v", err)
+	}
+
+	var data byzcoin.DeferredData
+
+	err = protobuf.Decode(buf, &data)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode deferred: %v", err)
+	}
+
+	return &data, nil
+}
+
+// SignDeferred adds the signature of the signer to every instruction of the
+// deferred transaction.
+func (c *Client) SignDeferred(id byzcoin.InstanceID, signer darc.Signer) error {
+	data, err := c.GetDeferred(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get deferred: %v", err)
+	}
+
+	identity := signer.Identity()
+
+	identityBuf, err := protobuf.Encode(&identity)
+	if err != nil {
+		return xerrors.Errorf("failed to encode identity: %v", err)
+	}
+
+	for i, hash := range data.InstructionHashes {
+		for _, signed := range data.ProposedTransaction.Instructions[i].SignerIdentities {
+			if signed.Equal(&identity) {
+				return xerrors.Errorf("%s already signed", identity)
+			}
+		}
+
+		signature, err := signer.Sign(hash)
+		if err != nil {
+			return xerrors.Errorf("failed to sign: %v", err)
+		}
+
+		index := make([]byte, 4)
+		binary.LittleEndian.PutUint32(index, uint32(i))
+
+		_, err = c.Invoke(id, byzcoin.ContractDeferredID, "addProof", byzcoin.Arguments{
+			{Name: "identity", Value: identityBuf},
+			{Name: "signature", Value: signature},
+			{Name: "index", Value: index},
+		}, signer)
+		if err != nil {
+			return xerrors.Errorf("failed to add proof: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ExecDeferred executes the deferred transaction, which fails if it doesn't
+// have enough signatures.
+func (c *Client) ExecDeferred(id byzcoin.InstanceID, signer darc.Signer) error {
+	_, err := c.Invoke(id, byzcoin.ContractDeferredID, "execProposedTx", nil, signer)
+	if err != nil {
+		return xerrors.Errorf("failed to execute: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/kyber/v3/util/key"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/network"
+)
+
+func TestClient_ReplaceAdminIdentity(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	owner := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		nil, owner.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	admins := []darc.Signer{
+		darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil),
+		darc.NewSignerEd25519(nil, nil),
+	}
+
+	identities := make([]darc.Identity, len(admins))
+	for i, admin := range admins {
+		identities[i] = admin.Identity()
+	}
+
+	adminDarc, err := NewAdminDarc(identities, 2, "admin")
+	require.NoError(t, err)
+
+	require.NoError(t, cl.SpawnDarc(gDarc.GetBaseID(), adminDarc, owner))
+
+	newAdmin := darc.NewSignerEd25519(nil, nil)
+
+	_, err = ReplaceIdentity(adminDarc, newAdmin.Identity(), admins[0].Identity())
+	require.EqualError(t, err, "identity "+admins[0].Identity().String()+
+		" is already in the DARC")
+
+	_, err = ReplaceIdentity(adminDarc, owner.Identity(), newAdmin.Identity())
+	require.EqualError(t, err, "identity "+owner.Identity().String()+" is not in the DARC")
+
+	evolved, err := ReplaceIdentity(adminDarc, admins[2].Identity(), newAdmin.Identity())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), evolved.Version)
+	require.Equal(t, adminDarc.Rules.Count(), evolved.Rules.Count())
+
+	deferredID, err := cl.ProposeEvolution(evolved, admins[0])
+	require.NoError(t, err)
+
+	require.NoError(t, cl.SignDeferred(deferredID, admins[0]))
+	require.Error(t, cl.SignDeferred(deferredID, admins[0]))
+
+	// the threshold is not reached
+	require.Error(t, cl.ExecDeferred(deferredID, admins[0]))
+
+	require.NoError(t, cl.SignDeferred(deferredID, admins[1]))
+	require.NoError(t, cl.ExecDeferred(deferredID, admins[1]))
+
+	latest, err := cl.GetDarc(adminDarc.GetBaseID())
+	require.NoError(t, err)
+	require.Equal(t, evolved.GetID(), latest.GetID())
+
+	spawnProject := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(adminDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}
+
+	// the old admin is not allowed anymore
+	_, err = cl.SendInstruction(spawnProject, admins[0], admins[2])
+	require.Error(t, err)
+
+	_, err = cl.SendInstruction(spawnProject, admins[0], newAdmin)
+	require.NoError(t, err)
+}
+
+func TestClient_UpdateNode(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	owner := darc.NewSignerEd25519(nil, nil)
+
+	// one node can be out of date and the chain continues
+	_, roster, _ := local.GenTree(4, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		nil, owner.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := NewClient(bcl, nil)
+
+	node := *roster.List[3]
+	node.ServiceIdentities = nil
+
+	for _, sid := range roster.List[3].ServiceIdentities {
+		suite := suites.MustFind(sid.Suite)
+		kp := key.NewKeyPair(suite)
+
+		node.ServiceIdentities = append(node.ServiceIdentities,
+			network.NewServiceIdentity(sid.Name, suite, kp.Public, nil))
+	}
+
+	require.NoError(t, cl.UpdateNode(&node, owner))
+
+	config, err := bcl.GetChainConfig()
+	require.NoError(t, err)
+	require.True(t, sameServiceKeys(&node, config.Roster.List[3]))
+	require.False(t, sameServiceKeys(roster.List[3], config.Roster.List[3]))
+
+	require.EqualError(t, cl.UpdateNode(&node, owner),
+		"node "+node.Address.String()+" is already up to date")
+
+	unknown := network.NewServerIdentity(key.NewKeyPair(cothority.Suite).Public, node.Address)
+	require.Error(t, cl.UpdateNode(unknown, owner))
+
+	d := darc.NewDarc(darc.InitRules([]darc.Identity{owner.Identity()}, nil), []byte("after"))
+	require.NoError(t, cl.SpawnDarc(gDarc.GetBaseID(), d, owner))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	status "go.dedis.ch/cothority/v3/status/service"
+	"go.dedis.ch/onet/v3/network"
+)
+
+// nodeStatus is the result of the check of a node.
+type nodeStatus struct {
+	Address     string `json:"address"`
+	Description string `json:"description"`
+	OK          bool   `json:"ok"`
+	Version     string `json:"version,omitempty"`
+	Uptime      string `json:"uptime,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+func newNodeStatus(si *network.ServerIdentity, reply *status.Response) nodeStatus {
+	res := nodeStatus{
+		Address:     si.Address.String(),
+		Description: si.Description,
+		OK:          true,
+	}
+
+	if conode, found := reply.Status["Conode"]; found {
+		res.Version = conode.Field["version"]
+	}
+
+	if generic, found := reply.Status["Generic"]; found {
+		res.Uptime = generic.Field["Uptime"]
+	}
+
+	return res
+}
+
+// printNodeStatus writes the results either as a table or in JSON.
+func printNodeStatus(w io.Writer, results []nodeStatus, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "ADDRESS\tDESCRIPTION\tSTATUS\tVERSION\tUPTIME")
+
+	for _, res := range results {
+		state := "ok"
+		if !res.OK {
+			state = "error: " + res.Error
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Address, res.Description, state,
+			res.Version, res.Uptime)
+	}
+
+	return tw.Flush()
+}
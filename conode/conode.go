@@ -21,9 +21,12 @@ import (
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"time"
 
 	_ "github.com/ldsec/medchain/contracts"
+	"github.com/ldsec/medchain/indexer"
+	"github.com/ldsec/medchain/logging"
 	"go.dedis.ch/cothority/v3"
 	_ "go.dedis.ch/cothority/v3/bypros"
 	_ "go.dedis.ch/cothority/v3/byzcoin"
@@ -84,13 +87,55 @@ func main() {
 					Usage: "the description to use",
 					Value: "configured in non-interactive mode",
 				},
+				cli.StringFlag{
+					Name:  "public",
+					Usage: "the address other nodes use to reach this one (host:port), writes public.toml",
+				},
+				cli.BoolFlag{
+					Name:  "encrypt",
+					Usage: "encrypt private.toml with a passphrase, see 'conode encrypt'",
+				},
 			},
 		},
+		rosterCommand,
+		rotateKeysCommand,
+		encryptCommand,
+		decryptCommand,
 		{
 			Name:   "server",
 			Usage:  "Start cothority server",
 			Action: runServer,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "indexer",
+					Usage:  "index the chain in the given SQLite database instead of PostgreSQL",
+					EnvVar: "MEDCHAIN_INDEXER_DB",
+				},
+				cli.StringFlag{
+					Name:   "metrics",
+					Usage:  "expose the Prometheus metrics over HTTP at the given address, e.g. :9100",
+					EnvVar: "MEDCHAIN_METRICS",
+				},
+				cli.StringFlag{
+					Name:   "health",
+					Usage:  "expose /healthz and /readyz over HTTP at the given address, e.g. :9100",
+					EnvVar: "MEDCHAIN_HEALTH",
+				},
+				cli.DurationFlag{
+					Name:   "max-block-age",
+					Usage:  "the node is not ready if the last block of a chain is older, 0 to disable",
+					EnvVar: "MEDCHAIN_MAX_BLOCK_AGE",
+				},
+				cli.StringFlag{
+					Name:   "log-format",
+					Value:  "text",
+					Usage:  "the format of the logs, text or json",
+					EnvVar: "MEDCHAIN_LOG_FORMAT",
+				},
+			},
 		},
+		migrateCommand,
+		doctorCommand,
 		{
 			Name:      "check",
 			Aliases:   []string{"c"},
@@ -107,6 +152,11 @@ func main() {
 					Value: 10,
 					Usage: "Set a different timeout in seconds",
 				},
+				cli.StringFlag{
+					Name:  "format, f",
+					Value: "table",
+					Usage: "the output format of the report, table or json",
+				},
 			},
 		},
 	}
@@ -153,12 +203,56 @@ func runServer(ctx *cli.Context) error {
 	if raiseFdLimit != nil {
 		raiseFdLimit()
 	}
-	app.RunServer(config)
+	// the configuration is decrypted once, and only in memory
+	conf, _, err := loadCothority(config)
+	if err != nil {
+		return err
+	}
+	switch ctx.String("log-format") {
+	case "text":
+	case "json":
+		logging.EnableJSON(os.Stdout, ctx.GlobalInt("debug"), conf.Address.String())
+	default:
+		return fmt.Errorf("unknown log format: %s", ctx.String("log-format"))
+	}
+	if ctx.String("indexer") != "" {
+		err = indexer.Register(ctx.String("indexer"))
+		if err != nil {
+			return err
+		}
+	} else {
+		err = checkSchema()
+		if err != nil {
+			return err
+		}
+	}
+	servers := httpServers{}
+	if ctx.String("metrics") != "" {
+		err := servers.serveMetrics(ctx.String("metrics"))
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.String("health") != "" {
+		err := servers.serveHealth(ctx.String("health"), ctx.Duration("max-block-age"))
+		if err != nil {
+			return err
+		}
+	}
+	err = servers.serve()
+	if err != nil {
+		return err
+	}
+	server, err := newServer(conf)
+	if err != nil {
+		return err
+	}
+	server.Start()
 	return nil
 }
 
-// checkConfig contacts all servers and verifies if it receives a valid
-// signature from each.
+// checkConfig contacts all servers and reports the status of each. It fails
+// once the report is printed if a server didn't answer.
 func checkConfig(c *cli.Context) error {
 	tomlFileName := c.String("g")
 	if c.NArg() > 0 {
@@ -168,6 +262,11 @@ func checkConfig(c *cli.Context) error {
 		log.Fatal("[-] Must give the roster file to check.")
 	}
 
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unknown format: %s", format)
+	}
+
 	f, err := os.Open(tomlFileName)
 	if err != nil {
 		return err
@@ -181,36 +280,69 @@ func checkConfig(c *cli.Context) error {
 	}
 
 	ro := grp.Roster
-	replies := make(chan *status.Response)
-	errs := make(chan error)
+	type indexed struct {
+		index  int
+		status nodeStatus
+	}
+	replies := make(chan indexed, len(ro.List))
 
 	// send a status request to everyone
-	for _, si := range ro.List {
-		go func(srvid *network.ServerIdentity) {
+	for i, si := range ro.List {
+		go func(i int, srvid *network.ServerIdentity) {
 			reply, err := client.Request(srvid)
 			if err != nil {
-				errs <- err
-			} else {
-				replies <- reply
+				replies <- indexed{i, nodeStatus{
+					Address:     srvid.Address.String(),
+					Description: srvid.Description,
+					Error:       err.Error(),
+				}}
+				return
 			}
-		}(si)
+
+			replies <- indexed{i, newNodeStatus(srvid, reply)}
+		}(i, si)
+	}
+
+	received := make([]nodeStatus, len(ro.List))
+	for i, si := range ro.List {
+		received[i] = nodeStatus{
+			Address:     si.Address.String(),
+			Description: si.Description,
+			Error:       "no response in time",
+		}
 	}
 
 	counter := 0
 	timeout := time.After(time.Duration(c.Int("timeout")) * time.Second)
 
 	// ... and wait for the responses
+wait:
 	for counter < len(ro.List) {
 		select {
-		case <-replies:
+		case reply := <-replies:
+			received[reply.index] = reply.status
 			counter++
-		case err := <-errs:
-			return err
 		case <-timeout:
-			return errors.New("didn't get all the responses in time")
+			break wait
+		}
+	}
+
+	err = printNodeStatus(os.Stdout, received, format)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, res := range received {
+		if !res.OK {
+			failed++
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%d of %d nodes failed", failed, len(received))
+	}
+
 	return nil
 }
 
@@ -235,26 +367,53 @@ func setup(c *cli.Context) error {
 			Services:    app.GenerateServiceKeyPairs(),
 		}
 
+		// Without a public address, the roster (i.e. public IP addresses +
+		// public keys) is expected to be generated elsewhere, for example
+		// based on how Kubernetes does service discovery. The binding
+		// address would be an invalid public address.
+		var public network.Address
+
+		if c.String("public") != "" {
+			public = network.Address(c.String("public"))
+			if !strings.Contains(c.String("public"), "://") {
+				public = network.NewAddress(network.TLS, c.String("public"))
+			}
+
+			if !public.Valid() {
+				return fmt.Errorf("invalid public address: %s", c.String("public"))
+			}
+
+			// the node announces its public address, and listens on the
+			// binding one
+			conf.Address = public
+			conf.ListenAddress = net.JoinHostPort(host, portStr)
+		}
+
 		out := c.GlobalString("config")
-		err := conf.Save(out)
-		if err == nil {
-			fmt.Fprintf(os.Stderr, "Wrote config file to %v\n", out)
+		err := saveCothority(conf, out, c.Bool("encrypt"))
+		if err != nil {
+			return err
 		}
 
-		// We are not going to write out the public.toml file here.
-		// We don't because in the current use case for --non-interactive, which
-		// is for containers to auto-generate configs on startup, the
-		// roster (i.e. public IP addresses + public keys) will be generated
-		// based on how Kubernetes does service discovery. Writing the public.toml
-		// file based on the data we have here, would result in writing an invalid
-		// public Address.
+		fmt.Fprintf(os.Stderr, "Wrote config file to %v\n", out)
 
-		// If we had written it, it would look like this:
-		//  server := app.NewServerToml(cothority.Suite, kp.Public, conf.Address, conf.Description)
-		//  group := app.NewGroupToml(server)
-		//  group.Save(path.Join(dir, "public.toml"))
+		if public == "" {
+			return nil
+		}
 
-		return err
+		server := app.NewServerToml(cothority.Suite, kp.Public, public,
+			conf.Description, conf.Services)
+		group := app.NewGroupToml(server)
+
+		groupFile := path.Join(path.Dir(out), app.DefaultGroupFile)
+		err = group.Save(groupFile)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Wrote public file to %v\n", groupFile)
+
+		return nil
 	}
 
 	app.InteractiveConfig(cothority.Suite, DefaultName)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ldsec/medchain/health"
+	"github.com/ldsec/medchain/metrics"
+	"github.com/ldsec/medchain/metrics/collector"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// httpServers are the HTTP servers started beside the conode, by address. The
+// endpoints given the same address share the server.
+type httpServers map[string]*http.ServeMux
+
+func (s httpServers) handle(addr, pattern string, handler http.Handler) {
+	mux, found := s[addr]
+	if !found {
+		mux = http.NewServeMux()
+		s[addr] = mux
+	}
+
+	mux.Handle(pattern, handler)
+
+	log.Lvlf1("serving %s on %s", pattern, addr)
+}
+
+// serve starts the servers. It listens before returning so that a wrong
+// address prevents the conode to start.
+func (s httpServers) serve() error {
+	for addr, mux := range s {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return xerrors.Errorf("failed to listen on %s: %v", addr, err)
+		}
+
+		go func(mux *http.ServeMux) {
+			err := http.Serve(listener, mux)
+			log.Errorf("HTTP server stopped: %v", err)
+		}(mux)
+	}
+
+	return nil
+}
+
+// serveMetrics registers the collector of the metrics and exposes them on
+// /metrics. It must be called before the conode is started.
+func (s httpServers) serveMetrics(addr string) error {
+	err := collector.Register()
+	if err != nil {
+		return xerrors.Errorf("failed to register collector: %v", err)
+	}
+
+	s.handle(addr, "/metrics", metrics.DefaultRegistry)
+
+	return nil
+}
+
+// serveHealth registers the health service and exposes the liveness on
+// /healthz and the readiness on /readyz. It must be called before the conode
+// is started.
+func (s httpServers) serveHealth(addr string, maxBlockAge time.Duration) error {
+	err := health.Register(maxBlockAge)
+	if err != nil {
+		return xerrors.Errorf("failed to register health: %v", err)
+	}
+
+	handler := health.Handler()
+
+	s.handle(addr, "/healthz", handler)
+	s.handle(addr, "/readyz", handler)
+
+	return nil
+}
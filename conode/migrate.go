@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ldsec/medchain/bypros/migrations"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// dbURLEnv is the variable read by bypros for its read/write connection.
+const dbURLEnv = "PROXY_DB_URL"
+
+// dbURLROEnv is the variable read by bypros for its read-only connection, used
+// for the queries of the clients.
+const dbURLROEnv = "PROXY_DB_URL_RO"
+
+var migrateCommand = cli.Command{
+	Name:  "migrate",
+	Usage: "apply the pending migrations to the ByzCoin proxy database",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:   "db",
+			EnvVar: dbURLEnv,
+			Usage:  "the URL of the database, with read/write access",
+		},
+		cli.BoolFlag{
+			Name:  "status",
+			Usage: "only print the version of the database and the pending migrations",
+		},
+	},
+	Action: migrate,
+}
+
+func migrate(c *cli.Context) error {
+	if c.String("db") == "" {
+		return xerrors.Errorf("please provide the database URL with --db or %s", dbURLEnv)
+	}
+
+	runner, err := migrations.NewRunner(c.String("db"))
+	if err != nil {
+		return xerrors.Errorf("failed to create runner: %v", err)
+	}
+
+	defer runner.Close()
+
+	if c.Bool("status") {
+		version, err := runner.Check()
+		if err != nil {
+			return xerrors.Errorf("failed to check version: %v", err)
+		}
+
+		fmt.Fprintf(c.App.Writer, "database at version %d, binary at version %d\n",
+			version, migrations.Latest())
+
+		pending, err := runner.Pending()
+		if err != nil {
+			return xerrors.Errorf("failed to get pending migrations: %v", err)
+		}
+
+		for _, m := range pending {
+			fmt.Fprintf(c.App.Writer, "pending: %d %s\n", m.Version, m.Name)
+		}
+
+		return nil
+	}
+
+	applied, err := runner.Up()
+	for _, m := range applied {
+		fmt.Fprintf(c.App.Writer, "applied: %d %s\n", m.Version, m.Name)
+	}
+
+	if err != nil {
+		return xerrors.Errorf("failed to migrate: %v", err)
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintf(c.App.Writer, "database is up to date at version %d\n",
+			migrations.Latest())
+	}
+
+	return nil
+}
+
+// checkSchema refuses to run with a proxy database whose schema is ahead of
+// the binary, and warns if it is behind. Nothing is checked if the proxy is
+// not configured.
+func checkSchema() error {
+	dbURL := os.Getenv(dbURLEnv)
+	if dbURL == "" {
+		return nil
+	}
+
+	runner, err := migrations.NewRunner(dbURL)
+	if err != nil {
+		return xerrors.Errorf("failed to create runner: %v", err)
+	}
+
+	defer runner.Close()
+
+	version, err := runner.Check()
+	if err != nil {
+		return xerrors.Errorf("failed to check database: %v", err)
+	}
+
+	if version < migrations.Latest() {
+		log.Warnf("database at version %d, run 'conode migrate' to upgrade it "+
+			"to version %d", version, migrations.Latest())
+	}
+
+	return nil
+}
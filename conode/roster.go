@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"go.dedis.ch/onet/v3/app"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var rosterCommand = cli.Command{
+	Name:      "roster",
+	Usage:     "merge the public.toml files of several nodes into a roster",
+	ArgsUsage: "public.toml files of the nodes",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "the file to write the roster to, instead of stdout",
+		},
+	},
+	Action: roster,
+}
+
+func roster(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return xerrors.New("please provide the public.toml files of the nodes")
+	}
+
+	group, err := mergeGroups(c.Args()...)
+	if err != nil {
+		return xerrors.Errorf("failed to merge: %v", err)
+	}
+
+	if c.String("output") == "" {
+		fmt.Fprint(c.App.Writer, group.String())
+		return nil
+	}
+
+	err = group.Save(c.String("output"))
+	if err != nil {
+		return xerrors.Errorf("failed to save roster: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote roster with %d nodes to %v\n",
+		len(group.Servers), c.String("output"))
+
+	return nil
+}
+
+// mergeGroups reads the servers of the given group files, in order. It
+// refuses servers that are invalid or that appear twice, with the same public
+// key or address.
+func mergeGroups(files ...string) (*app.GroupToml, error) {
+	group := app.NewGroupToml()
+
+	publics := make(map[string]string)
+	addresses := make(map[string]string)
+
+	for _, file := range files {
+		part := &app.GroupToml{}
+
+		_, err := toml.DecodeFile(file, part)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read %s: %v", file, err)
+		}
+
+		if len(part.Servers) == 0 {
+			return nil, xerrors.Errorf("no server in %s", file)
+		}
+
+		for _, server := range part.Servers {
+			// Backwards compatibility with old group files, as in
+			// app.ReadGroupDescToml.
+			if server.Suite == "" {
+				server.Suite = "Ed25519"
+			}
+
+			_, err = server.ToServerIdentity()
+			if err != nil {
+				return nil, xerrors.Errorf("invalid server %s in %s: %v",
+					server.Address, file, err)
+			}
+
+			if !server.Address.Valid() {
+				return nil, xerrors.Errorf("invalid address %s in %s",
+					server.Address, file)
+			}
+
+			other, found := publics[server.Public]
+			if found {
+				return nil, xerrors.Errorf("public key of %s in %s already in %s",
+					server.Address, file, other)
+			}
+
+			other, found = addresses[server.Address.String()]
+			if found {
+				return nil, xerrors.Errorf("address %s in %s already in %s",
+					server.Address, file, other)
+			}
+
+			publics[server.Public] = file
+			addresses[server.Address.String()] = file
+
+			group.Servers = append(group.Servers, server)
+		}
+	}
+
+	return group, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/kyber/v3/util/encoding"
+	"go.dedis.ch/onet/v3/app"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+// rotatedSuffix is added to the files written by rotate-keys, so that the
+// running node keeps its keys until the roster of the chain is updated.
+const rotatedSuffix = ".new"
+
+var rotateKeysCommand = cli.Command{
+	Name:  "rotate-keys",
+	Usage: "generate new service key pairs, keeping the identity of the node",
+	Description: "Writes private.toml.new and public.toml.new next to the configuration. " +
+		"Once 'medchain node update public.toml.new' is included in the chain, " +
+		"replace the files and restart the node.",
+	Action: rotateKeys,
+}
+
+func rotateKeys(c *cli.Context) error {
+	file := c.GlobalString("config")
+
+	conf, encrypted, err := loadCothority(file)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	public, err := encoding.StringHexToPoint(cothority.Suite, conf.Public)
+	if err != nil {
+		return xerrors.Errorf("failed to decode public key: %v", err)
+	}
+
+	conf.Services = app.GenerateServiceKeyPairs()
+
+	out := file + rotatedSuffix
+
+	// the new keys are as protected as the current ones
+	err = saveCothority(conf, out, encrypted)
+	if err != nil {
+		return xerrors.Errorf("failed to save config: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote config file to %v\n", out)
+
+	server := app.NewServerToml(cothority.Suite, public, conf.Address, conf.Description,
+		conf.Services)
+
+	groupFile := path.Join(path.Dir(file), app.DefaultGroupFile+rotatedSuffix)
+
+	err = app.NewGroupToml(server).Save(groupFile)
+	if err != nil {
+		return xerrors.Errorf("failed to save public file: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote public file to %v\n", groupFile)
+
+	return nil
+}
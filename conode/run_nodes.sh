@@ -74,6 +74,7 @@ if [ "$flush" ]; then
 fi
 
 rm -f public.toml
+publics=""
 mkdir -p log
 touch running
 for n in $( seq $nbr_nodes -1 1 ); do
@@ -100,11 +101,13 @@ for n in $( seq $nbr_nodes -1 1 ); do
       sleep 1
     done
   ) &
-  cat $co/public.toml >> public.toml
+  publics="$publics $co/public.toml"
   # Wait for LOG to be initialized
   sleep 1
 done
 
+$CONODE_BIN roster -o public.toml $publics
+
 trap ctrl_c INT
 
 function ctrl_c() {
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/medchain/secrets"
+	"go.dedis.ch/kyber/v3/suites"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/app"
+	"golang.org/x/xerrors"
+	cli "gopkg.in/urfave/cli.v1"
+)
+
+var encryptCommand = cli.Command{
+	Name:  "encrypt",
+	Usage: "encrypt the configuration of the server with a passphrase",
+	Description: "The passphrase is read from MEDCHAIN_PASSPHRASE, from the file given by " +
+		"MEDCHAIN_PASSPHRASE_FILE, or asked on the terminal.",
+	Action: func(c *cli.Context) error {
+		return convertCothority(c.GlobalString("config"), true)
+	},
+}
+
+var decryptCommand = cli.Command{
+	Name:  "decrypt",
+	Usage: "decrypt the configuration of the server",
+	Action: func(c *cli.Context) error {
+		return convertCothority(c.GlobalString("config"), false)
+	},
+}
+
+// convertCothority encrypts or decrypts the configuration in place.
+func convertCothority(file string, encrypt bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return xerrors.Errorf("failed to read config: %v", err)
+	}
+
+	if encrypt && secrets.IsEncrypted(data) {
+		return xerrors.Errorf("%s is already encrypted", file)
+	}
+
+	if !encrypt && !secrets.IsEncrypted(data) {
+		return xerrors.Errorf("%s is not encrypted", file)
+	}
+
+	conf, _, err := loadCothority(file)
+	if err != nil {
+		return xerrors.Errorf("failed to load config: %v", err)
+	}
+
+	err = saveCothority(conf, file, encrypt)
+	if err != nil {
+		return xerrors.Errorf("failed to save config: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote config file to %v\n", file)
+
+	return nil
+}
+
+// loadCothority is app.LoadCothority for configurations that may be
+// encrypted. It also returns whether the configuration is encrypted.
+func loadCothority(file string) (*app.CothorityConfig, bool, error) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false, xerrors.Errorf("failed to read config: %v", err)
+	}
+
+	encrypted := secrets.IsEncrypted(raw)
+
+	data, err := secrets.ReadFile(file)
+	if err != nil {
+		return nil, false, err
+	}
+
+	conf := &app.CothorityConfig{}
+
+	_, err = toml.Decode(string(data), conf)
+	if err != nil {
+		return nil, false, xerrors.Errorf("failed to decode config: %v", err)
+	}
+
+	// same default as app.LoadCothority for the old configurations
+	if conf.Suite == "" {
+		conf.Suite = "Ed25519"
+	}
+
+	return conf, encrypted, nil
+}
+
+// saveCothority is app.CothorityConfig.Save with an optional encryption.
+func saveCothority(conf *app.CothorityConfig, file string, encrypt bool) error {
+	buf := new(bytes.Buffer)
+
+	buf.WriteString("# This file contains your private key.\n")
+	buf.WriteString("# Do not give it away lightly!\n")
+
+	err := toml.NewEncoder(buf).Encode(conf)
+	if err != nil {
+		return xerrors.Errorf("failed to encode config: %v", err)
+	}
+
+	return secrets.WriteFile(file, buf.Bytes(), 0600, encrypt)
+}
+
+// newServer is app.ParseCothority for a configuration loaded with
+// loadCothority, so that the decrypted keys never touch the disk.
+func newServer(conf *app.CothorityConfig) (*onet.Server, error) {
+	suite, err := suites.Find(conf.Suite)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to find suite: %v", err)
+	}
+
+	si, err := conf.GetServerIdentity()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to parse server identity: %v", err)
+	}
+
+	server := onet.NewServerTCPWithListenAddr(si, suite, conf.ListenAddress)
+
+	if conf.WebSocketTLSCertificate == "" || conf.WebSocketTLSCertificateKey == "" {
+		return server, nil
+	}
+
+	tlsConfig, err := websocketTLS(conf.WebSocketTLSCertificate, conf.WebSocketTLSCertificateKey)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load certificate: %v", err)
+	}
+
+	server.WebSocket.Lock()
+	server.WebSocket.TLSConfig = tlsConfig
+	server.WebSocket.Unlock()
+
+	return server, nil
+}
+
+// websocketTLS returns the TLS configuration of the websocket, reloading the
+// certificate when both are files like app.ParseCothority does.
+func websocketTLS(cert, key app.CertificateURL) (*tls.Config, error) {
+	if cert.CertificateURLType() == app.File && key.CertificateURLType() == app.File {
+		cr, err := onet.NewCertificateReloader(certificatePath(cert), certificatePath(key))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to create reloader: %v", err)
+		}
+
+		return &tls.Config{GetCertificate: cr.GetCertificateFunc()}, nil
+	}
+
+	certContent, err := cert.Content()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get certificate: %v", err)
+	}
+
+	keyContent, err := key.Content()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get certificate key: %v", err)
+	}
+
+	pair, err := tls.X509KeyPair(certContent, keyContent)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to load key pair: %v", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{pair}}, nil
+}
+
+// certificatePath returns the path of a file certificate URL, with or without
+// the file:// prefix.
+func certificatePath(url app.CertificateURL) string {
+	parts := strings.SplitN(string(url), "://", 2)
+	return parts[len(parts)-1]
+}
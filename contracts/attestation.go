@@ -0,0 +1,137 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// AttestationContractID is the name of the attestation Contract.
+//
+// An attestation records that a user signed a version of a data use agreement.
+// Attestations are spawned by the DUA contract, which checks that the user
+// attests the current version.
+const AttestationContractID = "attestation"
+
+// AttestationVersion is the current version of the attestation contract format.
+//
+//   - 1: first version
+const AttestationVersion = 1
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(AttestationContractID, attestationContractFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+// attestationContractFromBytes unmarshals a contract
+func attestationContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeAttestationContract(in)
+}
+
+// DecodeAttestationContract decodes the state of an attestation instance.
+// States stored with an older version are upgraded to the latest version.
+func DecodeAttestationContract(in []byte) (*AttestationContract, error) {
+	// ByzCoin uses an empty instance to spawn new instances
+	if len(in) == 0 {
+		return &AttestationContract{}, nil
+	}
+
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version == 0 || version > AttestationVersion {
+		return nil, xerrors.Errorf("unknown attestation version: %d", version)
+	}
+
+	var c AttestationContract
+
+	err = protobuf.Decode(data, &c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode attestation: %v", err)
+	}
+
+	return &c, nil
+}
+
+// NewAttestationInstanceID returns the instance ID of the attestation of the
+// version of the agreement by the user. Attestations are stored at a
+// deterministic location so that a project can find the attestation of the
+// user who spawns a query.
+func NewAttestationInstanceID(duaID byzcoin.InstanceID, userID string, version int) byzcoin.InstanceID {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(version))
+
+	h := sha256.New()
+	h.Write([]byte(AttestationContractID))
+	h.Write(duaID.Slice())
+	h.Write(buf)
+	h.Write([]byte(userID))
+
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// AttestationContract is a contract that records the signature of a data use
+// agreement by a user.
+//
+// - implements byzcoin.Contract
+type AttestationContract struct {
+	byzcoin.BasicContract
+
+	// DUAID is the hex-encoded instance ID of the agreement.
+	DUAID  string
+	UserID string
+	// Version is the version of the agreement the user attested.
+	Version int
+	// Hash is the hash of the attested version.
+	Hash string
+	// Index is the index of the block in which the user attested.
+	Index int
+}
+
+// Spawn implements byzcoin.Contract
+func (c AttestationContract) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("spawn must be done via the dua contract")
+}
+
+// Invoke implements byzcoin.Contract
+func (c AttestationContract) Invoke(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("invoke not allowed in attestation contract")
+}
+
+// Delete implements byzcoin.Contract
+func (c AttestationContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("delete not allowed in attestation contract")
+}
+
+// encode encodes the attestation with the latest version.
+func (c AttestationContract) encode() ([]byte, error) {
+	return encodeVersioned(AttestationVersion, &c)
+}
+
+func (c AttestationContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- Attestation")
+	fmt.Fprintf(out, "-- DUAID: %s\n", c.DUAID)
+	fmt.Fprintf(out, "-- UserID: %s\n", c.UserID)
+	fmt.Fprintf(out, "-- Version: %d\n", c.Version)
+	fmt.Fprintf(out, "-- Hash: %s\n", c.Hash)
+	fmt.Fprintf(out, "-- Index: %d\n", c.Index)
+
+	return out.String()
+}
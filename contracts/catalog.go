@@ -0,0 +1,310 @@
+package contracts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// CatalogContractID is the name of the catalog Contract.
+//
+// The catalog contract lists the valid query terms, with a human readable
+// label and the code of the term in an ontology. A catalog can be used by a
+// single project or shared by the projects of a consortium. Authorizations on
+// a project using a catalog can only be granted on terms of the catalog.
+const CatalogContractID = "catalog"
+
+const (
+	CatalogNameKey        = "name"
+	CatalogDescriptionKey = "description"
+	CatalogTermKey        = "term"
+	CatalogLabelKey       = "label"
+	CatalogCodeKey        = "code"
+
+	CatalogAddAction    = "add"
+	CatalogRemoveAction = "remove"
+)
+
+// CatalogVersion is the current version of the catalog contract format.
+//
+//   - 1: first version
+const CatalogVersion = 1
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(CatalogContractID, catalogContractFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+// catalogContractFromBytes unmarshals a contract
+func catalogContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeCatalogContract(in)
+}
+
+// DecodeCatalogContract decodes the state of a catalog instance. States stored
+// with an older version are upgraded to the latest version.
+func DecodeCatalogContract(in []byte) (*CatalogContract, error) {
+	// ByzCoin uses an empty instance to spawn new instances
+	if len(in) == 0 {
+		return &CatalogContract{}, nil
+	}
+
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version == 0 || version > CatalogVersion {
+		return nil, xerrors.Errorf("unknown catalog version: %d", version)
+	}
+
+	var c CatalogContract
+
+	err = protobuf.Decode(data, &c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode catalog: %v", err)
+	}
+
+	return &c, nil
+}
+
+// CatalogContract is a smart contract that lists the valid query terms.
+//
+// - implements byzcoin.Contract
+type CatalogContract struct {
+	byzcoin.BasicContract
+
+	Name        string
+	Description string
+	Terms       []*CatalogTerm
+}
+
+// CatalogTerm is a query term of a catalog.
+type CatalogTerm struct {
+	// Term is the query term used in the authorizations and the query
+	// definitions.
+	Term string
+	// Label is the human readable name of the term.
+	Label string
+	// Code is the code of the term in an ontology, prefixed by the ontology,
+	// for example "SNOMED-CT:38341003".
+	Code string
+}
+
+// VerifyDeferredInstruction implements byzcoin.Contract.
+func (c CatalogContract) VerifyDeferredInstruction(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, ctxHash []byte) error {
+
+	opts := &byzcoin.VerificationOptions{IgnoreCounters: true}
+	return inst.VerifyWithOption(rst, ctxHash, opts)
+}
+
+// Spawn implements byzcoin.Contract.
+func (c CatalogContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(CatalogContractID, inst, time.Now())
+
+	var darcID darc.ID
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	args := inst.Spawn.Args
+
+	state := CatalogContract{
+		Name:        string(args.Search(CatalogNameKey)),
+		Description: string(args.Search(CatalogDescriptionKey)),
+		Terms:       make([]*CatalogTerm, 0),
+	}
+
+	buf, err := state.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), CatalogContractID,
+		buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Invoke implements byzcoin.Contract.
+func (c CatalogContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(CatalogContractID, inst, time.Now())
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	args := inst.Arguments()
+	term := strings.TrimSpace(string(args.Search(CatalogTermKey)))
+
+	switch inst.Invoke.Command {
+	case CatalogAddAction:
+		err = c.addTerm(CatalogTerm{
+			Term:  term,
+			Label: string(args.Search(CatalogLabelKey)),
+			Code:  string(args.Search(CatalogCodeKey)),
+		})
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to add term: %v", err)
+		}
+	case CatalogRemoveAction:
+		c.removeTerm(term)
+	case MigrateAction:
+		// the state is already upgraded by the decoder, we only need to store
+		// it back with the latest version.
+	default:
+		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
+	}
+
+	buf, err := c.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to marshal catalog: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		CatalogContractID, buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Delete implements byzcoin.Contract
+func (c CatalogContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("delete not allowed in catalog contract")
+}
+
+// Find returns the term of the catalog, or nil if it is not in the catalog.
+func (c CatalogContract) Find(term string) *CatalogTerm {
+	for _, t := range c.Terms {
+		if t.Term == term {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// Search returns the terms whose term, label or code contains the text,
+// ignoring the case. All the terms are returned if the text is empty.
+func (c CatalogContract) Search(text string) []*CatalogTerm {
+	text = strings.ToLower(text)
+
+	var found []*CatalogTerm
+
+	for _, t := range c.Terms {
+		if strings.Contains(strings.ToLower(t.Term), text) ||
+			strings.Contains(strings.ToLower(t.Label), text) ||
+			strings.Contains(strings.ToLower(t.Code), text) {
+
+			found = append(found, t)
+		}
+	}
+
+	return found
+}
+
+// encode encodes the catalog with the latest version.
+func (c CatalogContract) encode() ([]byte, error) {
+	return encodeVersioned(CatalogVersion, &c)
+}
+
+func (c CatalogContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- Catalog")
+	fmt.Fprintf(out, "-- Name: %s\n", c.Name)
+	fmt.Fprintf(out, "-- Description: %s\n", c.Description)
+	fmt.Fprintln(out, "-- Terms:")
+
+	for _, t := range c.Terms {
+		fmt.Fprintf(out, "--- %s\n", t)
+	}
+
+	return out.String()
+}
+
+// addTerm adds the term to the catalog, or updates its label and code if it is
+// already in the catalog.
+func (c *CatalogContract) addTerm(term CatalogTerm) error {
+	if term.Term == "" {
+		return xerrors.New("the term is empty")
+	}
+
+	// terms are given as coma separated lists in the authorizations
+	if strings.Contains(term.Term, ",") {
+		return xerrors.Errorf("the term '%s' contains a coma", term.Term)
+	}
+
+	existing := c.Find(term.Term)
+	if existing != nil {
+		*existing = term
+		return nil
+	}
+
+	c.Terms = append(c.Terms, &term)
+
+	return nil
+}
+
+func (c *CatalogContract) removeTerm(term string) {
+	for i, t := range c.Terms {
+		if t.Term == term {
+			c.Terms = append(c.Terms[:i], c.Terms[i+1:]...)
+			return
+		}
+	}
+}
+
+// String produces a text representation of a term.
+func (t CatalogTerm) String() string {
+	out := t.Term
+
+	if t.Label != "" {
+		out += " - " + t.Label
+	}
+
+	if t.Code != "" {
+		out += " (" + t.Code + ")"
+	}
+
+	return out
+}
+
+// getCatalog reads and decodes the catalog stored at the hex-encoded instance
+// ID.
+func getCatalog(rst byzcoin.ReadOnlyStateTrie, catalogID string) (*CatalogContract, error) {
+	id, err := ParseInstanceID(catalogID)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid catalog ID: %v", err)
+	}
+
+	buf, _, contractID, _, err := rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get catalog %s: %v", catalogID, err)
+	}
+
+	if contractID != CatalogContractID {
+		return nil, xerrors.Errorf("instance %s is not a catalog: %s", catalogID, contractID)
+	}
+
+	catalog, err := DecodeCatalogContract(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode catalog: %v", err)
+	}
+
+	return catalog, nil
+}
@@ -0,0 +1,136 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+func TestCatalog_Spawn_Invoke(t *testing.T) {
+	l := newTestLedger(t, "spawn:catalog", "invoke:catalog.add", "invoke:catalog.remove")
+
+	catalogInstID := addCatalog(l)
+
+	require.NoError(t, l.send(
+		catalogInstruction(catalogInstID, CatalogAddAction, "q1", "old", ""),
+		catalogInstruction(catalogInstID, CatalogAddAction, "q2", "Diabetes", "SNOMED-CT:73211009"),
+		catalogInstruction(catalogInstID, CatalogAddAction, "q3", "Age", "LOINC:30525-0"),
+		// the label and code of a term are updated
+		catalogInstruction(catalogInstID, CatalogAddAction, "q1", "Hypertension", "SNOMED-CT:38341003"),
+		catalogInstruction(catalogInstID, CatalogRemoveAction, "q3", "", ""),
+	))
+
+	// the terms can't contain a coma, as they are listed with comas
+	require.Error(t, l.send(
+		catalogInstruction(catalogInstID, CatalogAddAction, "q4,q5", "", "")))
+
+	catalog := getCatalogState(t, l.cl, catalogInstID)
+
+	require.Equal(t, "catalog", catalog.Name)
+	require.Equal(t, []*CatalogTerm{
+		{Term: "q1", Label: "Hypertension", Code: "SNOMED-CT:38341003"},
+		{Term: "q2", Label: "Diabetes", Code: "SNOMED-CT:73211009"},
+	}, catalog.Terms)
+}
+
+func TestCatalog_Search(t *testing.T) {
+	catalog := CatalogContract{
+		Terms: []*CatalogTerm{
+			{Term: "q1", Label: "Hypertension", Code: "SNOMED-CT:38341003"},
+			{Term: "q2", Label: "Diabetes", Code: "SNOMED-CT:73211009"},
+			{Term: "q3", Label: "Age", Code: "LOINC:30525-0"},
+		},
+	}
+
+	require.Equal(t, catalog.Terms, catalog.Search(""))
+	require.Equal(t, catalog.Terms[1:2], catalog.Search("diab"))
+	require.Equal(t, catalog.Terms[:2], catalog.Search("snomed"))
+	require.Equal(t, catalog.Terms[2:], catalog.Search("q3"))
+	require.Empty(t, catalog.Search("unknown"))
+
+	require.Equal(t, catalog.Terms[0], catalog.Find("q1"))
+	require.Nil(t, catalog.Find("Hypertension"))
+}
+
+// A project with a catalog only grants the terms of the catalog.
+func TestCatalog_Project_Add(t *testing.T) {
+	l := newTestLedger(t, "spawn:project", "spawn:catalog", "invoke:catalog.add",
+		"invoke:project.add", "invoke:project.setCatalog")
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
+
+	catalogInstID := addCatalog(l)
+
+	setCatalog := func(catalogID []byte) byzcoin.Instruction {
+		return invokeInstruction(projectInstID, ProjectContractID, ProjectSetCatalogAction,
+			byzcoin.Arguments{{Name: ProjectCatalogIDKey, Value: catalogID}})
+	}
+
+	// any term can be granted without a catalog
+	require.NoError(t, l.send(grantInstruction(projectInstID, "free")))
+
+	// only catalogs can be set
+	require.Error(t, l.send(setCatalog(projectInstID.Slice())))
+
+	require.NoError(t, l.send(
+		catalogInstruction(catalogInstID, CatalogAddAction, "q1", "", ""),
+		catalogInstruction(catalogInstID, CatalogAddAction, "q2", "", ""),
+		setCatalog(catalogInstID.Slice()),
+	))
+
+	require.NoError(t, l.send(grantInstruction(projectInstID, "q1, q2")))
+
+	// the whole instruction is refused if one of the terms is unknown
+	require.Error(t, l.send(grantInstruction(projectInstID, "q1,typo")))
+
+	project := getProjectState(t, l.cl, projectInstID)
+	require.Equal(t, catalogInstID.String(), project.Catalog)
+	require.Equal(t, []string{"free", "q1", "q2"}, project.Authorizations.Find("userID").QueryTerms)
+
+	// without the catalog, any term can be granted again
+	require.NoError(t, l.send(setCatalog(nil)))
+	require.NoError(t, l.send(grantInstruction(projectInstID, "typo")))
+
+	project = getProjectState(t, l.cl, projectInstID)
+	require.Empty(t, project.Catalog)
+	require.Equal(t, []string{"free", "q1", "q2", "typo"},
+		project.Authorizations.Find("userID").QueryTerms)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func addCatalog(l *testLedger) byzcoin.InstanceID {
+	return l.spawn(CatalogContractID, byzcoin.Arguments{{
+		Name:  CatalogNameKey,
+		Value: []byte("catalog"),
+	}})
+}
+
+func catalogInstruction(instID byzcoin.InstanceID, command, term, label,
+	code string) byzcoin.Instruction {
+
+	return invokeInstruction(instID, CatalogContractID, command, byzcoin.Arguments{{
+		Name:  CatalogTermKey,
+		Value: []byte(term),
+	}, {
+		Name:  CatalogLabelKey,
+		Value: []byte(label),
+	}, {
+		Name:  CatalogCodeKey,
+		Value: []byte(code),
+	}})
+}
+
+func getCatalogState(t *testing.T, cl *byzcoin.Client, instID byzcoin.InstanceID) *CatalogContract {
+	resp, err := cl.GetProofFromLatest(instID.Slice())
+	require.NoError(t, err)
+
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	catalog, err := DecodeCatalogContract(val)
+	require.NoError(t, err)
+
+	return catalog
+}
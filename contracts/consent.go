@@ -0,0 +1,332 @@
+package contracts
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ConsentContractID is the name of the consent Contract.
+//
+// The consent contract records the consent given by the patients of the cohort
+// of a dataset. The consent is expressed by categories, like "no genetic
+// research", each mapped to the query terms it forbids or permits. A query is
+// only authorized on a dataset if every consent rule of the dataset allows it.
+const ConsentContractID = "consent"
+
+const (
+	ConsentCohortKey      = "cohort"
+	ConsentCategoryKey    = "category"
+	ConsentDescriptionKey = "description"
+	ConsentForbiddenKey   = "forbidden"
+	ConsentPermittedKey   = "permitted"
+
+	ConsentSetAction    = "set"
+	ConsentRemoveAction = "remove"
+)
+
+// ConsentVersion is the current version of the consent contract format.
+//
+//   - 1: first version
+const ConsentVersion = 1
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(ConsentContractID, consentContractFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+// consentContractFromBytes unmarshals a contract
+func consentContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeConsentContract(in)
+}
+
+// DecodeConsentContract decodes the state of a consent instance. States stored
+// with an older version are upgraded to the latest version.
+func DecodeConsentContract(in []byte) (*ConsentContract, error) {
+	// ByzCoin uses an empty instance to spawn new instances
+	if len(in) == 0 {
+		return &ConsentContract{}, nil
+	}
+
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version == 0 || version > ConsentVersion {
+		return nil, xerrors.Errorf("unknown consent version: %d", version)
+	}
+
+	var c ConsentContract
+
+	err = protobuf.Decode(data, &c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode consent: %v", err)
+	}
+
+	return &c, nil
+}
+
+// ConsentContract is a smart contract that defines the consent rules of the
+// cohort of a dataset.
+//
+// - implements byzcoin.Contract
+type ConsentContract struct {
+	byzcoin.BasicContract
+
+	// Cohort describes the patients who gave the consent.
+	Cohort string
+	Rules  []*ConsentRule
+}
+
+// ConsentRule is a consent category and the query terms it forbids or
+// permits.
+type ConsentRule struct {
+	// Category identifies the rule, for example "no-genetic-research".
+	Category    string
+	Description string
+	// Forbidden are the query terms the category forbids.
+	Forbidden []string
+	// Permitted are the only query terms the category permits, if any.
+	Permitted []string
+}
+
+// VerifyDeferredInstruction implements byzcoin.Contract.
+func (c ConsentContract) VerifyDeferredInstruction(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, ctxHash []byte) error {
+
+	opts := &byzcoin.VerificationOptions{IgnoreCounters: true}
+	return inst.VerifyWithOption(rst, ctxHash, opts)
+}
+
+// Spawn implements byzcoin.Contract.
+func (c ConsentContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(ConsentContractID, inst, time.Now())
+
+	var darcID darc.ID
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	state := ConsentContract{
+		Cohort: string(inst.Spawn.Args.Search(ConsentCohortKey)),
+		Rules:  make([]*ConsentRule, 0),
+	}
+
+	buf, err := state.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), ConsentContractID,
+		buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Invoke implements byzcoin.Contract.
+func (c ConsentContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(ConsentContractID, inst, time.Now())
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	args := inst.Arguments()
+	category := strings.TrimSpace(string(args.Search(ConsentCategoryKey)))
+
+	switch inst.Invoke.Command {
+	case ConsentSetAction:
+		// the forbidden and permitted terms are coma separated lists
+		err = c.setRule(ConsentRule{
+			Category:    category,
+			Description: string(args.Search(ConsentDescriptionKey)),
+			Forbidden:   splitTerms(string(args.Search(ConsentForbiddenKey))),
+			Permitted:   splitTerms(string(args.Search(ConsentPermittedKey))),
+		})
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to set rule: %v", err)
+		}
+	case ConsentRemoveAction:
+		c.removeRule(category)
+	case MigrateAction:
+		// the state is already upgraded by the decoder, we only need to store
+		// it back with the latest version.
+	default:
+		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
+	}
+
+	buf, err := c.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to marshal consent: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		ConsentContractID, buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Delete implements byzcoin.Contract
+func (c ConsentContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("delete not allowed in consent contract")
+}
+
+// Refusing returns the first rule that doesn't allow the query definition, or
+// nil if every rule allows it.
+func (c ConsentContract) Refusing(queryDefinition string) *ConsentRule {
+	for _, rule := range c.Rules {
+		if !rule.Allows(queryDefinition) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// Find returns the rule of the category, or nil if not found.
+func (c ConsentContract) Find(category string) *ConsentRule {
+	for _, rule := range c.Rules {
+		if rule.Category == category {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// encode encodes the consent with the latest version.
+func (c ConsentContract) encode() ([]byte, error) {
+	return encodeVersioned(ConsentVersion, &c)
+}
+
+func (c ConsentContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- Consent")
+	fmt.Fprintf(out, "-- Cohort: %s\n", c.Cohort)
+
+	for i, rule := range c.Rules {
+		fmt.Fprintf(out, "-- rule %d:\n%s", i, rule)
+	}
+
+	return out.String()
+}
+
+// setRule adds the rule, or replaces the rule of the same category.
+func (c *ConsentContract) setRule(rule ConsentRule) error {
+	if rule.Category == "" {
+		return xerrors.New("the category is empty")
+	}
+
+	if len(rule.Forbidden) == 0 && len(rule.Permitted) == 0 {
+		return xerrors.Errorf("category %s neither forbids nor permits terms", rule.Category)
+	}
+
+	existing := c.Find(rule.Category)
+	if existing != nil {
+		*existing = rule
+		return nil
+	}
+
+	c.Rules = append(c.Rules, &rule)
+
+	return nil
+}
+
+func (c *ConsentContract) removeRule(category string) {
+	for i, rule := range c.Rules {
+		if rule.Category == category {
+			c.Rules = append(c.Rules[:i], c.Rules[i+1:]...)
+			return
+		}
+	}
+}
+
+// Allows tells if the rule allows the query definition: it must not be
+// forbidden, and it must be permitted if the rule only permits some terms.
+func (r ConsentRule) Allows(queryDefinition string) bool {
+	for _, term := range r.Forbidden {
+		if term == queryDefinition {
+			return false
+		}
+	}
+
+	if len(r.Permitted) == 0 {
+		return true
+	}
+
+	for _, term := range r.Permitted {
+		if term == queryDefinition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String produces a text representation of a rule.
+func (r ConsentRule) String() string {
+	out := new(strings.Builder)
+
+	fmt.Fprintf(out, "- Category: %s\n", r.Category)
+	fmt.Fprintf(out, "- Description: %s\n", r.Description)
+	fmt.Fprintf(out, "- Forbidden: %v\n", r.Forbidden)
+	fmt.Fprintf(out, "- Permitted: %v\n", r.Permitted)
+
+	return out.String()
+}
+
+// splitTerms splits a coma separated list of terms: term1, term2, ...
+func splitTerms(terms string) []string {
+	var res []string
+
+	for _, term := range strings.Split(terms, ",") {
+		term = strings.TrimSpace(term)
+		if term != "" {
+			res = append(res, term)
+		}
+	}
+
+	return res
+}
+
+// getConsent reads and decodes the consent stored at the hex-encoded instance
+// ID.
+func getConsent(rst byzcoin.ReadOnlyStateTrie, consentID string) (*ConsentContract, error) {
+	id, err := ParseInstanceID(consentID)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid consent ID: %v", err)
+	}
+
+	buf, _, contractID, _, err := rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get consent %s: %v", consentID, err)
+	}
+
+	if contractID != ConsentContractID {
+		return nil, xerrors.Errorf("instance %s is not a consent: %s", consentID, contractID)
+	}
+
+	consent, err := DecodeConsentContract(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode consent: %v", err)
+	}
+
+	return consent, nil
+}
@@ -0,0 +1,153 @@
+package contracts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+func TestConsentRule_Allows(t *testing.T) {
+	rule := ConsentRule{Forbidden: []string{"genetic"}}
+	require.True(t, rule.Allows("q1"))
+	require.False(t, rule.Allows("genetic"))
+
+	rule = ConsentRule{Permitted: []string{"q1", "genetic"}}
+	require.True(t, rule.Allows("q1"))
+	require.False(t, rule.Allows("q2"))
+
+	// a forbidden term is refused even if it is permitted
+	rule = ConsentRule{Forbidden: []string{"genetic"}, Permitted: []string{"q1", "genetic"}}
+	require.False(t, rule.Allows("genetic"))
+
+	consent := ConsentContract{Rules: []*ConsentRule{
+		{Category: "no-genetic-research", Forbidden: []string{"genetic"}},
+		{Category: "cardio-only", Permitted: []string{"q1", "genetic"}},
+	}}
+
+	require.Nil(t, consent.Refusing("q1"))
+	require.Equal(t, consent.Rules[0], consent.Refusing("genetic"))
+	require.Equal(t, consent.Rules[1], consent.Refusing("q2"))
+}
+
+func TestConsent_Spawn_Invoke(t *testing.T) {
+	l := newTestLedger(t, "spawn:consent", "invoke:consent.set", "invoke:consent.remove")
+
+	consentInstID := addConsent(l)
+
+	require.NoError(t, l.send(
+		consentInstruction(consentInstID, ConsentSetAction, "no-genetic-research", "genetic, q3", ""),
+		consentInstruction(consentInstID, ConsentSetAction, "cardio-only", "", "q1"),
+		// the terms of a category are replaced
+		consentInstruction(consentInstID, ConsentSetAction, "no-genetic-research", "genetic", ""),
+		consentInstruction(consentInstID, ConsentSetAction, "other", "q4", ""),
+		consentInstruction(consentInstID, ConsentRemoveAction, "other", "", ""),
+	))
+
+	// a category must forbid or permit terms
+	require.Error(t, l.send(
+		consentInstruction(consentInstID, ConsentSetAction, "empty", "", "")))
+
+	resp, err := l.cl.GetProofFromLatest(consentInstID.Slice())
+	require.NoError(t, err)
+
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	consent, err := DecodeConsentContract(val)
+	require.NoError(t, err)
+
+	require.Equal(t, "cohort", consent.Cohort)
+	require.Equal(t, []*ConsentRule{
+		{Category: "no-genetic-research", Forbidden: []string{"genetic"}},
+		{Category: "cardio-only", Permitted: []string{"q1"}},
+	}, consent.Rules)
+}
+
+// A dataset doesn't allow a query refused by a rule of its consent, and the
+// rule is recorded on the query.
+func TestConsent_Query_Authorization(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project", "spawn:dataset", "spawn:consent",
+		"invoke:consent.set", "invoke:dataset.setConsent", "invoke:project.add",
+		"invoke:project.addDataset")
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
+
+	_, err = addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
+
+	restrictedInstID, err := addDataset(l, "q1,q2,genetic", "")
+	require.NoError(t, err)
+
+	otherInstID, err := addDataset(l, "q1", "")
+	require.NoError(t, err)
+
+	consentInstID := addConsent(l)
+
+	setConsent := func(consentID []byte) byzcoin.Instruction {
+		return invokeInstruction(restrictedInstID, DatasetContractID, DatasetSetConsentAction,
+			byzcoin.Arguments{{Name: DatasetConsentIDKey, Value: consentID}})
+	}
+
+	// only consents can be set
+	require.Error(t, l.send(setConsent(projectInstID.Slice())))
+
+	require.NoError(t, l.send(
+		consentInstruction(consentInstID, ConsentSetAction, "no-genetic-research", "genetic", ""),
+		consentInstruction(consentInstID, ConsentSetAction, "cardio-only", "", "q1,genetic"),
+		setConsent(consentInstID.Slice()),
+		addDatasetInstruction(projectInstID, restrictedInstID),
+		addDatasetInstruction(projectInstID, otherInstID),
+		grantInstruction(projectInstID, "q1,q2,genetic"),
+	))
+
+	query := l.spawnQuery(projectInstID, "1", "q1")
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Equal(t, []string{restrictedInstID.String(), otherInstID.String()}, query.Datasets)
+	require.Empty(t, query.ConsentRefusals)
+
+	query = l.spawnQuery(projectInstID, "2", "genetic")
+	require.Equal(t, QueryRejectedStatus, query.Status)
+	require.Empty(t, query.Datasets)
+	require.Equal(t, ConsentRefusals{{
+		DatasetID: restrictedInstID.String(),
+		ConsentID: consentInstID.String(),
+		Category:  "no-genetic-research",
+	}}, query.ConsentRefusals)
+
+	query = l.spawnQuery(projectInstID, "3", "q2")
+	require.Equal(t, QueryRejectedStatus, query.Status)
+	require.Equal(t, "cardio-only", query.ConsentRefusals[0].Category)
+
+	// without the consent, the dataset allows the query again
+	require.NoError(t, l.send(setConsent(nil)))
+
+	query = l.spawnQuery(projectInstID, "4", "genetic")
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Equal(t, []string{restrictedInstID.String()}, query.Datasets)
+	require.Empty(t, query.ConsentRefusals)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func addConsent(l *testLedger) byzcoin.InstanceID {
+	return l.spawn(ConsentContractID, byzcoin.Arguments{{
+		Name:  ConsentCohortKey,
+		Value: []byte("cohort"),
+	}})
+}
+
+func consentInstruction(instID byzcoin.InstanceID, command, category, forbidden,
+	permitted string) byzcoin.Instruction {
+
+	return invokeInstruction(instID, ConsentContractID, command, byzcoin.Arguments{{
+		Name:  ConsentCategoryKey,
+		Value: []byte(category),
+	}, {
+		Name:  ConsentForbiddenKey,
+		Value: []byte(forbidden),
+	}, {
+		Name:  ConsentPermittedKey,
+		Value: []byte(permitted),
+	}})
+}
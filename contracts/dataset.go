@@ -0,0 +1,330 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// DatasetContractID is the name of the dataset Contract.
+//
+// The dataset contract represents a dataset held by an institution. It defines
+// the query terms the institution allows on its data and the identity of the
+// data custodian, which the admins can change. Projects reference datasets,
+// and a query is authorized on a dataset only if the dataset allows it, and if
+// the consent of the cohort of the dataset, when it references one, allows it
+// too.
+const DatasetContractID = "dataset"
+
+const (
+	DatasetNameKey        = "name"
+	DatasetDescriptionKey = "description"
+	DatasetInstitutionKey = "institution"
+	DatasetQueryTermKey   = "queryTerm"
+	DatasetCustodianKey   = "custodian"
+	DatasetConsentIDKey   = "consentID"
+
+	DatasetAddAction          = "add"
+	DatasetRemoveAction       = "remove"
+	DatasetSetConsentAction   = "setConsent"
+	DatasetSetCustodianAction = "setCustodian"
+)
+
+// DatasetVersion is the current version of the dataset contract format.
+//
+//   - 1: first version
+//   - 2: datasets reference the consent of their cohort
+const DatasetVersion = 2
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(DatasetContractID, datasetContractFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+// datasetContractFromBytes unmarshals a contract
+func datasetContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeDatasetContract(in)
+}
+
+// DecodeDatasetContract decodes the state of a dataset instance. States stored
+// with an older version are upgraded to the latest version.
+func DecodeDatasetContract(in []byte) (*DatasetContract, error) {
+	// ByzCoin uses an empty instance to spawn new instances
+	if len(in) == 0 {
+		return &DatasetContract{}, nil
+	}
+
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version == 0 || version > DatasetVersion {
+		return nil, xerrors.Errorf("unknown dataset version: %d", version)
+	}
+
+	var c DatasetContract
+
+	// older versions only miss fields, which are left empty
+	err = protobuf.Decode(data, &c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dataset: %v", err)
+	}
+
+	return &c, nil
+}
+
+// DatasetContract is a smart contract that defines the metadata of a dataset
+// and the query terms allowed on it.
+//
+// - implements byzcoin.Contract
+type DatasetContract struct {
+	byzcoin.BasicContract
+
+	Name        string
+	Description string
+	Institution string
+	// QueryTerms are the query terms the institution allows on the dataset.
+	QueryTerms []string
+	// Custodian is the DARC identity of the data custodian, for example
+	// "ed25519:...".
+	Custodian string
+	// Consent is the hex-encoded instance ID of the consent of the cohort of
+	// the dataset. The queries are not restricted by consent if it is empty.
+	Consent string
+}
+
+// VerifyDeferredInstruction implements byzcoin.Contract.
+func (d DatasetContract) VerifyDeferredInstruction(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, ctxHash []byte) error {
+
+	opts := &byzcoin.VerificationOptions{IgnoreCounters: true}
+	return inst.VerifyWithOption(rst, ctxHash, opts)
+}
+
+// Spawn implements byzcoin.Contract.
+func (d DatasetContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(DatasetContractID, inst, time.Now())
+
+	var darcID darc.ID
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	args := inst.Spawn.Args
+
+	custodian, err := parseCustodian(args.Search(DatasetCustodianKey))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("invalid custodian: %v", err)
+	}
+
+	state := DatasetContract{
+		Name:        string(args.Search(DatasetNameKey)),
+		Description: string(args.Search(DatasetDescriptionKey)),
+		Institution: string(args.Search(DatasetInstitutionKey)),
+		QueryTerms:  make([]string, 0),
+		Custodian:   custodian,
+	}
+
+	state.addQueryTerms(string(args.Search(DatasetQueryTermKey)))
+
+	consentID := args.Search(DatasetConsentIDKey)
+	if len(consentID) > 0 {
+		state.Consent = byzcoin.NewInstanceID(consentID).String()
+
+		_, err = getConsent(rst, state.Consent)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get consent: %v", err)
+		}
+	}
+
+	buf, err := state.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), DatasetContractID,
+		buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Invoke implements byzcoin.Contract.
+func (d DatasetContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(DatasetContractID, inst, time.Now())
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	queryTerm := string(inst.Arguments().Search(DatasetQueryTermKey))
+
+	switch inst.Invoke.Command {
+	case DatasetAddAction:
+		d.addQueryTerms(queryTerm)
+	case DatasetRemoveAction:
+		d.removeQueryTerm(queryTerm)
+	case DatasetSetConsentAction:
+		// an empty consentID removes the consent restrictions
+		d.Consent = ""
+
+		consentID := inst.Arguments().Search(DatasetConsentIDKey)
+		if len(consentID) > 0 {
+			d.Consent = byzcoin.NewInstanceID(consentID).String()
+
+			_, err := getConsent(rst, d.Consent)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("failed to get consent: %v", err)
+			}
+		}
+	case DatasetSetCustodianAction:
+		// the approvals of the queries already spawned are still expected
+		// from the previous custodian
+		d.Custodian, err = parseCustodian(inst.Arguments().Search(DatasetCustodianKey))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("invalid custodian: %v", err)
+		}
+	case MigrateAction:
+		// the state is already upgraded by the decoder, we only need to store
+		// it back with the latest version.
+	default:
+		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
+	}
+
+	buf, err := d.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to marshal dataset: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		DatasetContractID, buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Delete implements byzcoin.Contract
+func (d DatasetContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("delete not allowed in dataset contract")
+}
+
+// IsAllowed checks if the query definition is allowed on the dataset.
+func (d DatasetContract) IsAllowed(queryDefinition string) bool {
+	for _, term := range d.QueryTerms {
+		if term == queryDefinition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encode encodes the dataset with the latest version.
+func (d DatasetContract) encode() ([]byte, error) {
+	return encodeVersioned(DatasetVersion, &d)
+}
+
+func (d DatasetContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- Dataset")
+	fmt.Fprintf(out, "-- Name: %s\n", d.Name)
+	fmt.Fprintf(out, "-- Description: %s\n", d.Description)
+	fmt.Fprintf(out, "-- Institution: %s\n", d.Institution)
+	fmt.Fprintf(out, "-- Custodian: %s\n", d.Custodian)
+	fmt.Fprintf(out, "-- QueryTerms: %v\n", d.QueryTerms)
+	fmt.Fprintf(out, "-- Consent: %s\n", d.Consent)
+
+	return out.String()
+}
+
+// addQueryTerms adds the query terms, which can be a coma separated list of
+// terms: term1, term2, ...
+func (d *DatasetContract) addQueryTerms(queryTerms string) {
+	for _, term := range strings.Split(queryTerms, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" || d.IsAllowed(term) {
+			continue
+		}
+
+		d.QueryTerms = append(d.QueryTerms, term)
+	}
+}
+
+func (d *DatasetContract) removeQueryTerm(queryTerm string) {
+	for i, term := range d.QueryTerms {
+		if term == queryTerm {
+			d.QueryTerms = append(d.QueryTerms[:i], d.QueryTerms[i+1:]...)
+			return
+		}
+	}
+}
+
+// parseCustodian parses the DARC identity of a custodian and returns it in
+// the form of darc.Identity.String, or an empty string if there is none.
+func parseCustodian(value []byte) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+
+	identity, err := darc.ParseIdentity(string(value))
+	if err != nil {
+		return "", xerrors.Errorf("failed to parse identity: %v", err)
+	}
+
+	return identity.String(), nil
+}
+
+// getDataset reads and decodes the dataset stored at the hex-encoded instance
+// ID.
+func getDataset(rst byzcoin.ReadOnlyStateTrie, datasetID string) (*DatasetContract, error) {
+	id, err := ParseInstanceID(datasetID)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid dataset ID: %v", err)
+	}
+
+	buf, _, contractID, _, err := rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get dataset %s: %v", datasetID, err)
+	}
+
+	if contractID != DatasetContractID {
+		return nil, xerrors.Errorf("instance %s is not a dataset: %s", datasetID, contractID)
+	}
+
+	dataset, err := DecodeDatasetContract(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dataset: %v", err)
+	}
+
+	return dataset, nil
+}
+
+// ParseInstanceID parses a hex-encoded instance ID.
+func ParseInstanceID(s string) (byzcoin.InstanceID, error) {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		return byzcoin.InstanceID{}, xerrors.Errorf("failed to decode hex: %v", err)
+	}
+
+	if len(buf) != len(byzcoin.InstanceID{}) {
+		return byzcoin.InstanceID{}, xerrors.Errorf("wrong length: %d", len(buf))
+	}
+
+	return byzcoin.NewInstanceID(buf), nil
+}
@@ -0,0 +1,153 @@
+package contracts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestDataset_Spawn_Invoke(t *testing.T) {
+	l := newTestLedger(t, "spawn:dataset", "invoke:dataset.add", "invoke:dataset.remove",
+		"invoke:dataset.setCustodian")
+
+	// the custodian must be a valid identity
+	_, err := addDataset(l, "q1", "wrong")
+	require.Error(t, err)
+
+	// the identity is stored in its canonical form
+	custodian := l.signer.Identity().String()
+	upper := "ed25519:" + strings.ToUpper(strings.TrimPrefix(custodian, "ed25519:"))
+
+	instID, err := addDataset(l, "q1, q2", upper)
+	require.NoError(t, err)
+
+	err = l.send(
+		invokeInstruction(instID, DatasetContractID, DatasetAddAction, byzcoin.Arguments{{
+			Name:  DatasetQueryTermKey,
+			Value: []byte("q3,q1"),
+		}}),
+		invokeInstruction(instID, DatasetContractID, DatasetRemoveAction, byzcoin.Arguments{{
+			Name:  DatasetQueryTermKey,
+			Value: []byte("q2"),
+		}}),
+	)
+	require.NoError(t, err)
+
+	dataset := getDatasetState(t, l.cl, instID)
+
+	require.Equal(t, "dataset", dataset.Name)
+	require.Equal(t, "hospital", dataset.Institution)
+	require.Equal(t, custodian, dataset.Custodian)
+	require.Equal(t, []string{"q1", "q3"}, dataset.QueryTerms)
+
+	other := darc.NewSignerEd25519(nil, nil).Identity()
+
+	setCustodian := func(custodian string) error {
+		var args byzcoin.Arguments
+		if custodian != "" {
+			args = byzcoin.Arguments{{Name: DatasetCustodianKey, Value: []byte(custodian)}}
+		}
+
+		return l.send(invokeInstruction(instID, DatasetContractID, DatasetSetCustodianAction, args))
+	}
+
+	require.Error(t, setCustodian("wrong"))
+	require.NoError(t, setCustodian(other.String()))
+
+	dataset = getDatasetState(t, l.cl, instID)
+	require.Equal(t, other.String(), dataset.Custodian)
+
+	// without the argument, the custodian is removed
+	require.NoError(t, setCustodian(""))
+
+	dataset = getDatasetState(t, l.cl, instID)
+	require.Empty(t, dataset.Custodian)
+}
+
+// A query on a project with datasets is pending only if at least one dataset
+// allows it.
+func TestDataset_Query_Authorization(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project", "spawn:dataset", "invoke:project.add",
+		"invoke:project.addDataset", "invoke:project.removeDataset")
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
+
+	_, err = addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
+
+	datasetInstID, err := addDataset(l, "q1", "")
+	require.NoError(t, err)
+
+	err = l.send(
+		grantInstruction(projectInstID, "q1,q2"),
+		addDatasetInstruction(projectInstID, datasetInstID),
+	)
+	require.NoError(t, err)
+
+	// only datasets can be added
+	err = l.send(addDatasetInstruction(projectInstID, projectInstID))
+	require.Error(t, err)
+
+	project := getProjectState(t, l.cl, projectInstID)
+	require.Equal(t, []string{datasetInstID.String()}, project.Datasets)
+
+	// q1 is allowed by the project and the dataset, q2 only by the project
+	query := l.spawnQuery(projectInstID, "q1", "q1")
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Equal(t, []string{datasetInstID.String()}, query.Datasets)
+
+	query = l.spawnQuery(projectInstID, "q2", "q2")
+	require.Equal(t, QueryRejectedStatus, query.Status)
+	require.Empty(t, query.Datasets)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func addDataset(l *testLedger, queryTerms, custodian string) (byzcoin.InstanceID, error) {
+	return l.trySpawn(DatasetContractID, byzcoin.Arguments{{
+		Name:  DatasetNameKey,
+		Value: []byte("dataset"),
+	}, {
+		Name:  DatasetInstitutionKey,
+		Value: []byte("hospital"),
+	}, {
+		Name:  DatasetQueryTermKey,
+		Value: []byte(queryTerms),
+	}, {
+		Name:  DatasetCustodianKey,
+		Value: []byte(custodian),
+	}})
+}
+
+// addDatasetInstruction adds the dataset to the project.
+func addDatasetInstruction(projectID, datasetID byzcoin.InstanceID) byzcoin.Instruction {
+	return invokeInstruction(projectID, ProjectContractID, ProjectAddDatasetAction,
+		byzcoin.Arguments{{Name: ProjectDatasetIDKey, Value: datasetID.Slice()}})
+}
+
+func getDatasetState(t *testing.T, cl *byzcoin.Client, instID byzcoin.InstanceID) *DatasetContract {
+	resp, err := cl.GetProofFromLatest(instID.Slice())
+	require.NoError(t, err)
+
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	dataset, err := DecodeDatasetContract(val)
+	require.NoError(t, err)
+
+	return dataset
+}
+
+func getQuery(t *testing.T, cl *byzcoin.Client, instID byzcoin.InstanceID) *QueryContract {
+	resp, err := cl.GetProofFromLatest(instID.Slice())
+	require.NoError(t, err)
+
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	query, err := DecodeQueryContract(val)
+	require.NoError(t, err)
+
+	return query
+}
@@ -0,0 +1,367 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// DUAContractID is the name of the data use agreement (DUA) Contract.
+//
+// The DUA contract stores the versions of a data use agreement, identified by
+// the hash of the agreement document. Users attest that they signed a version
+// of the agreement by spawning an attestation instance on it. A project
+// referencing a DUA only accepts queries from users who attested its current
+// version.
+const DUAContractID = "dua"
+
+const (
+	DUANameKey   = "name"
+	DUAHashKey   = "hash"
+	DUAURLKey    = "url"
+	DUAUserIDKey = "userID"
+
+	DUAPublishAction = "publish"
+)
+
+// DUAVersion is the current version of the DUA contract format.
+//
+//   - 1: first version
+const DUAVersion = 1
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(DUAContractID, duaContractFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+// duaContractFromBytes unmarshals a contract
+func duaContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeDUAContract(in)
+}
+
+// DecodeDUAContract decodes the state of a DUA instance. States stored with an
+// older version are upgraded to the latest version.
+func DecodeDUAContract(in []byte) (*DUAContract, error) {
+	// ByzCoin uses an empty instance to spawn new instances
+	if len(in) == 0 {
+		return &DUAContract{}, nil
+	}
+
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version == 0 || version > DUAVersion {
+		return nil, xerrors.Errorf("unknown dua version: %d", version)
+	}
+
+	var c DUAContract
+
+	err = protobuf.Decode(data, &c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dua: %v", err)
+	}
+
+	return &c, nil
+}
+
+// DUAContract is a smart contract that stores the versions of a data use
+// agreement, and allows the users to attest them.
+//
+// - implements byzcoin.Contract
+type DUAContract struct {
+	byzcoin.BasicContract
+
+	Name string
+	// Versions are the versions of the agreement, the last one is the current
+	// version.
+	Versions []*AgreementVersion
+}
+
+// AgreementVersion is a version of a data use agreement.
+type AgreementVersion struct {
+	// Version is the number of the version, starting at 1.
+	Version int
+	// Hash is the hex-encoded SHA-256 of the agreement document.
+	Hash string
+	// URL is where the agreement document can be read.
+	URL string
+	// Index is the index of the block in which the version was published.
+	Index int
+}
+
+// VerifyInstruction implements byzcoin.Contract.
+func (c DUAContract) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, ctxHash []byte) error {
+
+	if inst.GetType() == byzcoin.SpawnType && inst.ContractID() == AttestationContractID {
+		// Anyone can attest the agreement, as long as the attestation comes
+		// from the user it claims, ie. that it is signed by an identity
+		// registered for the UserID.
+		userID := string(inst.Spawn.Args.Search(DUAUserIDKey))
+
+		err := verifyUser(rst, inst, ctxHash, userID)
+		if err != nil {
+			return xerrors.Errorf("failed to verify user: %v", err)
+		}
+
+		return nil
+	}
+
+	return inst.Verify(rst, ctxHash)
+}
+
+// VerifyDeferredInstruction implements byzcoin.Contract.
+func (c DUAContract) VerifyDeferredInstruction(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, ctxHash []byte) error {
+
+	opts := &byzcoin.VerificationOptions{IgnoreCounters: true}
+	return inst.VerifyWithOption(rst, ctxHash, opts)
+}
+
+// Spawn implements byzcoin.Contract.
+func (c DUAContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	// The DUA contract is also the spawner of the attestations, which are
+	// checked against its current version.
+	if inst.Spawn.ContractID == AttestationContractID {
+		defer observe(AttestationContractID, inst, time.Now())
+		return c.spawnAttestation(rst, inst, coins)
+	}
+
+	defer observe(DUAContractID, inst, time.Now())
+
+	var darcID darc.ID
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	args := inst.Spawn.Args
+
+	state := DUAContract{
+		Name: string(args.Search(DUANameKey)),
+	}
+
+	err = state.publish(rst, string(args.Search(DUAHashKey)), string(args.Search(DUAURLKey)))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to publish: %v", err)
+	}
+
+	buf, err := state.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""), DUAContractID,
+		buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Invoke implements byzcoin.Contract.
+func (c DUAContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(DUAContractID, inst, time.Now())
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	args := inst.Arguments()
+
+	switch inst.Invoke.Command {
+	case DUAPublishAction:
+		err = c.publish(rst, string(args.Search(DUAHashKey)), string(args.Search(DUAURLKey)))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to publish: %v", err)
+		}
+	case MigrateAction:
+		// the state is already upgraded by the decoder, we only need to store
+		// it back with the latest version.
+	default:
+		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
+	}
+
+	buf, err := c.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to marshal dua: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		DUAContractID, buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Delete implements byzcoin.Contract
+func (c DUAContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("delete not allowed in dua contract")
+}
+
+// spawnAttestation spawns the attestation of the current version of the
+// agreement by the user. The hash given by the user must be the one of the
+// current version, so that the user attests the document it read. The
+// attestation is stored at an instance ID derived from the DUA, the user and
+// the version with NewAttestationInstanceID, and a user attests a version only
+// once.
+func (c DUAContract) spawnAttestation(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	args := inst.Spawn.Args
+
+	current := c.Current()
+	if current == nil {
+		return nil, nil, xerrors.New("the agreement has no version")
+	}
+
+	userID := string(args.Search(DUAUserIDKey))
+	if userID == "" {
+		return nil, nil, xerrors.New("userID is missing")
+	}
+
+	hash := string(args.Search(DUAHashKey))
+	if hash != current.Hash {
+		return nil, nil, xerrors.Errorf("hash %s is not the one of the current version %d",
+			hash, current.Version)
+	}
+
+	attestationID := NewAttestationInstanceID(inst.InstanceID, userID, current.Version)
+
+	proof, err := rst.GetProof(attestationID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	exists, err := proof.Exists(attestationID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to check attestation existence: %v", err)
+	}
+
+	if exists {
+		return nil, nil, xerrors.Errorf("user %s already attested version %d",
+			userID, current.Version)
+	}
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	state := AttestationContract{
+		DUAID:   inst.InstanceID.String(),
+		UserID:  userID,
+		Version: current.Version,
+		Hash:    current.Hash,
+		Index:   rst.GetIndex(),
+	}
+
+	buf, err := state.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Create, attestationID, AttestationContractID,
+		buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Current returns the current version of the agreement, or nil if it has no
+// version.
+func (c DUAContract) Current() *AgreementVersion {
+	if len(c.Versions) == 0 {
+		return nil
+	}
+
+	return c.Versions[len(c.Versions)-1]
+}
+
+// encode encodes the DUA with the latest version.
+func (c DUAContract) encode() ([]byte, error) {
+	return encodeVersioned(DUAVersion, &c)
+}
+
+func (c DUAContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- DUA")
+	fmt.Fprintf(out, "-- Name: %s\n", c.Name)
+
+	for _, version := range c.Versions {
+		fmt.Fprintf(out, "-- version %d:\n%s", version.Version, version)
+	}
+
+	return out.String()
+}
+
+// publish adds a new version of the agreement, which becomes the current one.
+func (c *DUAContract) publish(rst byzcoin.ReadOnlyStateTrie, hash, url string) error {
+	buf, err := hex.DecodeString(hash)
+	if err != nil || len(buf) != 32 {
+		return xerrors.Errorf("the hash must be a hex-encoded SHA-256: %s", hash)
+	}
+
+	current := c.Current()
+	if current != nil && current.Hash == hash {
+		return xerrors.Errorf("version %d has the same hash", current.Version)
+	}
+
+	c.Versions = append(c.Versions, &AgreementVersion{
+		Version: len(c.Versions) + 1,
+		Hash:    hash,
+		URL:     url,
+		Index:   rst.GetIndex(),
+	})
+
+	return nil
+}
+
+// String produces a text representation of a version.
+func (v AgreementVersion) String() string {
+	out := new(strings.Builder)
+
+	fmt.Fprintf(out, "- Hash: %s\n", v.Hash)
+	fmt.Fprintf(out, "- URL: %s\n", v.URL)
+	fmt.Fprintf(out, "- Index: %d\n", v.Index)
+
+	return out.String()
+}
+
+// getDUA reads and decodes the DUA stored at the hex-encoded instance ID.
+func getDUA(rst byzcoin.ReadOnlyStateTrie, duaID string) (*DUAContract, error) {
+	id, err := ParseInstanceID(duaID)
+	if err != nil {
+		return nil, xerrors.Errorf("invalid dua ID: %v", err)
+	}
+
+	buf, _, contractID, _, err := rst.GetValues(id.Slice())
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get dua %s: %v", duaID, err)
+	}
+
+	if contractID != DUAContractID {
+		return nil, xerrors.Errorf("instance %s is not a dua: %s", duaID, contractID)
+	}
+
+	dua, err := DecodeDUAContract(buf)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode dua: %v", err)
+	}
+
+	return dua, nil
+}
@@ -0,0 +1,170 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+func TestDUA_Spawn_Invoke(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:dua", "invoke:dua.publish")
+
+	_, err := addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
+
+	duaInstID := addDUA(l)
+
+	v1 := agreementHash("v1")
+	v2 := agreementHash("v2")
+
+	// the hash must be a SHA-256
+	require.Error(t, l.send(publishInstruction(duaInstID, "abcd")))
+	// the current version can't be published again
+	require.Error(t, l.send(publishInstruction(duaInstID, v1)))
+
+	// only the current version can be attested
+	require.Error(t, l.send(attestInstruction(duaInstID, "userID", v2)))
+	require.NoError(t, l.send(attestInstruction(duaInstID, "userID", v1)))
+	// a version is attested only once
+	require.Error(t, l.send(attestInstruction(duaInstID, "userID", v1)))
+	// the user must be registered
+	require.Error(t, l.send(attestInstruction(duaInstID, "unknown", v1)))
+
+	require.NoError(t, l.send(publishInstruction(duaInstID, v2)))
+	require.Error(t, l.send(attestInstruction(duaInstID, "userID", v1)))
+	require.NoError(t, l.send(attestInstruction(duaInstID, "userID", v2)))
+
+	resp, err := l.cl.GetProofFromLatest(duaInstID.Slice())
+	require.NoError(t, err)
+
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	dua, err := DecodeDUAContract(val)
+	require.NoError(t, err)
+
+	require.Equal(t, "dua", dua.Name)
+	require.Len(t, dua.Versions, 2)
+	require.Equal(t, 1, dua.Versions[0].Version)
+	require.Equal(t, v1, dua.Versions[0].Hash)
+	require.Equal(t, "https://dua.example", dua.Versions[0].URL)
+	require.Equal(t, 2, dua.Current().Version)
+	require.Equal(t, v2, dua.Current().Hash)
+
+	for version, hash := range map[int]string{1: v1, 2: v2} {
+		attestationID := NewAttestationInstanceID(duaInstID, "userID", version)
+
+		resp, err = l.cl.GetProofFromLatest(attestationID.Slice())
+		require.NoError(t, err)
+
+		_, val, contractID, _, _ := resp.Proof.KeyValue()
+		require.Equal(t, AttestationContractID, contractID)
+
+		attestation, err := DecodeAttestationContract(val)
+		require.NoError(t, err)
+		require.Equal(t, duaInstID.String(), attestation.DUAID)
+		require.Equal(t, "userID", attestation.UserID)
+		require.Equal(t, version, attestation.Version)
+		require.Equal(t, hash, attestation.Hash)
+	}
+}
+
+// A project with a DUA rejects the queries of the users who didn't attest its
+// current version, and references the attestation on the accepted queries.
+func TestDUA_Query_Authorization(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project", "spawn:dua", "invoke:dua.publish",
+		"invoke:project.add", "invoke:project.setDUA")
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
+
+	_, err = addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
+
+	duaInstID := addDUA(l)
+
+	setDUA := func(duaID []byte) byzcoin.Instruction {
+		return invokeInstruction(projectInstID, ProjectContractID, ProjectSetDUAAction,
+			byzcoin.Arguments{{Name: ProjectDUAIDKey, Value: duaID}})
+	}
+
+	// only DUAs can be set
+	require.Error(t, l.send(setDUA(projectInstID.Slice())))
+
+	require.NoError(t, l.send(
+		setDUA(duaInstID.Slice()),
+		grantInstruction(projectInstID, "q1"),
+	))
+
+	query := l.spawnQuery(projectInstID, "1", "q1")
+	require.Equal(t, QueryRejectedStatus, query.Status)
+	require.Empty(t, query.Attestation)
+	require.Equal(t, "user userID has not attested version 1 of the data use agreement",
+		query.RejectionReason)
+
+	require.NoError(t, l.send(attestInstruction(duaInstID, "userID", agreementHash("v1"))))
+
+	query = l.spawnQuery(projectInstID, "2", "q1")
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Equal(t, NewAttestationInstanceID(duaInstID, "userID", 1).String(), query.Attestation)
+	require.Empty(t, query.RejectionReason)
+
+	// a new version must be attested again
+	require.NoError(t, l.send(publishInstruction(duaInstID, agreementHash("v2"))))
+
+	query = l.spawnQuery(projectInstID, "3", "q1")
+	require.Equal(t, QueryRejectedStatus, query.Status)
+	require.Empty(t, query.Attestation)
+
+	require.NoError(t, l.send(attestInstruction(duaInstID, "userID", agreementHash("v2"))))
+
+	query = l.spawnQuery(projectInstID, "4", "q1")
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Equal(t, NewAttestationInstanceID(duaInstID, "userID", 2).String(), query.Attestation)
+
+	// without the DUA, no attestation is required anymore
+	require.NoError(t, l.send(setDUA(nil)))
+
+	query = l.spawnQuery(projectInstID, "5", "q1")
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Empty(t, query.Attestation)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func agreementHash(document string) string {
+	h := sha256.Sum256([]byte(document))
+	return hex.EncodeToString(h[:])
+}
+
+func addDUA(l *testLedger) byzcoin.InstanceID {
+	return l.spawn(DUAContractID, byzcoin.Arguments{{
+		Name:  DUANameKey,
+		Value: []byte("dua"),
+	}, {
+		Name:  DUAHashKey,
+		Value: []byte(agreementHash("v1")),
+	}, {
+		Name:  DUAURLKey,
+		Value: []byte("https://dua.example"),
+	}})
+}
+
+func publishInstruction(instID byzcoin.InstanceID, hash string) byzcoin.Instruction {
+	return invokeInstruction(instID, DUAContractID, DUAPublishAction, byzcoin.Arguments{{
+		Name:  DUAHashKey,
+		Value: []byte(hash),
+	}})
+}
+
+func attestInstruction(instID byzcoin.InstanceID, userID, hash string) byzcoin.Instruction {
+	return spawnInstruction(instID, AttestationContractID, byzcoin.Arguments{{
+		Name:  DUAUserIDKey,
+		Value: []byte(userID),
+	}, {
+		Name:  DUAHashKey,
+		Value: []byte(hash),
+	}})
+}
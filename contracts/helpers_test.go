@@ -0,0 +1,190 @@
+package contracts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+// testLedger is a ledger on a local roster of 3 conodes, whose genesis darc
+// grants the rules to the signer. It sets the counters of the instructions it
+// sends.
+type testLedger struct {
+	t      *testing.T
+	cl     *byzcoin.Client
+	gDarc  *darc.Darc
+	signer darc.Signer
+	// counters are the next counters of the identities which signed a
+	// transaction.
+	counters map[string]uint64
+}
+
+// newTestLedger starts a ledger which is stopped at the end of the test.
+func newTestLedger(t *testing.T, rules ...string) *testLedger {
+	local := onet.NewTCPTest(cothority.Suite)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		rules, signer.Identity())
+	require.NoError(t, err)
+
+	genesisMsg.BlockInterval = time.Second
+
+	t.Cleanup(func() {
+		local.WaitDone(genesisMsg.BlockInterval)
+		local.CloseAll()
+	})
+
+	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	return &testLedger{
+		t:        t,
+		cl:       cl,
+		gDarc:    &genesisMsg.GenesisDarc,
+		signer:   signer,
+		counters: make(map[string]uint64),
+	}
+}
+
+// sendTransactionAs sends the instructions in a transaction signed by the
+// signer, and returns it.
+func (l *testLedger) sendTransactionAs(signer darc.Signer,
+	insts ...byzcoin.Instruction) (byzcoin.ClientTransaction, error) {
+
+	id := signer.Identity().String()
+
+	counter, ok := l.counters[id]
+	if !ok {
+		counter = 1
+	}
+
+	for i := range insts {
+		insts[i].SignerCounter = []uint64{counter + uint64(i)}
+	}
+
+	ctx, err := l.cl.CreateTransaction(insts...)
+	require.NoError(l.t, err)
+	require.NoError(l.t, ctx.FillSignersAndSignWith(signer))
+
+	_, err = l.cl.AddTransactionAndWait(ctx, 10)
+	if err == nil {
+		// the counters of a refused transaction are not used
+		l.counters[id] = counter + uint64(len(insts))
+	}
+
+	return ctx, err
+}
+
+// sendAs sends the instructions in a transaction signed by the signer.
+func (l *testLedger) sendAs(signer darc.Signer, insts ...byzcoin.Instruction) error {
+	_, err := l.sendTransactionAs(signer, insts...)
+	return err
+}
+
+// send sends the instructions in a transaction signed by the signer of the
+// genesis darc.
+func (l *testLedger) send(insts ...byzcoin.Instruction) error {
+	return l.sendAs(l.signer, insts...)
+}
+
+// trySpawn spawns an instance of the contract from the genesis darc, and
+// returns its ID.
+func (l *testLedger) trySpawn(contractID string,
+	args byzcoin.Arguments) (byzcoin.InstanceID, error) {
+
+	ctx, err := l.sendTransactionAs(l.signer, spawnInstruction(
+		byzcoin.NewInstanceID(l.gDarc.GetBaseID()), contractID, args))
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+
+	return ctx.Instructions[0].DeriveID(""), nil
+}
+
+// spawn is trySpawn for the instances which must be spawned.
+func (l *testLedger) spawn(contractID string, args byzcoin.Arguments) byzcoin.InstanceID {
+	id, err := l.trySpawn(contractID, args)
+	require.NoError(l.t, err)
+
+	return id
+}
+
+// spawnQuery spawns a query of userID on the project, and returns its state.
+func (l *testLedger) spawnQuery(projectID byzcoin.InstanceID, queryID,
+	queryDefinition string) *QueryContract {
+
+	require.NoError(l.t, l.send(queryInstruction(projectID, "userID", queryID,
+		queryDefinition)))
+
+	return getQuery(l.t, l.cl, NewQueryInstanceID(projectID, queryID))
+}
+
+func spawnInstruction(instID byzcoin.InstanceID, contractID string,
+	args byzcoin.Arguments) byzcoin.Instruction {
+
+	return byzcoin.Instruction{
+		InstanceID: instID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contractID,
+			Args:       args,
+		},
+	}
+}
+
+func invokeInstruction(instID byzcoin.InstanceID, contractID, command string,
+	args byzcoin.Arguments) byzcoin.Instruction {
+
+	return byzcoin.Instruction{
+		InstanceID: instID,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contractID,
+			Command:    command,
+			Args:       args,
+		},
+	}
+}
+
+// grantInstruction grants the query terms to userID on the project.
+func grantInstruction(projectID byzcoin.InstanceID, queryTerms string) byzcoin.Instruction {
+	return grantUserInstruction(projectID, "userID", queryTerms)
+}
+
+// grantUserInstruction grants the query terms to the user on the project.
+func grantUserInstruction(projectID byzcoin.InstanceID, userID,
+	queryTerms string) byzcoin.Instruction {
+
+	return invokeInstruction(projectID, ProjectContractID, ProjectAddAction, byzcoin.Arguments{{
+		Name:  ProjectUserIDKey,
+		Value: []byte(userID),
+	}, {
+		Name:  ProjectQueryTermKey,
+		Value: []byte(queryTerms),
+	}})
+}
+
+// queryInstruction spawns a query of the user on the project.
+func queryInstruction(projectID byzcoin.InstanceID, userID, queryID,
+	queryDefinition string) byzcoin.Instruction {
+
+	return spawnInstruction(projectID, QueryContractID, byzcoin.Arguments{{
+		Name:  QueryDescriptionKey,
+		Value: []byte("desc"),
+	}, {
+		Name:  QueryUserIDKey,
+		Value: []byte(userID),
+	}, {
+		Name:  QueryQueryIDKey,
+		Value: []byte(queryID),
+	}, {
+		Name:  QueryQueryDefinitionKey,
+		Value: []byte(queryDefinition),
+	}})
+}
@@ -0,0 +1,26 @@
+package contracts
+
+import (
+	"time"
+
+	"github.com/ldsec/medchain/metrics"
+	"go.dedis.ch/cothority/v3/byzcoin"
+)
+
+// observe records the time the contract took to execute the instruction. The
+// instruction only gives the type of the label, so that the transactions
+// can't create arbitrary metrics.
+func observe(contractID string, inst byzcoin.Instruction, start time.Time) {
+	instrType := "invalid"
+
+	switch inst.GetType() {
+	case byzcoin.SpawnType:
+		instrType = "spawn"
+	case byzcoin.InvokeType:
+		instrType = "invoke"
+	case byzcoin.DeleteType:
+		instrType = "delete"
+	}
+
+	metrics.ContractDuration.ObserveSince(start, contractID, instrType)
+}
@@ -3,7 +3,9 @@ package contracts
 import (
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/ldsec/medchain/logging"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/onet/v3/log"
@@ -23,6 +25,16 @@ const (
 	ProjectNameKey        = "name"
 	ProjectUserIDKey      = "userID"
 	ProjectQueryTermKey   = "queryTerm"
+	ProjectDatasetIDKey   = "datasetID"
+	ProjectCatalogIDKey   = "catalogID"
+	ProjectDUAIDKey       = "duaID"
+
+	ProjectAddAction           = "add"
+	ProjectRemoveAction        = "remove"
+	ProjectAddDatasetAction    = "addDataset"
+	ProjectRemoveDatasetAction = "removeDataset"
+	ProjectSetCatalogAction    = "setCatalog"
+	ProjectSetDUAAction        = "setDUA"
 )
 
 func init() {
@@ -32,11 +44,36 @@ func init() {
 	}
 }
 
+// ProjectVersion is the current version of the project contract format.
+//
+//   - 0: states stored before versioning, same fields as version 1
+//   - 1: versioned state
+//   - 2: projects reference datasets
+//   - 3: projects reference a catalog of query terms
+//   - 4: projects reference the data use agreement of their users
+const ProjectVersion = 4
+
 // projectContractFromBytes unmarshals a contract
 func projectContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeProjectContract(in)
+}
+
+// DecodeProjectContract decodes the state of a project instance. States stored
+// with an older version are upgraded to the latest version.
+func DecodeProjectContract(in []byte) (*ProjectContract, error) {
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version > ProjectVersion {
+		return nil, xerrors.Errorf("unknown project version: %d", version)
+	}
+
 	var c ProjectContract
 
-	err := protobuf.Decode(in, &c)
+	// older versions only miss fields, which are left empty
+	err = protobuf.Decode(data, &c)
 	if err != nil {
 		return nil, xerrors.Errorf("failed to decode project: %v", err)
 	}
@@ -52,16 +89,35 @@ type ProjectContract struct {
 	Name           string
 	Description    string
 	Authorizations Authorizations
+	// Datasets are the hex-encoded instance IDs of the datasets of the
+	// project.
+	Datasets []string
+	// Catalog is the hex-encoded instance ID of the catalog of the valid
+	// query terms. Any term can be granted if it is empty.
+	Catalog string
+	// DUA is the hex-encoded instance ID of the data use agreement the users
+	// must have attested to submit queries. No attestation is required if it
+	// is empty.
+	DUA string
 }
 
 // VerifyInstruction implements byzcoin.Contract.
 func (p *ProjectContract) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie,
 	inst byzcoin.Instruction, ctxHash []byte) error {
 
-	if inst.ContractID() == QueryContractID {
-		// We don't do any check there because the project's authorization is
+	if inst.GetType() == byzcoin.SpawnType && inst.ContractID() == QueryContractID {
+		// We don't check the DARC there because the project's authorization is
 		// managed by the admin, and we perform the authorization check in
-		// spawnQuery().
+		// spawnQuery(). We only check that the query comes from the user it
+		// claims, ie. that it is signed by an identity registered for the
+		// UserID.
+		userID := string(inst.Spawn.Args.Search(QueryUserIDKey))
+
+		err := verifyUser(rst, inst, ctxHash, userID)
+		if err != nil {
+			return xerrors.Errorf("failed to verify user: %v", err)
+		}
+
 		return nil
 	}
 
@@ -84,9 +140,12 @@ func (p *ProjectContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
 	// custom spawner to make the special verification against the
 	// authorizations stored on this project.
 	if inst.Spawn.ContractID == QueryContractID {
+		defer observe(QueryContractID, inst, time.Now())
 		return p.spawnQuery(rst, inst, coins)
 	}
 
+	defer observe(ProjectContractID, inst, time.Now())
+
 	var darcID darc.ID
 	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
 	if err != nil {
@@ -102,7 +161,27 @@ func (p *ProjectContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
 		Authorizations: make(Authorizations, 0),
 	}
 
-	buf, err := protobuf.Encode(&state)
+	catalogID := inst.Spawn.Args.Search(ProjectCatalogIDKey)
+	if len(catalogID) > 0 {
+		state.Catalog = byzcoin.NewInstanceID(catalogID).String()
+
+		_, err = getCatalog(rst, state.Catalog)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get catalog: %v", err)
+		}
+	}
+
+	duaID := inst.Spawn.Args.Search(ProjectDUAIDKey)
+	if len(duaID) > 0 {
+		state.DUA = byzcoin.NewInstanceID(duaID).String()
+
+		_, err = getDUA(rst, state.DUA)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get dua: %v", err)
+		}
+	}
+
+	buf, err := state.encode()
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
 	}
@@ -117,6 +196,8 @@ func (p *ProjectContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
 func (p ProjectContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
 	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
 
+	defer observe(ProjectContractID, inst, time.Now())
+
 	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
@@ -126,19 +207,78 @@ func (p ProjectContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
 	queryTerm := string(inst.Arguments().Search(ProjectQueryTermKey))
 
 	switch inst.Invoke.Command {
-	case "add":
+	case ProjectAddAction:
 		// queryTerm can be a coma separated list of terms: term1, term1, ...
-		for _, a := range strings.Split(queryTerm, ",") {
-			a = strings.TrimSpace(a)
+		terms := strings.Split(queryTerm, ",")
+		for i := range terms {
+			terms[i] = strings.TrimSpace(terms[i])
+		}
+
+		err = p.checkTerms(rst, terms)
+		if err != nil {
+			logging.Decision(ProjectContractID, inst, byzcoin.InstanceID{},
+				fmt.Sprintf("query terms refused for user %s", userID), err.Error())
+
+			return nil, nil, xerrors.Errorf("failed to check terms: %v", err)
+		}
+
+		for _, a := range terms {
 			p.updateAuth(userID, a)
+
+			logging.Decision(ProjectContractID, inst, byzcoin.InstanceID{},
+				fmt.Sprintf("query term %s granted to user %s", a, userID), "")
 		}
-	case "remove":
+	case ProjectRemoveAction:
 		p.removeAuth(userID, queryTerm)
+
+		logging.Decision(ProjectContractID, inst, byzcoin.InstanceID{},
+			fmt.Sprintf("query term %s revoked from user %s", queryTerm, userID), "")
+	case ProjectAddDatasetAction:
+		datasetID := byzcoin.NewInstanceID(inst.Arguments().Search(ProjectDatasetIDKey))
+
+		_, err := getDataset(rst, datasetID.String())
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get dataset: %v", err)
+		}
+
+		p.addDataset(datasetID.String())
+	case ProjectRemoveDatasetAction:
+		datasetID := byzcoin.NewInstanceID(inst.Arguments().Search(ProjectDatasetIDKey))
+		p.removeDataset(datasetID.String())
+	case ProjectSetCatalogAction:
+		// an empty catalogID lets the project grant any term again
+		p.Catalog = ""
+
+		catalogID := inst.Arguments().Search(ProjectCatalogIDKey)
+		if len(catalogID) > 0 {
+			p.Catalog = byzcoin.NewInstanceID(catalogID).String()
+
+			_, err := getCatalog(rst, p.Catalog)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("failed to get catalog: %v", err)
+			}
+		}
+	case ProjectSetDUAAction:
+		// an empty duaID doesn't require attestations anymore
+		p.DUA = ""
+
+		duaID := inst.Arguments().Search(ProjectDUAIDKey)
+		if len(duaID) > 0 {
+			p.DUA = byzcoin.NewInstanceID(duaID).String()
+
+			_, err := getDUA(rst, p.DUA)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("failed to get dua: %v", err)
+			}
+		}
+	case MigrateAction:
+		// the state is already upgraded by the decoder, we only need to store
+		// it back with the latest version.
 	default:
 		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
 	}
 
-	buf, err := protobuf.Encode(&p)
+	buf, err := p.encode()
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to marshal project: %v", err)
 	}
@@ -157,21 +297,102 @@ func (p ProjectContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instructi
 }
 
 // spawnQuery spawns a query contract and sets its "status" and "projectID"
-// arguments. The status is given based on the authorization of the userID
-// stored on the authorization of this contract. Status is set to "pending" if
-// at least one of the element in the query definition is allowed, otherwise it
-// sets the status to "rejected".
+// arguments.
+//
+// The query instance ID is derived from the project and the queryID with
+// NewQueryInstanceID, and a queryID can't be used twice on a project.
+//
+// The status is given based on the authorization of the userID stored on this
+// contract. It is set to "pending" if the query definition is allowed for the
+// user, otherwise it is set to "rejected" and the reason is stored on the
+// query.
+//
+// If the project has datasets, the query must also be allowed by at least one
+// of them, and the datasets allowing it are stored on the query. A dataset
+// doesn't allow the query if a rule of its consent refuses it, and the rules
+// refusing it are stored on the query. If some of the datasets allowing the
+// query have a custodian, the status is set to "awaitingApproval".
+//
+// If the project has a data use agreement, the query is rejected unless the
+// user attested its current version, and the attestation is stored on the
+// query.
 func (p *ProjectContract) spawnQuery(rst byzcoin.ReadOnlyStateTrie,
 	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
 
 	args := inst.Spawn.Args
 
+	queryID := string(args.Search(QueryQueryIDKey))
+	if queryID == "" {
+		return nil, nil, xerrors.Errorf("queryID is missing")
+	}
+
+	// The query is stored at a location derived from the project and the
+	// queryID, which also ensures that a queryID is used only once per
+	// project.
+	queryInstID := NewQueryInstanceID(inst.InstanceID, queryID)
+
+	proof, err := rst.GetProof(queryInstID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	exists, err := proof.Exists(queryInstID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to check query existence: %v", err)
+	}
+
+	if exists {
+		return nil, nil, xerrors.Errorf("query with ID '%s' already exists", queryID)
+	}
+
 	queryDefinition := args.Search(QueryQueryDefinitionKey)
 	status := QueryRejectedStatus
 
-	auth := p.Authorizations.Find(string(args.Search(QueryUserIDKey)))
-	if auth != nil && auth.IsAllowed(string(queryDefinition)) {
-		status = QueryPendingStatus
+	var datasets []string
+	var refusals ConsentRefusals
+	var approvals Approvals
+	var attestation string
+	var reason string
+
+	userID := string(args.Search(QueryUserIDKey))
+
+	attestation, reason, err = p.checkAttestation(rst, userID)
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to check attestation: %v", err)
+	}
+
+	auth := p.Authorizations.Find(userID)
+	if reason != "" {
+		// the user didn't attest the current data use agreement
+	} else if auth != nil && auth.IsAllowed(string(queryDefinition)) {
+		datasets, refusals, err = p.allowedDatasets(rst, string(queryDefinition))
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to check datasets: %v", err)
+		}
+
+		// a project without datasets only relies on its authorizations
+		if len(p.Datasets) == 0 || len(datasets) != 0 {
+			status = QueryPendingStatus
+		} else if len(refusals) != 0 {
+			reason = fmt.Sprintf("consent rule %s of dataset %s refuses the query definition",
+				refusals[0].Category, refusals[0].DatasetID)
+		} else {
+			reason = "no dataset of the project allows the query definition"
+		}
+
+		approvals, err = p.requiredApprovals(rst, datasets)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get approvals: %v", err)
+		}
+
+		if len(approvals) != 0 {
+			status = QueryAwaitingApprovalStatus
+			reason = fmt.Sprintf("%d custodian approvals required", len(approvals))
+		}
+	} else if auth == nil {
+		reason = fmt.Sprintf("user %s has no authorization on the project", userID)
+	} else {
+		reason = fmt.Sprintf("query definition not authorized for user %s", userID)
 	}
 
 	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
@@ -181,34 +402,76 @@ func (p *ProjectContract) spawnQuery(rst byzcoin.ReadOnlyStateTrie,
 
 	state := QueryContract{
 		Description:     string(args.Search(QueryDescriptionKey)),
-		UserID:          string(args.Search(QueryUserIDKey)),
-		ProjectID:       p.Name,
-		QueryID:         string(args.Search(QueryQueryIDKey)),
+		UserID:          userID,
+		ProjectID:       inst.InstanceID.String(),
+		QueryID:         queryID,
 		QueryDefinition: string(args.Search(QueryQueryDefinitionKey)),
 		Status:          status,
+		ProjectName:     p.Name,
+		Datasets:        datasets,
+		Approvals:       approvals,
+		Issuer:          string(args.Search(QueryIssuerKey)),
+		SubjectHash:     string(args.Search(QuerySubjectHashKey)),
+		ConsentRefusals: refusals,
+		Attestation:     attestation,
+	}
+
+	if status == QueryRejectedStatus {
+		state.RejectionReason = reason
 	}
 
-	buf, err := protobuf.Encode(&state)
+	buf, err := state.encode()
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
 	}
 
-	sc := byzcoin.NewStateChange(byzcoin.Create, inst.DeriveID(""),
-		QueryContractID, buf, darcID)
+	sc := byzcoin.NewStateChange(byzcoin.Create, queryInstID, QueryContractID,
+		buf, darcID)
+
+	logging.Decision(QueryContractID, inst, queryInstID, "query "+status, reason)
 
 	return []byzcoin.StateChange{sc}, coins, nil
 }
 
+// encode encodes the project with the latest version.
+func (p ProjectContract) encode() ([]byte, error) {
+	return encodeVersioned(ProjectVersion, &p)
+}
+
 func (p ProjectContract) String() string {
 	out := new(strings.Builder)
 	fmt.Fprintln(out, "- Project")
 	fmt.Fprintf(out, "-- Name: %s\n", p.Name)
 	fmt.Fprintf(out, "-- Description: %s\n", p.Description)
+	fmt.Fprintf(out, "-- Datasets: %v\n", p.Datasets)
+	fmt.Fprintf(out, "-- Catalog: %s\n", p.Catalog)
+	fmt.Fprintf(out, "-- DUA: %s\n", p.DUA)
 	fmt.Fprintf(out, "-- Authorization:\n%s", p.Authorizations)
 
 	return out.String()
 }
 
+// checkTerms checks that the terms are in the catalog of the project, if it
+// has one.
+func (p ProjectContract) checkTerms(rst byzcoin.ReadOnlyStateTrie, terms []string) error {
+	if p.Catalog == "" {
+		return nil
+	}
+
+	catalog, err := getCatalog(rst, p.Catalog)
+	if err != nil {
+		return xerrors.Errorf("failed to get catalog: %v", err)
+	}
+
+	for _, term := range terms {
+		if catalog.Find(term) == nil {
+			return xerrors.Errorf("unknown query term '%s' in catalog %s", term, p.Catalog)
+		}
+	}
+
+	return nil
+}
+
 func (p *ProjectContract) updateAuth(userID, action string) {
 	entry := p.Authorizations.Find(userID)
 	if entry == nil {
@@ -244,6 +507,136 @@ func (p *ProjectContract) removeAuth(userID, action string) {
 	entry.QueryTerms = append(entry.QueryTerms[:i], entry.QueryTerms[i+1:]...)
 }
 
+// checkAttestation returns the hex-encoded instance ID of the attestation of
+// the current version of the project's data use agreement by the user. If the
+// user didn't attest it, the reason of the refusal is returned instead. Both
+// are empty if the project has no data use agreement.
+func (p ProjectContract) checkAttestation(rst byzcoin.ReadOnlyStateTrie,
+	userID string) (string, string, error) {
+
+	if p.DUA == "" {
+		return "", "", nil
+	}
+
+	dua, err := getDUA(rst, p.DUA)
+	if err != nil {
+		return "", "", xerrors.Errorf("failed to get dua: %v", err)
+	}
+
+	duaID, err := ParseInstanceID(p.DUA)
+	if err != nil {
+		return "", "", xerrors.Errorf("invalid dua ID: %v", err)
+	}
+
+	current := dua.Current()
+	attestationID := NewAttestationInstanceID(duaID, userID, current.Version)
+
+	proof, err := rst.GetProof(attestationID.Slice())
+	if err != nil {
+		return "", "", xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	exists, err := proof.Exists(attestationID.Slice())
+	if err != nil {
+		return "", "", xerrors.Errorf("failed to check attestation existence: %v", err)
+	}
+
+	if !exists {
+		return "", fmt.Sprintf("user %s has not attested version %d of the data use agreement",
+			userID, current.Version), nil
+	}
+
+	return attestationID.String(), "", nil
+}
+
+// allowedDatasets returns the datasets of the project that allow the query
+// definition, and the consent rules that refuse it on the datasets that would
+// otherwise allow it.
+func (p ProjectContract) allowedDatasets(rst byzcoin.ReadOnlyStateTrie,
+	queryDefinition string) ([]string, ConsentRefusals, error) {
+
+	var allowed []string
+	var refusals ConsentRefusals
+
+	for _, datasetID := range p.Datasets {
+		dataset, err := getDataset(rst, datasetID)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to get dataset: %v", err)
+		}
+
+		if !dataset.IsAllowed(queryDefinition) {
+			continue
+		}
+
+		if dataset.Consent != "" {
+			consent, err := getConsent(rst, dataset.Consent)
+			if err != nil {
+				return nil, nil, xerrors.Errorf("failed to get consent: %v", err)
+			}
+
+			rule := consent.Refusing(queryDefinition)
+			if rule != nil {
+				refusals = append(refusals, &ConsentRefusal{
+					DatasetID: datasetID,
+					ConsentID: dataset.Consent,
+					Category:  rule.Category,
+				})
+
+				continue
+			}
+		}
+
+		allowed = append(allowed, datasetID)
+	}
+
+	return allowed, refusals, nil
+}
+
+// requiredApprovals returns the approvals needed from the custodians of the
+// datasets.
+func (p ProjectContract) requiredApprovals(rst byzcoin.ReadOnlyStateTrie,
+	datasets []string) (Approvals, error) {
+
+	var approvals Approvals
+
+	for _, datasetID := range datasets {
+		dataset, err := getDataset(rst, datasetID)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get dataset: %v", err)
+		}
+
+		if dataset.Custodian == "" {
+			continue
+		}
+
+		approvals = append(approvals, &Approval{
+			DatasetID: datasetID,
+			Custodian: dataset.Custodian,
+		})
+	}
+
+	return approvals, nil
+}
+
+func (p *ProjectContract) addDataset(datasetID string) {
+	for _, id := range p.Datasets {
+		if id == datasetID {
+			return
+		}
+	}
+
+	p.Datasets = append(p.Datasets, datasetID)
+}
+
+func (p *ProjectContract) removeDataset(datasetID string) {
+	for i, id := range p.Datasets {
+		if id == datasetID {
+			p.Datasets = append(p.Datasets[:i], p.Datasets[i+1:]...)
+			return
+		}
+	}
+}
+
 // Authorizations defines the list of authorizations.
 type Authorizations []*Authorization
 
@@ -2,225 +2,69 @@ package contracts
 
 import (
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/require"
-	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
-	"go.dedis.ch/cothority/v3/darc"
-	"go.dedis.ch/onet/v3"
-	"go.dedis.ch/protobuf"
 )
 
 // We try to spawn a project without setting the spawn:project DARC rule.
 func TestProject_Spawn_No_Rule(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
+	l := newTestLedger(t)
 
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
-
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
-	require.NoError(t, err)
-
-	_, err = addProject(t, "n", "d", gDarc, signer, cl)
+	_, err := addProject(l, "n", "d")
 	require.Error(t, err)
 }
 
 func TestProject_Spawn_Ok(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project"}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
-
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
-	require.NoError(t, err)
+	l := newTestLedger(t, "spawn:project")
 
 	description := "desc"
 	name := "name"
 
-	ctx, err := addProject(t, name, description, gDarc, signer, cl)
-	require.NoError(t, err)
-
-	instID := ctx.Instructions[0].DeriveID("")
-
-	resp, err := cl.GetProofFromLatest(instID.Slice())
+	instID, err := addProject(l, name, description)
 	require.NoError(t, err)
 
-	_, val, _, _, _ := resp.Proof.KeyValue()
-	project := ProjectContract{}
-
-	err = protobuf.Decode(val, &project)
-	require.NoError(t, err)
+	project := getProjectState(t, l.cl, instID)
 
 	require.Equal(t, description, project.Description)
 	require.Equal(t, name, project.Name)
-
-	local.WaitDone(genesisMsg.BlockInterval)
 }
 
 // Using a wrong command should fail
 func TestProject_Invoke_Wrong_Command(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project", "invoke:project.wrong"}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
-
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
-	require.NoError(t, err)
+	l := newTestLedger(t, "spawn:project", "invoke:project.wrong")
 
 	description := "desc"
 	name := "name"
 
-	ctx, err := addProject(t, name, description, gDarc, signer, cl)
+	instID, err := addProject(l, name, description)
 	require.NoError(t, err)
 
-	instID := ctx.Instructions[0].DeriveID("")
-
-	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "wrong",
-			Args:       byzcoin.Arguments{},
-		},
-		SignerCounter: []uint64{2},
-	})
-	require.NoError(t, err)
-
-	err = ctx.FillSignersAndSignWith(signer)
-	require.NoError(t, err)
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	err = l.send(invokeInstruction(instID, ProjectContractID, "wrong", byzcoin.Arguments{}))
 	require.Error(t, err)
-
-	local.WaitDone(genesisMsg.BlockInterval)
 }
 
 func TestProject_Invoke_Add(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project", "invoke:project.add"}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
+	l := newTestLedger(t, "spawn:project", "invoke:project.add")
 
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	instID, err := addProject(l, "n", "d")
 	require.NoError(t, err)
 
-	ctx, err := addProject(t, "n", "d", gDarc, signer, cl)
-	require.NoError(t, err)
-
-	instID := ctx.Instructions[0].DeriveID("")
-
 	userID1 := "userID1"
 	userID2 := "userID2"
 	queryTerm1 := "q1"
 	queryTerm2 := "q2,q3, q4" // can be a coma separated list of query term
 
-	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID1),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm1),
-			}},
-		},
-		SignerCounter: []uint64{2},
-	}, byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID1),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm2),
-			}},
-		},
-		SignerCounter: []uint64{3},
+	err = l.send(
+		grantUserInstruction(instID, userID1, queryTerm1),
+		grantUserInstruction(instID, userID1, queryTerm2),
 		// adding two times the same userID/queryTerm should add it only once
-	}, byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID1),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm2),
-			}},
-		},
-		SignerCounter: []uint64{4},
-	}, byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID2),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm1),
-			}},
-		},
-		SignerCounter: []uint64{5},
-	})
-	require.NoError(t, err)
-
-	err = ctx.FillSignersAndSignWith(signer)
-	require.NoError(t, err)
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
-	require.NoError(t, err)
-
-	resp, err := cl.GetProofFromLatest(instID.Slice())
+		grantUserInstruction(instID, userID1, queryTerm2),
+		grantUserInstruction(instID, userID2, queryTerm1),
+	)
 	require.NoError(t, err)
 
-	_, val, _, _, _ := resp.Proof.KeyValue()
-	project := ProjectContract{}
-
-	err = protobuf.Decode(val, &project)
-	require.NoError(t, err)
+	project := getProjectState(t, l.cl, instID)
 
 	expected := Authorizations{
 		&Authorization{
@@ -233,121 +77,40 @@ func TestProject_Invoke_Add(t *testing.T) {
 		},
 	}
 	require.Equal(t, expected, project.Authorizations)
-
-	local.WaitDone(genesisMsg.BlockInterval)
 }
 
 func TestProject_Invoke_Remove(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project", "invoke:project.add", "invoke:project.remove"},
-		signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
+	l := newTestLedger(t, "spawn:project", "invoke:project.add", "invoke:project.remove")
 
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	instID, err := addProject(l, "n", "d")
 	require.NoError(t, err)
 
-	ctx, err := addProject(t, "n", "d", gDarc, signer, cl)
-	require.NoError(t, err)
-
-	instID := ctx.Instructions[0].DeriveID("")
-
 	userID1 := "userID1"
 	userID2 := "userID2"
 	queryTerm1 := "q1"
 	queryTerm2 := "q2"
 
-	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID1),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm1),
-			}},
-		},
-		SignerCounter: []uint64{2},
-	}, byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID2),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm2),
-			}},
-		},
-		SignerCounter: []uint64{3},
-	})
-	require.NoError(t, err)
-
-	err = ctx.FillSignersAndSignWith(signer)
-	require.NoError(t, err)
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
-	require.NoError(t, err)
-
-	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "remove",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID1),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm1),
-			}},
-		},
-		SignerCounter: []uint64{4},
-		// removing an inexistent userID/queryTerm is fine
-	}, byzcoin.Instruction{
-		InstanceID: instID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "remove",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID1),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm1),
-			}},
-		},
-		SignerCounter: []uint64{5},
-	})
+	err = l.send(
+		grantUserInstruction(instID, userID1, queryTerm1),
+		grantUserInstruction(instID, userID2, queryTerm2),
+	)
 	require.NoError(t, err)
 
-	err = ctx.FillSignersAndSignWith(signer)
-	require.NoError(t, err)
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
-	require.NoError(t, err)
+	remove := func() byzcoin.Instruction {
+		return invokeInstruction(instID, ProjectContractID, ProjectRemoveAction, byzcoin.Arguments{{
+			Name:  ProjectUserIDKey,
+			Value: []byte(userID1),
+		}, {
+			Name:  ProjectQueryTermKey,
+			Value: []byte(queryTerm1),
+		}})
+	}
 
-	resp, err := cl.GetProofFromLatest(instID.Slice())
+	// removing an inexistent userID/queryTerm is fine
+	err = l.send(remove(), remove())
 	require.NoError(t, err)
 
-	_, val, _, _, _ := resp.Proof.KeyValue()
-	project := ProjectContract{}
-
-	err = protobuf.Decode(val, &project)
-	require.NoError(t, err)
+	project := getProjectState(t, l.cl, instID)
 
 	expected := Authorizations{
 		&Authorization{
@@ -360,78 +123,70 @@ func TestProject_Invoke_Remove(t *testing.T) {
 		},
 	}
 	require.Equal(t, expected, project.Authorizations)
-
-	local.WaitDone(genesisMsg.BlockInterval)
 }
 
-// delete instruction should return an error
-func TestProject_Delete(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
+// migrate rewrites the project with the latest version
+func TestProject_Invoke_Migrate(t *testing.T) {
+	l := newTestLedger(t, "spawn:project", "invoke:project.migrate")
+
+	instID, err := addProject(l, "n", "d")
+	require.NoError(t, err)
 
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
+	err = l.send(invokeInstruction(instID, ProjectContractID, MigrateAction, nil))
+	require.NoError(t, err)
 
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project", "delete:project"},
-		signer.Identity())
+	resp, err := l.cl.GetProofFromLatest(instID.Slice())
 	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
 
-	genesisMsg.BlockInterval = time.Second
+	_, val, _, _, _ := resp.Proof.KeyValue()
 
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	version, _, err := decodeVersioned(val)
 	require.NoError(t, err)
+	require.Equal(t, ProjectVersion, version)
 
-	ctx, err := addProject(t, "n", "d", gDarc, signer, cl)
+	project, err := DecodeProjectContract(val)
 	require.NoError(t, err)
+	require.Equal(t, "n", project.Name)
+	require.Equal(t, "d", project.Description)
+}
 
-	instID := ctx.Instructions[0].DeriveID("")
+// delete instruction should return an error
+func TestProject_Delete(t *testing.T) {
+	l := newTestLedger(t, "spawn:project", "delete:project")
+
+	instID, err := addProject(l, "n", "d")
+	require.NoError(t, err)
 
-	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
+	err = l.send(byzcoin.Instruction{
 		InstanceID: instID,
 		Delete: &byzcoin.Delete{
 			ContractID: ProjectContractID,
 			Args:       byzcoin.Arguments{{}},
 		},
-		SignerCounter: []uint64{2},
 	})
-	require.NoError(t, err)
-
-	err = ctx.FillSignersAndSignWith(signer)
-	require.NoError(t, err)
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
 	require.Error(t, err)
-
-	local.WaitDone(genesisMsg.BlockInterval)
 }
 
 // -----------------------------------------------------------------------------
 // Utility functions
 
-func addProject(t *testing.T, name, description string,
-	gDarc *darc.Darc, signer darc.Signer, cl *byzcoin.Client) (byzcoin.ClientTransaction, error) {
+func addProject(l *testLedger, name, description string) (byzcoin.InstanceID, error) {
+	return l.trySpawn(ProjectContractID, byzcoin.Arguments{{
+		Name:  ProjectDescriptionKey,
+		Value: []byte(description),
+	}, {
+		Name:  ProjectNameKey,
+		Value: []byte(name),
+	}})
+}
 
-	instruction := byzcoin.Instruction{
-		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
-		Spawn: &byzcoin.Spawn{
-			ContractID: ProjectContractID,
-			Args: []byzcoin.Argument{{
-				Name:  ProjectDescriptionKey,
-				Value: []byte(description),
-			}, {
-				Name:  ProjectNameKey,
-				Value: []byte(name),
-			}},
-		},
-		SignerCounter: []uint64{1},
-	}
+func getProjectState(t *testing.T, cl *byzcoin.Client, instID byzcoin.InstanceID) *ProjectContract {
+	resp, err := cl.GetProofFromLatest(instID.Slice())
+	require.NoError(t, err)
 
-	ctx, err := cl.CreateTransaction(instruction)
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	project, err := DecodeProjectContract(val)
 	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
 
-	_, err = cl.AddTransactionAndWait(ctx, 10)
-	return ctx, err
+	return project
 }
@@ -1,7 +1,14 @@
 package contracts
 
 import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ldsec/medchain/logging"
 	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
 	"go.dedis.ch/onet/v3/log"
 	"go.dedis.ch/protobuf"
 	"golang.org/x/xerrors"
@@ -12,7 +19,9 @@ import (
 // The query contract represents a request from a user to perform an action on a
 // project (dataset). This contract is spawned by the Project contract. The
 // project contract will set the "status" field to "pending" or "rejected"
-// when it spawns the contract, based on the project attributes.
+// when it spawns the contract, based on the project attributes. If datasets
+// with a custodian allow the query, the status is set to "awaitingApproval"
+// until every custodian approves the query.
 const QueryContractID = "query"
 
 const (
@@ -22,13 +31,22 @@ const (
 	QueryQueryIDKey         = "queryID"
 	QueryQueryDefinitionKey = "queryDefinition"
 	QueryStatusKey          = "status"
+	QueryDatasetIDKey       = "datasetID"
+	QueryIssuerKey          = "issuer"
+	QuerySubjectHashKey     = "subjectHash"
+
+	QueryUpdateAction  = "update"
+	QueryApproveAction = "approve"
+	QueryDenyAction    = "deny"
 
-	QueryUpdateAction = "update"
+	QueryRejectedStatus         = "rejected"
+	QueryPendingStatus          = "pending"
+	QuerySuccessStatus          = "successful"
+	QueryFailedStatus           = "failed"
+	QueryAwaitingApprovalStatus = "awaitingApproval"
 
-	QueryRejectedStatus = "rejected"
-	QueryPendingStatus  = "pending"
-	QuerySuccessStatus  = "successful"
-	QueryFailedStatus   = "failed"
+	ApprovalApproved = "approved"
+	ApprovalDenied   = "denied"
 )
 
 func init() {
@@ -38,16 +56,71 @@ func init() {
 	}
 }
 
+// QueryVersion is the current version of the query contract format.
+//
+//   - 0: states stored before versioning, where ProjectID holds the name of the
+//     project
+//   - 1: ProjectID holds the project's instance ID and ProjectName its name
+//   - 2: queries store the datasets they are authorized on
+//   - 3: queries store the approvals of the datasets' custodians
+//   - 4: queries store the issuer and subject hash of the token used to submit
+//     them through the gateway
+//   - 5: queries store the consent rules that refused them on datasets
+//   - 6: queries reference the attestation of the project's data use agreement
+//     by the user
+//   - 7: queries store why they were rejected when spawned
+const QueryVersion = 7
+
 // queryContractFromBytes unmarshals a contract
 func queryContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	c, err := DecodeQueryContract(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode: %v", err)
+	}
+
+	return *c, nil
+}
+
+// DecodeQueryContract decodes the state of a query instance. States stored
+// with an older version are upgraded to the latest version.
+func DecodeQueryContract(in []byte) (*QueryContract, error) {
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version > QueryVersion {
+		return nil, xerrors.Errorf("unknown query version: %d", version)
+	}
+
 	var c QueryContract
 
-	err := protobuf.Decode(in, &c)
+	err = protobuf.Decode(data, &c)
 	if err != nil {
-		return nil, xerrors.Errorf("failed to decode: %v", err)
+		return nil, xerrors.Errorf("failed to decode query: %v", err)
+	}
+
+	if version == 0 {
+		// The instance ID of the project can't be recovered from the state
+		// only. It must be provided with the migrate command.
+		c.ProjectName = c.ProjectID
+		c.ProjectID = ""
 	}
 
-	return c, nil
+	return &c, nil
+}
+
+// NewQueryInstanceID returns the instance ID of the query identified by queryID
+// on the given project. Queries are stored at a deterministic location so that
+// anyone knowing the project and the queryID, like a data node that only got
+// the queryID from i2b2, can find the query instance.
+func NewQueryInstanceID(projectID byzcoin.InstanceID, queryID string) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(QueryContractID))
+	h.Write(projectID.Slice())
+	h.Write([]byte(queryID))
+
+	return byzcoin.NewInstanceID(h.Sum(nil))
 }
 
 // QueryContract is a contract that represents a user query.
@@ -58,18 +131,69 @@ type QueryContract struct {
 
 	Description string
 
-	UserID          string
+	UserID string
+	// ProjectID is the hex-encoded instance ID of the project that spawned
+	// the query.
 	ProjectID       string
 	QueryID         string
 	QueryDefinition string
 
 	Status string
+
+	// ProjectName is the name of the project at the time the query was
+	// spawned. It is only meant to be displayed, use ProjectID to reference
+	// the project.
+	ProjectName string
+	// Datasets are the hex-encoded instance IDs of the project's datasets that
+	// allow the query.
+	Datasets []string
+	// Approvals are the decisions of the custodians of the datasets.
+	Approvals Approvals
+	// Issuer is the issuer of the token that authenticated the user, when the
+	// query is submitted through the gateway. It is asserted by the identity
+	// that signed the spawn, which must be registered for the user.
+	Issuer string
+	// SubjectHash is the hex-encoded SHA-256 of the token's subject, so that
+	// the query can be linked to the user's account without disclosing it.
+	SubjectHash string
+	// ConsentRefusals are the consent rules that refused the query on
+	// datasets of the project allowing it.
+	ConsentRefusals ConsentRefusals
+	// Attestation is the hex-encoded instance ID of the user's attestation of
+	// the project's data use agreement, if the project has one.
+	Attestation string
+	// RejectionReason explains why the project rejected the query when it was
+	// spawned. It is empty for the queries not rejected at spawn.
+	RejectionReason string
 }
 
 // VerifyInstruction implements byzcoin.Contract
 func (c QueryContract) VerifyInstruction(rst byzcoin.ReadOnlyStateTrie,
 	inst byzcoin.Instruction, ctxHash []byte) error {
 
+	if inst.GetType() == byzcoin.InvokeType {
+		switch inst.Invoke.Command {
+		case MigrateAction:
+			// the migration is an admin operation, guarded by the DARC
+			return inst.Verify(rst, ctxHash)
+		case QueryApproveAction, QueryDenyAction:
+			// only the custodian of the dataset can decide
+			datasetID := byzcoin.NewInstanceID(inst.Invoke.Args.Search(QueryDatasetIDKey))
+
+			approval := c.Approvals.Find(datasetID.String())
+			if approval == nil {
+				return xerrors.Errorf("no approval expected for dataset %s", datasetID)
+			}
+
+			custodian, err := darc.ParseIdentity(approval.Custodian)
+			if err != nil {
+				return xerrors.Errorf("invalid custodian identity: %v", err)
+			}
+
+			return verifySignedBy(rst, inst, ctxHash, custodian)
+		}
+	}
+
 	// TODO: who is allowed to invoke:update a query ???
 	return nil
 }
@@ -85,18 +209,39 @@ func (c QueryContract) Spawn(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruc
 func (c QueryContract) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
 	coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
 
-	if inst.Invoke.Command != QueryUpdateAction {
-		return nil, nil, xerrors.Errorf("only the update action is allowed")
-	}
+	defer observe(QueryContractID, inst, time.Now())
 
-	status := string(inst.Arguments().Search(QueryStatusKey))
-	if status != QuerySuccessStatus && status != QueryFailedStatus {
-		return nil, nil, xerrors.Errorf("invalid status: %s", status)
-	}
+	switch inst.Invoke.Command {
+	case QueryUpdateAction:
+		status := string(inst.Arguments().Search(QueryStatusKey))
+		if status != QuerySuccessStatus && status != QueryFailedStatus {
+			return nil, nil, xerrors.Errorf("invalid status: %s", status)
+		}
+
+		if c.Status == QueryAwaitingApprovalStatus {
+			return nil, nil, xerrors.New("query is awaiting custodians' approval")
+		}
 
-	c.Status = status
+		c.Status = status
+	case QueryApproveAction, QueryDenyAction:
+		err := c.decide(rst, inst)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to record decision: %v", err)
+		}
+	case MigrateAction:
+		// the state is already upgraded by the decoder, except for the link to
+		// the project that must be provided for version 0 states.
+		if c.ProjectID == "" {
+			err := c.linkProject(rst, inst.Arguments().Search(QueryProjectIDKey))
+			if err != nil {
+				return nil, nil, xerrors.Errorf("failed to link project: %v", err)
+			}
+		}
+	default:
+		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
+	}
 
-	buf, err := protobuf.Encode(&c)
+	buf, err := c.encode()
 	if err != nil {
 		return nil, nil, xerrors.Errorf("failed to encode query: %v", err)
 	}
@@ -107,7 +252,7 @@ func (c QueryContract) Invoke(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instru
 	}
 
 	sc := byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
-		ProjectContractID, buf, darcID)
+		QueryContractID, buf, darcID)
 
 	return []byzcoin.StateChange{sc}, coins, nil
 }
@@ -118,3 +263,210 @@ func (c QueryContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction
 
 	return nil, nil, xerrors.Errorf("delete not allowed in query contract")
 }
+
+// decide records the approval or the denial of a dataset's custodian. A denial
+// rejects the query, and the query becomes pending once every custodian
+// approved it.
+func (c *QueryContract) decide(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction) error {
+	if c.Status != QueryAwaitingApprovalStatus {
+		return xerrors.Errorf("query is not awaiting approval: %s", c.Status)
+	}
+
+	datasetID := byzcoin.NewInstanceID(inst.Invoke.Args.Search(QueryDatasetIDKey))
+
+	approval := c.Approvals.Find(datasetID.String())
+	if approval == nil {
+		return xerrors.Errorf("no approval expected for dataset %s", datasetID)
+	}
+
+	if approval.Decision != "" {
+		return xerrors.Errorf("custodian already decided: %s", approval.Decision)
+	}
+
+	approval.Index = rst.GetIndex()
+
+	if inst.Invoke.Command == QueryDenyAction {
+		approval.Decision = ApprovalDenied
+		c.Status = QueryRejectedStatus
+
+		logging.Decision(QueryContractID, inst, byzcoin.InstanceID{}, "query "+c.Status,
+			fmt.Sprintf("denied by the custodian of dataset %s", datasetID))
+
+		return nil
+	}
+
+	approval.Decision = ApprovalApproved
+
+	if c.Approvals.AllApproved() {
+		c.Status = QueryPendingStatus
+	}
+
+	logging.Decision(QueryContractID, inst, byzcoin.InstanceID{}, "query "+c.Status,
+		fmt.Sprintf("approved by the custodian of dataset %s", datasetID))
+
+	return nil
+}
+
+// linkProject sets the project of the query to the given project instance ID,
+// after checking that this project has the name stored on the query.
+func (c *QueryContract) linkProject(rst byzcoin.ReadOnlyStateTrie, projectID []byte) error {
+	if len(projectID) == 0 {
+		return xerrors.Errorf("argument '%s' is missing", QueryProjectIDKey)
+	}
+
+	buf, _, contractID, _, err := rst.GetValues(projectID)
+	if err != nil {
+		return xerrors.Errorf("failed to get project: %v", err)
+	}
+
+	if contractID != ProjectContractID {
+		return xerrors.Errorf("instance is not a project: %s", contractID)
+	}
+
+	project, err := DecodeProjectContract(buf)
+	if err != nil {
+		return xerrors.Errorf("failed to decode project: %v", err)
+	}
+
+	if project.Name != c.ProjectName {
+		return xerrors.Errorf("project name mismatch: '%s' != '%s'",
+			project.Name, c.ProjectName)
+	}
+
+	c.ProjectID = byzcoin.NewInstanceID(projectID).String()
+
+	return nil
+}
+
+// encode encodes the query with the latest version.
+func (c QueryContract) encode() ([]byte, error) {
+	return encodeVersioned(QueryVersion, &c)
+}
+
+func (c QueryContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- Query")
+	fmt.Fprintf(out, "-- QueryID: %s\n", c.QueryID)
+	fmt.Fprintf(out, "-- Description: %s\n", c.Description)
+	fmt.Fprintf(out, "-- UserID: %s\n", c.UserID)
+	fmt.Fprintf(out, "-- ProjectID: %s\n", c.ProjectID)
+	fmt.Fprintf(out, "-- ProjectName: %s\n", c.ProjectName)
+	fmt.Fprintf(out, "-- QueryDefinition: %s\n", c.QueryDefinition)
+	fmt.Fprintf(out, "-- Status: %s\n", c.Status)
+	fmt.Fprintf(out, "-- Datasets: %v\n", c.Datasets)
+	fmt.Fprintf(out, "-- Approvals:\n%s", c.Approvals)
+
+	if len(c.ConsentRefusals) != 0 {
+		fmt.Fprintf(out, "-- ConsentRefusals:\n%s", c.ConsentRefusals)
+	}
+
+	if c.Attestation != "" {
+		fmt.Fprintf(out, "-- Attestation: %s\n", c.Attestation)
+	}
+
+	if c.RejectionReason != "" {
+		fmt.Fprintf(out, "-- RejectionReason: %s\n", c.RejectionReason)
+	}
+
+	if c.Issuer != "" {
+		fmt.Fprintf(out, "-- Issuer: %s\n", c.Issuer)
+		fmt.Fprintf(out, "-- SubjectHash: %s\n", c.SubjectHash)
+	}
+
+	return out.String()
+}
+
+// Approvals defines the list of approvals of a query.
+type Approvals []*Approval
+
+// Find searches for the approval of a dataset and returns nil if not found.
+func (a Approvals) Find(datasetID string) *Approval {
+	for _, approval := range a {
+		if approval.DatasetID == datasetID {
+			return approval
+		}
+	}
+
+	return nil
+}
+
+// AllApproved tells if every custodian approved the query.
+func (a Approvals) AllApproved() bool {
+	for _, approval := range a {
+		if approval.Decision != ApprovalApproved {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String produces a text representation of Approvals
+func (a Approvals) String() string {
+	out := new(strings.Builder)
+
+	for i, approval := range a {
+		fmt.Fprintf(out, "- approval %d:\n%s", i, approval)
+	}
+
+	return out.String()
+}
+
+// Approval defines the decision of a dataset's custodian on a query.
+type Approval struct {
+	// DatasetID is the hex-encoded instance ID of the dataset.
+	DatasetID string
+	// Custodian is the DARC identity of the dataset's custodian.
+	Custodian string
+	// Decision is empty as long as the custodian didn't decide.
+	Decision string
+	// Index is the index of the block in which the decision was taken.
+	Index int
+}
+
+// String produces a text representation of an Approval.
+func (a Approval) String() string {
+	out := new(strings.Builder)
+
+	fmt.Fprintf(out, "- DatasetID: %s\n", a.DatasetID)
+	fmt.Fprintf(out, "- Custodian: %s\n", a.Custodian)
+	fmt.Fprintf(out, "- Decision: %s\n", a.Decision)
+	fmt.Fprintf(out, "- Index: %d\n", a.Index)
+
+	return out.String()
+}
+
+// ConsentRefusals defines the list of consent refusals of a query.
+type ConsentRefusals []*ConsentRefusal
+
+// String produces a text representation of ConsentRefusals
+func (r ConsentRefusals) String() string {
+	out := new(strings.Builder)
+
+	for i, refusal := range r {
+		fmt.Fprintf(out, "- refusal %d:\n%s", i, refusal)
+	}
+
+	return out.String()
+}
+
+// ConsentRefusal is a consent rule that refused the query on a dataset.
+type ConsentRefusal struct {
+	// DatasetID is the hex-encoded instance ID of the dataset.
+	DatasetID string
+	// ConsentID is the hex-encoded instance ID of the consent of the dataset.
+	ConsentID string
+	// Category is the category of the rule that refused the query.
+	Category string
+}
+
+// String produces a text representation of a ConsentRefusal.
+func (r ConsentRefusal) String() string {
+	out := new(strings.Builder)
+
+	fmt.Fprintf(out, "- DatasetID: %s\n", r.DatasetID)
+	fmt.Fprintf(out, "- ConsentID: %s\n", r.ConsentID)
+	fmt.Fprintf(out, "- Category: %s\n", r.Category)
+
+	return out.String()
+}
@@ -2,422 +2,334 @@ package contracts
 
 import (
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/require"
-	"go.dedis.ch/cothority/v3"
 	"go.dedis.ch/cothority/v3/byzcoin"
 	"go.dedis.ch/cothority/v3/darc"
-	"go.dedis.ch/onet/v3"
-	"go.dedis.ch/protobuf"
 )
 
 // if there isn't the "spawn:query" DARC rule it shouldn't work
 func TestQuery_Spawn_No_Rule(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
-
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
-	require.NoError(t, err)
-
-	instruction := byzcoin.Instruction{
-		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
-		Spawn: &byzcoin.Spawn{
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryDescriptionKey,
-				Value: []byte("dec"),
-			}, {
-				Name:  QueryUserIDKey,
-				Value: []byte("userID"),
-			}, {
-				Name:  QueryProjectIDKey,
-				Value: []byte("projectID"),
-			}, {
-				Name:  QueryQueryIDKey,
-				Value: []byte("queryID"),
-			}, {
-				Name:  QueryQueryDefinitionKey,
-				Value: []byte("queryDef"),
-			}, {
-				Name:  QueryStatusKey,
-				Value: []byte("status"),
-			}},
-		},
-		SignerCounter: []uint64{1},
-	}
-
-	ctx, err := cl.CreateTransaction(instruction)
-	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	l := newTestLedger(t)
+
+	err := l.send(spawnInstruction(byzcoin.NewInstanceID(l.gDarc.GetBaseID()), QueryContractID,
+		byzcoin.Arguments{{
+			Name:  QueryDescriptionKey,
+			Value: []byte("dec"),
+		}, {
+			Name:  QueryUserIDKey,
+			Value: []byte("userID"),
+		}, {
+			Name:  QueryProjectIDKey,
+			Value: []byte("projectID"),
+		}, {
+			Name:  QueryQueryIDKey,
+			Value: []byte("queryID"),
+		}, {
+			Name:  QueryQueryDefinitionKey,
+			Value: []byte("queryDef"),
+		}, {
+			Name:  QueryStatusKey,
+			Value: []byte("status"),
+		}}))
 	require.Error(t, err)
 }
 
 // Using a project instance to spawn a query instance. Must be rejected since
 // the user is not authorized.
 func TestQuery_Spawn_With_Project_Rejected(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project"}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
-
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
-	require.NoError(t, err)
+	l := newTestLedger(t, "spawn:user", "spawn:project")
 
 	projectName := "name"
 
-	ctx, err := addProject(t, projectName, "d", gDarc, signer, cl)
+	projectInstID, err := addProject(l, projectName, "d")
 	require.NoError(t, err)
 
-	projectInstID := ctx.Instructions[0].DeriveID("")
-
-	instruction := byzcoin.Instruction{
-		// that's the key part, where we provide the instanceID of the project
-		// instance we just spawned. This instance will spawn the query.
-		InstanceID: projectInstID,
-		Spawn: &byzcoin.Spawn{
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryDescriptionKey,
-				Value: []byte("desc"),
-			}, {
-				Name:  QueryUserIDKey,
-				Value: []byte("userID"),
-			}, {
-				Name:  QueryQueryIDKey,
-				Value: []byte("queryID"),
-			}, {
-				Name:  QueryQueryDefinitionKey,
-				Value: []byte("queryDef"),
-			}},
-		},
-		SignerCounter: []uint64{2},
-	}
-
-	ctx, err = cl.CreateTransaction(instruction)
-	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	_, err = addUser(l, "userID", l.signer.Identity())
 	require.NoError(t, err)
 
-	queryInstID := ctx.Instructions[0].DeriveID("")
-
-	resp, err := cl.GetProofFromLatest(queryInstID.Slice())
+	// that's the key part, where we provide the instanceID of the project
+	// instance we just spawned. This instance will spawn the query.
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
 	require.NoError(t, err)
 
-	_, val, _, _, _ := resp.Proof.KeyValue()
-	query := QueryContract{}
-
-	err = protobuf.Decode(val, &query)
-	require.NoError(t, err)
+	query := getQuery(t, l.cl, NewQueryInstanceID(projectInstID, "queryID"))
 
 	require.Equal(t, "desc", query.Description)
 	require.Equal(t, "userID", query.UserID)
-	require.Equal(t, projectName, query.ProjectID)
+	require.Equal(t, projectInstID.String(), query.ProjectID)
+	require.Equal(t, projectName, query.ProjectName)
 	require.Equal(t, "queryID", query.QueryID)
 	require.Equal(t, "queryDef", query.QueryDefinition)
 	require.Equal(t, QueryRejectedStatus, query.Status)
-
-	local.WaitDone(genesisMsg.BlockInterval)
 }
 
 // We use a project to spawn a query instance. We add the user ID in the project
 // authorization so the query should be accepted.
 func TestQuery_Spawn_With_Project_Pending(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
-
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
-
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project", "invoke:project.add"}, signer.Identity())
-	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
-
-	genesisMsg.BlockInterval = time.Second
-
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
-	require.NoError(t, err)
+	l := newTestLedger(t, "spawn:user", "spawn:project", "invoke:project.add")
 
 	projectName := "name"
 	userID := "userdID"
 	queryTerm := "queryTerm"
 
-	ctx, err := addProject(t, projectName, "d", gDarc, signer, cl)
+	projectInstID, err := addProject(l, projectName, "d")
 	require.NoError(t, err)
 
-	projectInstID := ctx.Instructions[0].DeriveID("")
-
-	ctx, err = cl.CreateTransaction(byzcoin.Instruction{
-		InstanceID: projectInstID,
-		Invoke: &byzcoin.Invoke{
-			ContractID: ProjectContractID,
-			Command:    "add",
-			Args: byzcoin.Arguments{{
-				Name:  ProjectUserIDKey,
-				Value: []byte(userID),
-			}, {
-				Name:  ProjectQueryTermKey,
-				Value: []byte(queryTerm),
-			}},
-		},
-		SignerCounter: []uint64{2},
-	})
+	_, err = addUser(l, userID, l.signer.Identity())
 	require.NoError(t, err)
 
-	err = ctx.FillSignersAndSignWith(signer)
+	err = l.send(grantUserInstruction(projectInstID, userID, queryTerm))
 	require.NoError(t, err)
 
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	// that's the key part, where we provide the instanceID of the project
+	// instance we just spawned. This instance will spawn the query.
+	err = l.send(queryInstruction(projectInstID, userID, "queryID", queryTerm))
 	require.NoError(t, err)
 
-	instruction := byzcoin.Instruction{
-		// that's the key part, where we provide the instanceID of the project
-		// instance we just spawned. This instance will spawn the query.
-		InstanceID: projectInstID,
-		Spawn: &byzcoin.Spawn{
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryDescriptionKey,
-				Value: []byte("desc"),
-			}, {
-				Name:  QueryUserIDKey,
-				Value: []byte(userID),
-			}, {
-				Name:  QueryQueryIDKey,
-				Value: []byte("queryID"),
-			}, {
-				Name:  QueryQueryDefinitionKey,
-				Value: []byte(queryTerm),
-			}},
-		},
-		SignerCounter: []uint64{3},
-	}
+	query := getQuery(t, l.cl, NewQueryInstanceID(projectInstID, "queryID"))
 
-	ctx, err = cl.CreateTransaction(instruction)
+	require.Equal(t, "desc", query.Description)
+	require.Equal(t, userID, query.UserID)
+	require.Equal(t, projectInstID.String(), query.ProjectID)
+	require.Equal(t, projectName, query.ProjectName)
+	require.Equal(t, "queryID", query.QueryID)
+	require.Equal(t, queryTerm, query.QueryDefinition)
+	require.Equal(t, QueryPendingStatus, query.Status)
+}
+
+// A queryID can be used only once per project, because the query instance ID
+// is derived from it.
+func TestQuery_Spawn_Duplicate_QueryID(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project")
+
+	projectInstID, err := addProject(l, "name", "d")
 	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
 
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	_, err = addUser(l, "userID", l.signer.Identity())
 	require.NoError(t, err)
 
-	queryInstID := ctx.Instructions[0].DeriveID("")
+	queryInstID := NewQueryInstanceID(projectInstID, "queryID")
 
-	resp, err := cl.GetProofFromLatest(queryInstID.Slice())
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
 	require.NoError(t, err)
 
-	_, val, _, _, _ := resp.Proof.KeyValue()
-	query := QueryContract{}
-
-	err = protobuf.Decode(val, &query)
+	resp, err := l.cl.GetProofFromLatest(queryInstID.Slice())
 	require.NoError(t, err)
+	require.True(t, resp.Proof.InclusionProof.Match(queryInstID.Slice()))
 
-	require.Equal(t, "desc", query.Description)
-	require.Equal(t, userID, query.UserID)
-	require.Equal(t, projectName, query.ProjectID)
-	require.Equal(t, "queryID", query.QueryID)
-	require.Equal(t, queryTerm, query.QueryDefinition)
-	require.Equal(t, QueryPendingStatus, query.Status)
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
+	require.Error(t, err)
 
-	local.WaitDone(genesisMsg.BlockInterval)
+	err = l.send(queryInstruction(projectInstID, "userID", "", "queryDef"))
+	require.Error(t, err)
 }
 
 // only QuerySuccessStatus and QueryFailedStatus are allowed
 func TestQuery_Invoke_Update_Wrong_Status(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
+	l := newTestLedger(t, "spawn:user", "spawn:project")
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
 
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
+	_, err = addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
 
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project"}, signer.Identity())
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
 	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
 
-	genesisMsg.BlockInterval = time.Second
+	queryInstID := NewQueryInstanceID(projectInstID, "queryID")
 
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	// update the status
+	err = l.send(updateInstruction(queryInstID, "wrong status"))
+	require.Error(t, err)
+}
+
+func TestQuery_Invoke_Update_Good_Status(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project")
+
+	projectInstID, err := addProject(l, "name", "d")
 	require.NoError(t, err)
 
-	projectName := "name"
+	_, err = addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
+
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
+	require.NoError(t, err)
+
+	queryInstID := NewQueryInstanceID(projectInstID, "queryID")
+
+	// update the status
+	err = l.send(updateInstruction(queryInstID, QuerySuccessStatus))
+	require.NoError(t, err)
 
-	ctx, err := addProject(t, projectName, "d", gDarc, signer, cl)
+	resp, err := l.cl.GetProofFromLatest(queryInstID.Slice())
 	require.NoError(t, err)
 
-	projectInstID := ctx.Instructions[0].DeriveID("")
+	_, _, contractID, _, _ := resp.Proof.KeyValue()
+	require.Equal(t, QueryContractID, contractID)
+
+	query := getQuery(t, l.cl, queryInstID)
+	require.Equal(t, QuerySuccessStatus, query.Status)
+}
 
-	instruction := byzcoin.Instruction{
-		// that's the key part, where we provide the instanceID of the project
-		// instance we just spawned. This instance will spawn the query.
-		InstanceID: projectInstID,
-		Spawn: &byzcoin.Spawn{
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryDescriptionKey,
-				Value: []byte("desc"),
-			}, {
-				Name:  QueryUserIDKey,
-				Value: []byte("userID"),
-			}, {
-				Name:  QueryQueryIDKey,
-				Value: []byte("queryID"),
-			}, {
-				Name:  QueryQueryDefinitionKey,
-				Value: []byte("queryDef"),
-			}},
-		},
-		SignerCounter: []uint64{2},
-	}
+// migrate is an admin operation that needs the "invoke:query.migrate" rule
+func TestQuery_Invoke_Migrate(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project")
 
-	ctx, err = cl.CreateTransaction(instruction)
+	projectInstID, err := addProject(l, "name", "d")
 	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
 
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	_, err = addUser(l, "userID", l.signer.Identity())
 	require.NoError(t, err)
 
-	queryInstID := ctx.Instructions[0].DeriveID("")
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
+	require.NoError(t, err)
 
-	// update the status
+	queryInstID := NewQueryInstanceID(projectInstID, "queryID")
 
-	instruction = byzcoin.Instruction{
-		// that's the key part, where we provide the instanceID of the project
-		// instance we just spawned. This instance will spawn the query.
-		InstanceID: queryInstID,
-		Invoke: &byzcoin.Invoke{
-			Command:    QueryUpdateAction,
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryStatusKey,
-				Value: []byte("wrong status"),
-			}},
-		},
-		SignerCounter: []uint64{3},
-	}
-
-	ctx, err = cl.CreateTransaction(instruction)
-	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
-
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	err = l.send(invokeInstruction(queryInstID, QueryContractID, MigrateAction, nil))
 	require.Error(t, err)
 
-	local.WaitDone(genesisMsg.BlockInterval)
-}
+	// add the rule on the DARC and try again
 
-func TestQuery_Invoke_Update_Good_Status(t *testing.T) {
-	local := onet.NewTCPTest(cothority.Suite)
-	defer local.CloseAll()
+	gDarc2 := l.gDarc.Copy()
+	require.NoError(t, gDarc2.EvolveFrom(l.gDarc))
+	require.NoError(t, gDarc2.Rules.AddRule("invoke:query.migrate",
+		[]byte(l.signer.Identity().String())))
 
-	signer := darc.NewSignerEd25519(nil, nil)
-	_, roster, _ := local.GenTree(3, true)
+	darcBuf, err := gDarc2.ToProto()
+	require.NoError(t, err)
 
-	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
-		[]string{"spawn:project"}, signer.Identity())
+	err = l.send(invokeInstruction(byzcoin.NewInstanceID(l.gDarc.GetBaseID()),
+		byzcoin.ContractDarcID, "evolve", byzcoin.Arguments{{
+			Name:  "darc",
+			Value: darcBuf,
+		}}))
 	require.NoError(t, err)
-	gDarc := &genesisMsg.GenesisDarc
 
-	genesisMsg.BlockInterval = time.Second
+	err = l.send(invokeInstruction(queryInstID, QueryContractID, MigrateAction, nil))
+	require.NoError(t, err)
 
-	cl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	resp, err := l.cl.GetProofFromLatest(queryInstID.Slice())
 	require.NoError(t, err)
 
-	projectName := "name"
+	_, _, contractID, _, _ := resp.Proof.KeyValue()
+	require.Equal(t, QueryContractID, contractID)
+
+	query := getQuery(t, l.cl, queryInstID)
+	require.Equal(t, projectInstID.String(), query.ProjectID)
+	require.Equal(t, "name", query.ProjectName)
+}
+
+// A query on datasets with custodians awaits their approval. It becomes pending
+// once every custodian approved, and rejected as soon as one denies.
+func TestQuery_Custodian_Approval(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project", "spawn:dataset", "invoke:project.add",
+		"invoke:project.addDataset")
+
+	custodian1 := darc.NewSignerEd25519(nil, nil)
+	custodian2 := darc.NewSignerEd25519(nil, nil)
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
 
-	ctx, err := addProject(t, projectName, "d", gDarc, signer, cl)
+	_, err = addUser(l, "userID", l.signer.Identity())
 	require.NoError(t, err)
 
-	projectInstID := ctx.Instructions[0].DeriveID("")
+	dataset1, err := addDataset(l, "queryDef", custodian1.Identity().String())
+	require.NoError(t, err)
+
+	dataset2, err := addDataset(l, "queryDef", custodian2.Identity().String())
+	require.NoError(t, err)
 
-	instruction := byzcoin.Instruction{
-		// that's the key part, where we provide the instanceID of the project
-		// instance we just spawned. This instance will spawn the query.
-		InstanceID: projectInstID,
-		Spawn: &byzcoin.Spawn{
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryDescriptionKey,
-				Value: []byte("desc"),
-			}, {
-				Name:  QueryUserIDKey,
-				Value: []byte("userID"),
-			}, {
-				Name:  QueryQueryIDKey,
-				Value: []byte("queryID"),
-			}, {
-				Name:  QueryQueryDefinitionKey,
-				Value: []byte("queryDef"),
-			}},
-		},
-		SignerCounter: []uint64{2},
-	}
+	err = l.send(
+		grantInstruction(projectInstID, "queryDef"),
+		addDatasetInstruction(projectInstID, dataset1),
+		addDatasetInstruction(projectInstID, dataset2),
+	)
+	require.NoError(t, err)
 
-	ctx, err = cl.CreateTransaction(instruction)
+	err = l.send(queryInstruction(projectInstID, "userID", "query1", "queryDef"))
 	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
 
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	err = l.send(queryInstruction(projectInstID, "userID", "query2", "queryDef"))
 	require.NoError(t, err)
 
-	queryInstID := ctx.Instructions[0].DeriveID("")
+	query1 := NewQueryInstanceID(projectInstID, "query1")
+	query2 := NewQueryInstanceID(projectInstID, "query2")
 
-	// update the status
+	query := getQuery(t, l.cl, query1)
+	require.Equal(t, QueryAwaitingApprovalStatus, query.Status)
+	require.Len(t, query.Approvals, 2)
+
+	// the query can't be updated while awaiting approval
+	err = l.send(updateInstruction(query1, QuerySuccessStatus))
+	require.Error(t, err)
 
-	instruction = byzcoin.Instruction{
-		// that's the key part, where we provide the instanceID of the project
-		// instance we just spawned. This instance will spawn the query.
-		InstanceID: queryInstID,
-		Invoke: &byzcoin.Invoke{
-			Command:    QueryUpdateAction,
-			ContractID: QueryContractID,
-			Args: []byzcoin.Argument{{
-				Name:  QueryStatusKey,
-				Value: []byte(QuerySuccessStatus),
-			}},
-		},
-		SignerCounter: []uint64{3},
-	}
+	// only the custodian of the dataset can approve
+	err = l.sendAs(custodian2, decideInstruction(query1, QueryApproveAction, dataset1))
+	require.Error(t, err)
 
-	ctx, err = cl.CreateTransaction(instruction)
+	// every signer must have a valid signature, so that the counter of an
+	// identity can't be incremented without its consent
+	ctx, err := l.cl.CreateTransaction(decideInstruction(query1, QueryApproveAction, dataset1))
 	require.NoError(t, err)
-	require.NoError(t, ctx.FillSignersAndSignWith(signer))
 
-	_, err = cl.AddTransactionAndWait(ctx, 10)
+	ctx.Instructions[0].SignerCounter = []uint64{1, 1}
+	require.NoError(t, ctx.FillSignersAndSignWith(custodian1, custodian2))
+
+	ctx.Instructions[0].Signatures[1] = make([]byte, len(ctx.Instructions[0].Signatures[1]))
+
+	_, err = l.cl.AddTransactionAndWait(ctx, 10)
+	require.Error(t, err)
+
+	err = l.sendAs(custodian1, decideInstruction(query1, QueryApproveAction, dataset1))
 	require.NoError(t, err)
 
-	resp, err := cl.GetProofFromLatest(queryInstID.Slice())
+	// a custodian decides only once
+	err = l.sendAs(custodian1, decideInstruction(query1, QueryDenyAction, dataset1))
+	require.Error(t, err)
+
+	query = getQuery(t, l.cl, query1)
+	require.Equal(t, QueryAwaitingApprovalStatus, query.Status)
+
+	err = l.sendAs(custodian2, decideInstruction(query1, QueryApproveAction, dataset2))
 	require.NoError(t, err)
 
-	_, val, _, _, _ := resp.Proof.KeyValue()
-	query := QueryContract{}
+	query = getQuery(t, l.cl, query1)
+	require.Equal(t, QueryPendingStatus, query.Status)
+	require.Equal(t, ApprovalApproved, query.Approvals.Find(dataset1.String()).Decision)
+	require.Equal(t, ApprovalApproved, query.Approvals.Find(dataset2.String()).Decision)
+	require.NotZero(t, query.Approvals.Find(dataset2.String()).Index)
 
-	err = protobuf.Decode(val, &query)
+	// a single denial rejects the query
+	err = l.sendAs(custodian2, decideInstruction(query2, QueryDenyAction, dataset2))
 	require.NoError(t, err)
 
-	require.Equal(t, QuerySuccessStatus, query.Status)
+	query = getQuery(t, l.cl, query2)
+	require.Equal(t, QueryRejectedStatus, query.Status)
+	require.Equal(t, ApprovalDenied, query.Approvals.Find(dataset2.String()).Decision)
+	require.Equal(t, "", query.Approvals.Find(dataset1.String()).Decision)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// updateInstruction updates the status of the query.
+func updateInstruction(queryID byzcoin.InstanceID, status string) byzcoin.Instruction {
+	return invokeInstruction(queryID, QueryContractID, QueryUpdateAction, byzcoin.Arguments{{
+		Name:  QueryStatusKey,
+		Value: []byte(status),
+	}})
+}
+
+// decideInstruction approves or denies the query for the dataset.
+func decideInstruction(queryID byzcoin.InstanceID, command string,
+	datasetID byzcoin.InstanceID) byzcoin.Instruction {
 
-	local.WaitDone(genesisMsg.BlockInterval)
+	return invokeInstruction(queryID, QueryContractID, command, byzcoin.Arguments{{
+		Name:  QueryDatasetIDKey,
+		Value: datasetID.Slice(),
+	}})
 }
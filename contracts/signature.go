@@ -0,0 +1,53 @@
+package contracts
+
+import (
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"golang.org/x/xerrors"
+)
+
+// verifySignedBy checks that the instruction is signed by the given identity,
+// and that every signer has a valid signature and signer counter. It is used
+// when the identity allowed to perform an action is stored on an instance
+// instead of being defined by a DARC rule. ByzCoin increments the counter of
+// every signer, so an unverified signer would let anyone invalidate the
+// pending transactions of another identity.
+func verifySignedBy(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	ctxHash []byte, identity darc.Identity) error {
+
+	if len(inst.SignerIdentities) != len(inst.Signatures) ||
+		len(inst.SignerIdentities) != len(inst.SignerCounter) {
+
+		return xerrors.New("lengths of the identities, signatures and counters " +
+			"do not match")
+	}
+
+	signed := false
+
+	for i, id := range inst.SignerIdentities {
+		counter, err := rst.GetSignerCounter(id)
+		if err != nil {
+			return xerrors.Errorf("failed to get counter: %v", err)
+		}
+
+		if inst.SignerCounter[i] != counter+1 {
+			return xerrors.Errorf("for %s, got counter=%d, but need %d", id,
+				inst.SignerCounter[i], counter+1)
+		}
+
+		err = id.Verify(ctxHash, inst.Signatures[i])
+		if err != nil {
+			return xerrors.Errorf("invalid signature of %s: %v", id, err)
+		}
+
+		if id.Equal(&identity) {
+			signed = true
+		}
+	}
+
+	if !signed {
+		return xerrors.Errorf("instruction not signed by %s", identity)
+	}
+
+	return nil
+}
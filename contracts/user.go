@@ -0,0 +1,304 @@
+package contracts
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// UserContractID is the name of the user Contract.
+//
+// The user contract is a registry that binds a UserID to the DARC identities
+// allowed to act as this user. A query can only be spawned by a transaction
+// signed by one of the identities registered for its UserID.
+const UserContractID = "user"
+
+const (
+	UserUserIDKey   = "userID"
+	UserIdentityKey = "identity"
+
+	UserAddIdentityAction    = "addIdentity"
+	UserRemoveIdentityAction = "removeIdentity"
+)
+
+// UserVersion is the current version of the user contract format.
+//
+//   - 1: first version
+const UserVersion = 1
+
+func init() {
+	err := byzcoin.RegisterGlobalContract(UserContractID, userContractFromBytes)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+}
+
+// userContractFromBytes unmarshals a contract
+func userContractFromBytes(in []byte) (byzcoin.Contract, error) {
+	return DecodeUserContract(in)
+}
+
+// DecodeUserContract decodes the state of a user instance. States stored with
+// an older version are upgraded to the latest version.
+func DecodeUserContract(in []byte) (*UserContract, error) {
+	// ByzCoin uses an empty instance to spawn new instances
+	if len(in) == 0 {
+		return &UserContract{}, nil
+	}
+
+	version, data, err := decodeVersioned(in)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode version: %v", err)
+	}
+
+	if version == 0 || version > UserVersion {
+		return nil, xerrors.Errorf("unknown user version: %d", version)
+	}
+
+	var c UserContract
+
+	err = protobuf.Decode(data, &c)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode user: %v", err)
+	}
+
+	return &c, nil
+}
+
+// NewUserInstanceID returns the instance ID of the user with the given UserID.
+// Users are stored at a deterministic location so that the project contract
+// can find them from the UserID of a query.
+func NewUserInstanceID(userID string) byzcoin.InstanceID {
+	h := sha256.New()
+	h.Write([]byte(UserContractID))
+	h.Write([]byte(userID))
+
+	return byzcoin.NewInstanceID(h.Sum(nil))
+}
+
+// UserContract is a smart contract that binds a UserID to DARC identities.
+//
+// - implements byzcoin.Contract
+type UserContract struct {
+	byzcoin.BasicContract
+
+	UserID string
+	// Identities are the DARC identities allowed to act as the user, for
+	// example "ed25519:...".
+	Identities []string
+}
+
+// VerifyDeferredInstruction implements byzcoin.Contract.
+func (u UserContract) VerifyDeferredInstruction(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, ctxHash []byte) error {
+
+	opts := &byzcoin.VerificationOptions{IgnoreCounters: true}
+	return inst.VerifyWithOption(rst, ctxHash, opts)
+}
+
+// Spawn implements byzcoin.Contract.
+func (u UserContract) Spawn(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(UserContractID, inst, time.Now())
+
+	var darcID darc.ID
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	userID := string(inst.Spawn.Args.Search(UserUserIDKey))
+	if userID == "" {
+		return nil, nil, xerrors.Errorf("userID is missing")
+	}
+
+	userInstID := NewUserInstanceID(userID)
+
+	proof, err := rst.GetProof(userInstID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get proof: %v", err)
+	}
+
+	exists, err := proof.Exists(userInstID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to check user existence: %v", err)
+	}
+
+	if exists {
+		return nil, nil, xerrors.Errorf("user '%s' already exists", userID)
+	}
+
+	state := UserContract{
+		UserID:     userID,
+		Identities: make([]string, 0),
+	}
+
+	err = state.addIdentities(string(inst.Spawn.Args.Search(UserIdentityKey)))
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to add identities: %v", err)
+	}
+
+	buf, err := state.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Create, userInstID, UserContractID,
+		buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Invoke implements byzcoin.Contract.
+func (u UserContract) Invoke(rst byzcoin.ReadOnlyStateTrie,
+	inst byzcoin.Instruction, coins []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	defer observe(UserContractID, inst, time.Now())
+
+	_, _, _, darcID, err := rst.GetValues(inst.InstanceID.Slice())
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get DARC: %v", err)
+	}
+
+	identity := string(inst.Arguments().Search(UserIdentityKey))
+
+	switch inst.Invoke.Command {
+	case UserAddIdentityAction:
+		err = u.addIdentities(identity)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("failed to add identities: %v", err)
+		}
+	case UserRemoveIdentityAction:
+		u.removeIdentity(identity)
+	case MigrateAction:
+		// the state is already upgraded by the decoder, we only need to store
+		// it back with the latest version.
+	default:
+		return nil, nil, xerrors.Errorf("wrong command: %s", inst.Invoke.Command)
+	}
+
+	buf, err := u.encode()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to marshal user: %v", err)
+	}
+
+	sc := byzcoin.NewStateChange(byzcoin.Update, inst.InstanceID,
+		UserContractID, buf, darcID)
+
+	return []byzcoin.StateChange{sc}, coins, nil
+}
+
+// Delete implements byzcoin.Contract
+func (u UserContract) Delete(_ byzcoin.ReadOnlyStateTrie, _ byzcoin.Instruction,
+	_ []byzcoin.Coin) ([]byzcoin.StateChange, []byzcoin.Coin, error) {
+
+	return nil, nil, xerrors.Errorf("delete not allowed in user contract, " +
+		"remove its identities instead")
+}
+
+// HasIdentity tells if the identity is registered for the user. The
+// identities are compared in their canonical form.
+func (u UserContract) HasIdentity(identity string) bool {
+	identity = canonicalIdentity(identity)
+
+	for _, id := range u.Identities {
+		if canonicalIdentity(id) == identity {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encode encodes the user with the latest version.
+func (u UserContract) encode() ([]byte, error) {
+	return encodeVersioned(UserVersion, &u)
+}
+
+func (u UserContract) String() string {
+	out := new(strings.Builder)
+	fmt.Fprintln(out, "- User")
+	fmt.Fprintf(out, "-- UserID: %s\n", u.UserID)
+	fmt.Fprintf(out, "-- Identities: %v\n", u.Identities)
+
+	return out.String()
+}
+
+// addIdentities adds the identities, which can be a coma separated list of
+// identities: ed25519:..., ed25519:...
+func (u *UserContract) addIdentities(identities string) error {
+	for _, identity := range strings.Split(identities, ",") {
+		identity = strings.TrimSpace(identity)
+		if identity == "" || u.HasIdentity(identity) {
+			continue
+		}
+
+		parsed, err := darc.ParseIdentity(identity)
+		if err != nil {
+			return xerrors.Errorf("invalid identity '%s': %v", identity, err)
+		}
+
+		// the signers are matched with the canonical form of their identity
+		u.Identities = append(u.Identities, parsed.String())
+	}
+
+	return nil
+}
+
+func (u *UserContract) removeIdentity(identity string) {
+	identity = canonicalIdentity(identity)
+
+	for i, id := range u.Identities {
+		if canonicalIdentity(id) == identity {
+			u.Identities = append(u.Identities[:i], u.Identities[i+1:]...)
+			return
+		}
+	}
+}
+
+// canonicalIdentity returns the canonical form of the identity, or the
+// identity itself when it can't be parsed.
+func canonicalIdentity(identity string) string {
+	parsed, err := darc.ParseIdentity(strings.TrimSpace(identity))
+	if err != nil {
+		return identity
+	}
+
+	return parsed.String()
+}
+
+// verifyUser checks that the instruction is signed by one of the identities
+// registered for the user.
+func verifyUser(rst byzcoin.ReadOnlyStateTrie, inst byzcoin.Instruction,
+	ctxHash []byte, userID string) error {
+
+	buf, _, contractID, _, err := rst.GetValues(NewUserInstanceID(userID).Slice())
+	if err != nil {
+		return xerrors.Errorf("user '%s' is not registered: %v", userID, err)
+	}
+
+	if contractID != UserContractID {
+		return xerrors.Errorf("instance is not a user: %s", contractID)
+	}
+
+	user, err := DecodeUserContract(buf)
+	if err != nil {
+		return xerrors.Errorf("failed to decode user: %v", err)
+	}
+
+	for _, id := range inst.SignerIdentities {
+		if user.HasIdentity(id.String()) {
+			return verifySignedBy(rst, inst, ctxHash, id)
+		}
+	}
+
+	return xerrors.Errorf("instruction not signed by user '%s'", userID)
+}
@@ -0,0 +1,115 @@
+package contracts
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+)
+
+func TestUser_Spawn_Invoke(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "invoke:user.addIdentity", "invoke:user.removeIdentity")
+
+	other := darc.NewSignerEd25519(nil, nil)
+
+	_, err := addUser(l, "userID", l.signer.Identity())
+	require.NoError(t, err)
+
+	// a UserID can be registered only once
+	_, err = addUser(l, "userID", other.Identity())
+	require.Error(t, err)
+
+	userInstID := NewUserInstanceID("userID")
+
+	err = l.send(
+		invokeInstruction(userInstID, UserContractID, UserAddIdentityAction, byzcoin.Arguments{{
+			Name:  UserIdentityKey,
+			Value: []byte(other.Identity().String()),
+		}}),
+		invokeInstruction(userInstID, UserContractID, UserRemoveIdentityAction, byzcoin.Arguments{{
+			Name:  UserIdentityKey,
+			Value: []byte(l.signer.Identity().String()),
+		}}),
+	)
+	require.NoError(t, err)
+
+	resp, err := l.cl.GetProofFromLatest(userInstID.Slice())
+	require.NoError(t, err)
+
+	_, _, contractID, _, _ := resp.Proof.KeyValue()
+	require.Equal(t, UserContractID, contractID)
+
+	user := getUserState(t, l.cl, userInstID)
+	require.Equal(t, "userID", user.UserID)
+	require.Equal(t, []string{other.Identity().String()}, user.Identities)
+}
+
+// A query can only be spawned by an identity registered for its UserID.
+func TestUser_Query_Signature(t *testing.T) {
+	l := newTestLedger(t, "spawn:user", "spawn:project")
+
+	user := darc.NewSignerEd25519(nil, nil)
+
+	projectInstID, err := addProject(l, "name", "d")
+	require.NoError(t, err)
+
+	// the user is not registered yet
+	err = l.sendAs(user, queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
+	require.Error(t, err)
+
+	// an identity registered in a non-canonical form can sign
+	upper := "ed25519:" + strings.ToUpper(strings.TrimPrefix(user.Identity().String(), "ed25519:"))
+
+	userInstID, err := addUserIdentities(l, "userID", upper)
+	require.NoError(t, err)
+
+	// the admin can't claim to be the user
+	err = l.send(queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
+	require.Error(t, err)
+
+	err = l.sendAs(user, queryInstruction(projectInstID, "userID", "queryID", "queryDef"))
+	require.NoError(t, err)
+
+	query := getQuery(t, l.cl, NewQueryInstanceID(projectInstID, "queryID"))
+	require.Equal(t, "userID", query.UserID)
+
+	registered := getUserState(t, l.cl, userInstID)
+	require.Equal(t, []string{user.Identity().String()}, registered.Identities)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func addUser(l *testLedger, userID string, identity darc.Identity) (byzcoin.InstanceID, error) {
+	return addUserIdentities(l, userID, identity.String())
+}
+
+// addUserIdentities registers the user with a coma separated list of
+// identities. The instance ID of a user is derived from its UserID.
+func addUserIdentities(l *testLedger, userID, identities string) (byzcoin.InstanceID, error) {
+	_, err := l.trySpawn(UserContractID, byzcoin.Arguments{{
+		Name:  UserUserIDKey,
+		Value: []byte(userID),
+	}, {
+		Name:  UserIdentityKey,
+		Value: []byte(identities),
+	}})
+	if err != nil {
+		return byzcoin.InstanceID{}, err
+	}
+
+	return NewUserInstanceID(userID), nil
+}
+
+func getUserState(t *testing.T, cl *byzcoin.Client, instID byzcoin.InstanceID) *UserContract {
+	resp, err := cl.GetProofFromLatest(instID.Slice())
+	require.NoError(t, err)
+
+	_, val, _, _, _ := resp.Proof.KeyValue()
+	user, err := DecodeUserContract(val)
+	require.NoError(t, err)
+
+	return user
+}
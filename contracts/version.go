@@ -0,0 +1,57 @@
+package contracts
+
+import (
+	"bytes"
+
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// MigrateAction is the invoke command, on both the project and the query
+// contracts, that rewrites an instance with the latest version of its format.
+const MigrateAction = "migrate"
+
+// versionMagic prefixes the encoded contract states. It can't be the start of
+// a protobuf message since 0xff encodes an invalid wire type, which is how we
+// tell versioned states apart from the states stored before versioning was
+// introduced. Those are considered as version 0.
+var versionMagic = []byte{0xff, 'm', 'c'}
+
+// versionedState is the envelope of a contract state. Data is the protobuf
+// encoding of the contract at the given version.
+type versionedState struct {
+	Version int
+	Data    []byte
+}
+
+// encodeVersioned encodes a contract state in a versioned envelope.
+func encodeVersioned(version int, state interface{}) ([]byte, error) {
+	data, err := protobuf.Encode(state)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode state: %v", err)
+	}
+
+	buf, err := protobuf.Encode(&versionedState{Version: version, Data: data})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode envelope: %v", err)
+	}
+
+	return append(append([]byte{}, versionMagic...), buf...), nil
+}
+
+// decodeVersioned returns the version and the data of an encoded contract
+// state. States without an envelope are returned as version 0.
+func decodeVersioned(in []byte) (int, []byte, error) {
+	if !bytes.HasPrefix(in, versionMagic) {
+		return 0, in, nil
+	}
+
+	var state versionedState
+
+	err := protobuf.Decode(in[len(versionMagic):], &state)
+	if err != nil {
+		return 0, nil, xerrors.Errorf("failed to decode envelope: %v", err)
+	}
+
+	return state.Version, state.Data, nil
+}
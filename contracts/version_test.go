@@ -0,0 +1,274 @@
+package contracts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const fixtureInstanceID = "0102030405060708091011121314151617181920212223242526272829303132"
+
+// The fixtures contain the states of the project contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeProjectContract_Fixtures(t *testing.T) {
+	expected := ProjectContract{
+		Name:        "name",
+		Description: "desc",
+		Authorizations: Authorizations{
+			&Authorization{UserID: "userID", QueryTerms: []string{"q1", "q2"}},
+		},
+	}
+
+	withDatasets := expected
+	withDatasets.Datasets = []string{fixtureInstanceID}
+
+	withCatalog := withDatasets
+	withCatalog.Catalog = fixtureInstanceID
+
+	withDUA := withCatalog
+	withDUA.DUA = fixtureInstanceID
+
+	fixtures := map[string]ProjectContract{
+		"project_v0.bin": expected,
+		"project_v1.bin": expected,
+		"project_v2.bin": withDatasets,
+		"project_v3.bin": withCatalog,
+		"project_v4.bin": withDUA,
+	}
+
+	for fixture, expected := range fixtures {
+		project, err := DecodeProjectContract(readFixture(t, fixture))
+		require.NoError(t, err, fixture)
+		require.Equal(t, &expected, project, fixture)
+
+		// once re-encoded, the state is at the latest version
+		buf, err := project.encode()
+		require.NoError(t, err)
+
+		version, _, err := decodeVersioned(buf)
+		require.NoError(t, err)
+		require.Equal(t, ProjectVersion, version)
+	}
+}
+
+// The fixtures contain the states of the query contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeQueryContract_Fixtures(t *testing.T) {
+	expected := QueryContract{
+		Description:     "desc",
+		UserID:          "userID",
+		ProjectID:       fixtureInstanceID,
+		QueryID:         "queryID",
+		QueryDefinition: "q1",
+		Status:          QueryPendingStatus,
+		ProjectName:     "name",
+	}
+
+	// the first format stored the project's name in ProjectID
+	withoutProjectID := expected
+	withoutProjectID.ProjectID = ""
+
+	withDatasets := expected
+	withDatasets.Datasets = []string{fixtureInstanceID}
+
+	withApprovals := withDatasets
+	withApprovals.Approvals = Approvals{&Approval{
+		DatasetID: fixtureInstanceID,
+		Custodian: "ed25519:2dbe2bfd1ac0be7da2bf6b3e2fb2a1fb0b4d8e46ec1b2bb0fa9b9d4e0c1e9a5c",
+		Decision:  ApprovalApproved,
+		Index:     3,
+	}}
+
+	withIssuer := withApprovals
+	withIssuer.Issuer = "https://issuer.example"
+	withIssuer.SubjectHash = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	withRefusals := withIssuer
+	withRefusals.ConsentRefusals = ConsentRefusals{&ConsentRefusal{
+		DatasetID: fixtureInstanceID,
+		ConsentID: fixtureInstanceID,
+		Category:  "no-genetic-research",
+	}}
+
+	withAttestation := withRefusals
+	withAttestation.Attestation = fixtureInstanceID
+
+	withRejectionReason := withAttestation
+	withRejectionReason.Status = QueryRejectedStatus
+	withRejectionReason.RejectionReason = "user userID has not attested version 2 of the data use agreement"
+
+	fixtures := map[string]QueryContract{
+		"query_v0.bin": withoutProjectID,
+		"query_v1.bin": expected,
+		"query_v2.bin": withDatasets,
+		"query_v3.bin": withApprovals,
+		"query_v4.bin": withIssuer,
+		"query_v5.bin": withRefusals,
+		"query_v6.bin": withAttestation,
+		"query_v7.bin": withRejectionReason,
+	}
+
+	for fixture, expected := range fixtures {
+		query, err := DecodeQueryContract(readFixture(t, fixture))
+		require.NoError(t, err, fixture)
+		require.Equal(t, &expected, query, fixture)
+
+		buf, err := query.encode()
+		require.NoError(t, err)
+
+		version, _, err := decodeVersioned(buf)
+		require.NoError(t, err)
+		require.Equal(t, QueryVersion, version)
+	}
+}
+
+// The fixtures contain the states of the dataset contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeDatasetContract_Fixtures(t *testing.T) {
+	expected := &DatasetContract{
+		Name:        "name",
+		Description: "desc",
+		Institution: "inst",
+		QueryTerms:  []string{"q1", "q2"},
+		Custodian:   "ed25519:2dbe2bfd1ac0be7da2bf6b3e2fb2a1fb0b4d8e46ec1b2bb0fa9b9d4e0c1e9a5c",
+	}
+
+	dataset, err := DecodeDatasetContract(readFixture(t, "dataset_v1.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, dataset)
+
+	expected.Consent = fixtureInstanceID
+
+	dataset, err = DecodeDatasetContract(readFixture(t, "dataset_v2.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, dataset)
+
+	// datasets didn't exist before versioning
+	_, err = DecodeDatasetContract(readFixture(t, "project_v0.bin"))
+	require.EqualError(t, err, "unknown dataset version: 0")
+}
+
+// The fixtures contain the states of the user contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeUserContract_Fixtures(t *testing.T) {
+	expected := &UserContract{
+		UserID:     "userID",
+		Identities: []string{"ed25519:2dbe2bfd1ac0be7da2bf6b3e2fb2a1fb0b4d8e46ec1b2bb0fa9b9d4e0c1e9a5c"},
+	}
+
+	user, err := DecodeUserContract(readFixture(t, "user_v1.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, user)
+
+	// users didn't exist before versioning
+	_, err = DecodeUserContract(readFixture(t, "project_v0.bin"))
+	require.EqualError(t, err, "unknown user version: 0")
+}
+
+// The fixtures contain the states of the catalog contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeCatalogContract_Fixtures(t *testing.T) {
+	expected := &CatalogContract{
+		Name:        "name",
+		Description: "desc",
+		Terms: []*CatalogTerm{
+			{Term: "q1", Label: "Hypertension", Code: "SNOMED-CT:38341003"},
+			{Term: "q2"},
+		},
+	}
+
+	catalog, err := DecodeCatalogContract(readFixture(t, "catalog_v1.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, catalog)
+
+	// catalogs didn't exist before versioning
+	_, err = DecodeCatalogContract(readFixture(t, "project_v0.bin"))
+	require.EqualError(t, err, "unknown catalog version: 0")
+}
+
+// The fixtures contain the states of the consent contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeConsentContract_Fixtures(t *testing.T) {
+	expected := &ConsentContract{
+		Cohort: "cohort",
+		Rules: []*ConsentRule{
+			{Category: "no-genetic-research", Description: "desc", Forbidden: []string{"genetic"}},
+			{Category: "cardio-only", Permitted: []string{"q1", "q2"}},
+		},
+	}
+
+	consent, err := DecodeConsentContract(readFixture(t, "consent_v1.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, consent)
+
+	// consents didn't exist before versioning
+	_, err = DecodeConsentContract(readFixture(t, "project_v0.bin"))
+	require.EqualError(t, err, "unknown consent version: 0")
+}
+
+// The fixtures contain the states of the DUA contract for each historical
+// format. They must never be updated, only new ones added.
+func TestDecodeDUAContract_Fixtures(t *testing.T) {
+	expected := &DUAContract{
+		Name: "name",
+		Versions: []*AgreementVersion{
+			{Version: 1, Hash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", URL: "https://dua.example/v1", Index: 2},
+			{Version: 2, Hash: "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752", Index: 5},
+		},
+	}
+
+	dua, err := DecodeDUAContract(readFixture(t, "dua_v1.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, dua)
+
+	// agreements didn't exist before versioning
+	_, err = DecodeDUAContract(readFixture(t, "project_v0.bin"))
+	require.EqualError(t, err, "unknown dua version: 0")
+}
+
+// The fixtures contain the states of the attestation contract for each
+// historical format. They must never be updated, only new ones added.
+func TestDecodeAttestationContract_Fixtures(t *testing.T) {
+	expected := &AttestationContract{
+		DUAID:   fixtureInstanceID,
+		UserID:  "userID",
+		Version: 2,
+		Hash:    "60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752",
+		Index:   7,
+	}
+
+	attestation, err := DecodeAttestationContract(readFixture(t, "attestation_v1.bin"))
+	require.NoError(t, err)
+	require.Equal(t, expected, attestation)
+
+	// attestations didn't exist before versioning
+	_, err = DecodeAttestationContract(readFixture(t, "project_v0.bin"))
+	require.EqualError(t, err, "unknown attestation version: 0")
+}
+
+func TestDecodeVersioned_Unknown_Version(t *testing.T) {
+	buf, err := encodeVersioned(ProjectVersion+1, &ProjectContract{})
+	require.NoError(t, err)
+
+	_, err = DecodeProjectContract(buf)
+	require.EqualError(t, err, fmt.Sprintf("unknown project version: %d", ProjectVersion+1))
+
+	buf, err = encodeVersioned(QueryVersion+1, &QueryContract{})
+	require.NoError(t, err)
+
+	_, err = DecodeQueryContract(buf)
+	require.EqualError(t, err, fmt.Sprintf("unknown query version: %d", QueryVersion+1))
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+func readFixture(t *testing.T, name string) []byte {
+	buf, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+
+	return buf
+}
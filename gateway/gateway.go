@@ -0,0 +1,263 @@
+// Package gateway lets users authenticated by an OpenID Connect provider submit
+// queries without holding a ByzCoin key.
+//
+// The gateway validates the user's JWT against the configured issuers, maps
+// the token to a MedChain UserID, and spawns the query on the user's behalf
+// with its service key. The service key must therefore be registered as an
+// identity of the users the gateway acts for (see the user contract). The
+// issuer and a hash of the token's subject are recorded on the query.
+//
+// Since the service key acts for every user, each issuer is bound to the
+// UserIDs starting with its UserIDPrefix, so that an issuer can't submit
+// queries for the users of another one.
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Config is the configuration of the gateway.
+type Config struct {
+	Issuers []IssuerConfig
+}
+
+// IssuerConfig is the configuration of a trusted issuer.
+type IssuerConfig struct {
+	// URL is the issuer identifier, which must match the "iss" claim.
+	URL string
+	// JWKSURL is the location of the issuer's keys. If empty, it is discovered
+	// from the issuer's "/.well-known/openid-configuration".
+	JWKSURL string
+	// Audience, if set, must be in the "aud" claim of the tokens.
+	Audience string
+	// UserIDClaim is the claim holding the MedChain UserID, "sub" by default.
+	UserIDClaim string
+	// UserIDPrefix is the prefix of the UserIDs the issuer can act for. It
+	// can only be empty if the issuer is the only one configured.
+	UserIDPrefix string
+}
+
+// LoadConfig reads the gateway configuration from a TOML file.
+func LoadConfig(path string) (Config, error) {
+	var config Config
+
+	_, err := toml.DecodeFile(path, &config)
+	if err != nil {
+		return Config{}, xerrors.Errorf("failed to decode config: %v", err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return Config{}, xerrors.Errorf("invalid config: %v", err)
+	}
+
+	return config, nil
+}
+
+// Validate checks that there is at least one issuer, and that the UserIDs of
+// the issuers don't overlap: with several issuers, each needs a prefix which
+// is not the prefix of another one.
+func (c Config) Validate() error {
+	if len(c.Issuers) == 0 {
+		return xerrors.New("no issuer configured")
+	}
+
+	if len(c.Issuers) == 1 {
+		return nil
+	}
+
+	for i, issuer := range c.Issuers {
+		if issuer.UserIDPrefix == "" {
+			return xerrors.Errorf("issuer %s has no UserIDPrefix", issuer.URL)
+		}
+
+		for j, other := range c.Issuers {
+			if i != j && strings.HasPrefix(other.UserIDPrefix, issuer.UserIDPrefix) {
+				return xerrors.Errorf("UserIDs of issuers %s and %s overlap",
+					issuer.URL, other.URL)
+			}
+		}
+	}
+
+	return nil
+}
+
+// QueryRequest is a query submitted through the gateway.
+type QueryRequest struct {
+	// ProjectID is the hex-encoded instance ID of the project.
+	ProjectID       string `json:"projectID"`
+	QueryID         string `json:"queryID"`
+	QueryDefinition string `json:"queryDefinition"`
+	Description     string `json:"description"`
+}
+
+// QueryResponse is the response to a submitted query.
+type QueryResponse struct {
+	// InstanceID is the hex-encoded instance ID of the query.
+	InstanceID string `json:"instanceID"`
+	UserID     string `json:"userID"`
+}
+
+// Gateway submits queries on behalf of the users authenticated with a JWT.
+//
+// - implements http.Handler
+type Gateway struct {
+	verifier *Verifier
+	client   *client.Client
+	signer   darc.Signer
+
+	// sendLock serializes the transactions signed with the service key, as
+	// concurrent ones would read and use the same signer counter.
+	sendLock sync.Mutex
+}
+
+// NewGateway creates a gateway that signs the queries with the service key.
+func NewGateway(verifier *Verifier, cl *client.Client, signer darc.Signer) *Gateway {
+	return &Gateway{
+		verifier: verifier,
+		client:   cl,
+		signer:   signer,
+	}
+}
+
+// Submit validates the token and spawns the query for the user it maps to.
+func (g *Gateway) Submit(token string, req QueryRequest) (QueryResponse, error) {
+	claims, issuer, err := g.verifier.Verify(token)
+	if err != nil {
+		return QueryResponse{}, xerrors.Errorf("invalid token: %v", err)
+	}
+
+	return g.submit(claims, issuer, req)
+}
+
+// submit spawns the query for the user of the verified claims, if the issuer
+// can act for the user.
+func (g *Gateway) submit(claims *Claims, issuer IssuerConfig,
+	req QueryRequest) (QueryResponse, error) {
+
+	userIDClaim := issuer.UserIDClaim
+	if userIDClaim == "" {
+		userIDClaim = "sub"
+	}
+
+	userID := claims.Get(userIDClaim)
+	if userID == "" {
+		return QueryResponse{}, xerrors.Errorf("claim '%s' is missing", userIDClaim)
+	}
+
+	if !strings.HasPrefix(userID, issuer.UserIDPrefix) {
+		return QueryResponse{}, xerrors.Errorf("issuer %s can't act for user %s",
+			issuer.URL, userID)
+	}
+
+	projectID, err := client.ParseInstanceID(req.ProjectID)
+	if err != nil {
+		return QueryResponse{}, xerrors.Errorf("invalid project ID: %v", err)
+	}
+
+	g.sendLock.Lock()
+	defer g.sendLock.Unlock()
+
+	_, err = g.client.SendInstruction(byzcoin.Instruction{
+		InstanceID: projectID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.QueryContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.QueryDescriptionKey,
+				Value: []byte(req.Description),
+			}, {
+				Name:  contracts.QueryUserIDKey,
+				Value: []byte(userID),
+			}, {
+				Name:  contracts.QueryQueryIDKey,
+				Value: []byte(req.QueryID),
+			}, {
+				Name:  contracts.QueryQueryDefinitionKey,
+				Value: []byte(req.QueryDefinition),
+			}, {
+				Name:  contracts.QueryIssuerKey,
+				Value: []byte(claims.Issuer),
+			}, {
+				Name:  contracts.QuerySubjectHashKey,
+				Value: []byte(SubjectHash(claims.Subject)),
+			}},
+		},
+	}, g.signer)
+	if err != nil {
+		return QueryResponse{}, xerrors.Errorf("failed to spawn query: %v", err)
+	}
+
+	resp := QueryResponse{
+		InstanceID: contracts.NewQueryInstanceID(projectID, req.QueryID).String(),
+		UserID:     userID,
+	}
+
+	return resp, nil
+}
+
+// ServeHTTP implements http.Handler. It expects a POST with the JSON-encoded
+// QueryRequest and the token in the "Authorization: Bearer" header.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		http.Error(w, "bearer token is missing", http.StatusUnauthorized)
+		return
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+
+	claims, issuer, err := g.verifier.Verify(token)
+	if err != nil {
+		log.Lvlf2("refused token: %v", err)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var req QueryRequest
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "failed to decode request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := g.submit(claims, issuer, req)
+	if err != nil {
+		// the details may come from the ledger and are not for the caller
+		log.Lvlf2("failed to submit query: %v", err)
+		http.Error(w, "failed to submit query", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		log.Warnf("failed to write response: %v", err)
+	}
+}
+
+// SubjectHash returns the hex-encoded SHA-256 of the token's subject, as
+// stored on the queries.
+func SubjectHash(subject string) string {
+	h := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,402 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+)
+
+// the proxy service needs a database, which is not available in the tests.
+func TestMain(m *testing.M) {
+	err := onet.UnregisterService(bypros.ServiceName)
+	if err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	defer issuer.Close()
+
+	other := newFakeIssuer(t)
+	defer other.Close()
+
+	v := NewVerifier([]IssuerConfig{{URL: issuer.URL, Audience: "medchain"}},
+		http.DefaultClient)
+
+	claims, config, err := v.Verify(issuer.token(t, "alice", nil))
+	require.NoError(t, err)
+	require.Equal(t, "alice", claims.Subject)
+	require.Equal(t, issuer.URL, claims.Issuer)
+	require.Equal(t, issuer.URL, config.URL)
+
+	_, _, err = v.Verify(issuer.ecToken(t, "alice"))
+	require.NoError(t, err)
+
+	_, _, err = v.Verify(issuer.token(t, "alice", map[string]interface{}{
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	}))
+	require.EqualError(t, err, "token expired")
+
+	_, _, err = v.Verify(issuer.token(t, "alice", map[string]interface{}{
+		"nbf": time.Now().Add(time.Hour).Unix(),
+	}))
+	require.EqualError(t, err, "token not valid yet")
+
+	_, _, err = v.Verify(issuer.token(t, "alice", map[string]interface{}{
+		"aud": []string{"other"},
+	}))
+	require.EqualError(t, err, "token not issued for 'medchain'")
+
+	// the other issuer is not trusted
+	_, _, err = v.Verify(other.token(t, "alice", nil))
+	require.Error(t, err)
+
+	// the issuer is trusted but the token is signed by another key
+	_, _, err = v.Verify(other.token(t, "alice", map[string]interface{}{
+		"iss": issuer.URL,
+	}))
+	require.Error(t, err)
+
+	_, _, err = v.Verify("a.b")
+	require.EqualError(t, err, "malformed token")
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gateway")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gateway.toml")
+
+	err = ioutil.WriteFile(path, []byte(`
+[[Issuers]]
+  URL = "https://issuer.example"
+  Audience = "medchain"
+  UserIDClaim = "email"
+`), 0600)
+	require.NoError(t, err)
+
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, []IssuerConfig{{
+		URL:         "https://issuer.example",
+		Audience:    "medchain",
+		UserIDClaim: "email",
+	}}, config.Issuers)
+
+	err = ioutil.WriteFile(path, nil, 0600)
+	require.NoError(t, err)
+
+	_, err = LoadConfig(path)
+	require.EqualError(t, err, "invalid config: no issuer configured")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := Config{Issuers: []IssuerConfig{{URL: "a"}}}
+	require.NoError(t, config.Validate())
+
+	// several issuers need their own UserIDs
+	config.Issuers = append(config.Issuers, IssuerConfig{URL: "b", UserIDPrefix: "b:"})
+	require.EqualError(t, config.Validate(), "issuer a has no UserIDPrefix")
+
+	config.Issuers[0].UserIDPrefix = "b"
+	require.EqualError(t, config.Validate(), "UserIDs of issuers a and b overlap")
+
+	config.Issuers[0].UserIDPrefix = "a:"
+	require.NoError(t, config.Validate())
+}
+
+// An issuer can't submit queries for the users of another issuer.
+func TestGateway_Submit_UserIDPrefix(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	defer issuer.Close()
+
+	verifier := NewVerifier([]IssuerConfig{{
+		URL:          issuer.URL,
+		JWKSURL:      issuer.URL + "/jwks",
+		UserIDPrefix: "hospital:",
+	}}, http.DefaultClient)
+
+	g := NewGateway(verifier, nil, darc.NewSignerEd25519(nil, nil))
+
+	_, err := g.Submit(issuer.token(t, "research:alice", nil), QueryRequest{})
+	require.EqualError(t, err, fmt.Sprintf("issuer %s can't act for user research:alice",
+		issuer.URL))
+}
+
+func TestGateway_ServeHTTP(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	service := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:user"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	cl := client.NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	// the gateway acts for alice but not for bob
+	err = cl.RegisterUser(gDarc.GetBaseID(), "alice",
+		[]darc.Identity{service.Identity()}, signer)
+	require.NoError(t, err)
+
+	err = cl.RegisterUser(gDarc.GetBaseID(), "bob",
+		[]darc.Identity{signer.Identity()}, signer)
+	require.NoError(t, err)
+
+	issuer := newFakeIssuer(t)
+	defer issuer.Close()
+
+	verifier := NewVerifier([]IssuerConfig{{
+		URL:         issuer.URL,
+		JWKSURL:     issuer.URL + "/jwks",
+		UserIDClaim: "preferred_username",
+	}}, http.DefaultClient)
+
+	server := httptest.NewServer(NewGateway(verifier, cl, service))
+	defer server.Close()
+
+	token := issuer.token(t, "subject-alice", map[string]interface{}{
+		"preferred_username": "alice",
+	})
+
+	status, body := postQuery(t, server.URL, token, QueryRequest{
+		ProjectID:       projectID.String(),
+		QueryID:         "queryID",
+		QueryDefinition: "queryDef",
+	})
+	require.Equal(t, http.StatusOK, status, body)
+
+	var resp QueryResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &resp))
+	require.Equal(t, "alice", resp.UserID)
+
+	queryID := contracts.NewQueryInstanceID(projectID, "queryID")
+	require.Equal(t, queryID.String(), resp.InstanceID)
+
+	query, err := cl.GetQuery(queryID)
+	require.NoError(t, err)
+	require.Equal(t, "alice", query.UserID)
+	require.Equal(t, issuer.URL, query.Issuer)
+	require.Equal(t, SubjectHash("subject-alice"), query.SubjectHash)
+
+	// the queries submitted at the same time don't use the same counter
+	statuses := make([]int, 3)
+	wg := sync.WaitGroup{}
+
+	for i := range statuses {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			statuses[i], _ = postQuery(t, server.URL, token, QueryRequest{
+				ProjectID:       projectID.String(),
+				QueryID:         fmt.Sprintf("concurrent%d", i),
+				QueryDefinition: "queryDef",
+			})
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, status := range statuses {
+		require.Equal(t, http.StatusOK, status, "query %d", i)
+	}
+
+	// the gateway's key is not registered for bob
+	token = issuer.token(t, "subject-bob", map[string]interface{}{
+		"preferred_username": "bob",
+	})
+
+	status, body = postQuery(t, server.URL, token, QueryRequest{
+		ProjectID: projectID.String(),
+		QueryID:   "queryID2",
+	})
+	require.Equal(t, http.StatusBadRequest, status)
+	// the errors of the ledger are not sent back
+	require.Equal(t, "failed to submit query\n", body)
+
+	status, _ = postQuery(t, server.URL, "wrong", QueryRequest{})
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	local.WaitDone(genesisMsg.BlockInterval)
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// fakeIssuer is a local OpenID Connect provider serving its discovery document
+// and keys.
+type fakeIssuer struct {
+	*httptest.Server
+
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	issuer := &fakeIssuer{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.URL,
+			"jwks_uri": issuer.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []jwk{{
+				Kty: "RSA",
+				Kid: "rsa",
+				N:   encodeBigInt(rsaKey.N),
+				E:   encodeBigInt(big.NewInt(int64(rsaKey.E))),
+			}, {
+				Kty: "EC",
+				Kid: "ec",
+				Crv: "P-256",
+				X:   encodeBigInt(ecKey.X),
+				Y:   encodeBigInt(ecKey.Y),
+			}},
+		})
+	})
+
+	issuer.Server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+// token returns an RS256 token for the subject. The extra claims override the
+// default ones.
+func (i *fakeIssuer) token(t *testing.T, subject string, extra map[string]interface{}) string {
+	signed := i.payload(t, "RS256", "rsa", subject, extra)
+
+	digest := sha256.Sum256([]byte(signed))
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// ecToken returns an ES256 token for the subject.
+func (i *fakeIssuer) ecToken(t *testing.T, subject string) string {
+	signed := i.payload(t, "ES256", "ec", subject, nil)
+
+	digest := sha256.Sum256([]byte(signed))
+
+	r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+	require.NoError(t, err)
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (i *fakeIssuer) payload(t *testing.T, alg, kid, subject string,
+	extra map[string]interface{}) string {
+
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+
+	claims := map[string]interface{}{
+		"iss": i.URL,
+		"sub": subject,
+		"aud": "medchain",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	for k, v := range extra {
+		claims[k] = v
+	}
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func postQuery(t *testing.T, url, token string, req QueryRequest) (int, string) {
+	buf, err := json.Marshal(req)
+	require.NoError(t, err)
+
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(buf))
+	require.NoError(t, err)
+
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, string(body)
+}
@@ -0,0 +1,403 @@
+package gateway
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// leeway is the clock skew tolerated when checking the validity period of a
+// token.
+const leeway = time.Minute
+
+// refreshInterval is the minimum interval between two fetches of the keys of
+// an issuer, so that tokens with unknown key IDs can't be used to flood the
+// issuer.
+const refreshInterval = time.Minute
+
+// Claims are the claims of a validated token.
+type Claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expiry    int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+
+	// raw holds all the claims, to read the claim mapped to the UserID.
+	raw map[string]interface{}
+}
+
+// Get returns the string value of a claim, or an empty string if the claim is
+// not set or is not a string.
+func (c Claims) Get(name string) string {
+	value, _ := c.raw[name].(string)
+	return value
+}
+
+// audience is the "aud" claim, which is either a string or an array of
+// strings.
+type audience []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+
+	err := json.Unmarshal(data, &single)
+	if err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+
+	err = json.Unmarshal(data, &list)
+	if err != nil {
+		return xerrors.Errorf("invalid audience: %v", err)
+	}
+
+	*a = list
+
+	return nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, value := range a {
+		if value == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Verifier validates the tokens issued by the configured issuers. Only the
+// asymmetric RS256 and ES256 algorithms are accepted.
+type Verifier struct {
+	issuers map[string]*issuer
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+type issuer struct {
+	config IssuerConfig
+	keys   *keySet
+}
+
+// NewVerifier creates a verifier for the issuers. The keys of the issuers are
+// fetched with the HTTP client when they are first needed.
+func NewVerifier(issuers []IssuerConfig, client *http.Client) *Verifier {
+	v := &Verifier{
+		issuers: make(map[string]*issuer),
+		now:     time.Now,
+	}
+
+	for _, config := range issuers {
+		v.issuers[config.URL] = &issuer{
+			config: config,
+			keys:   newKeySet(config, client),
+		}
+	}
+
+	return v
+}
+
+// Verify validates the token and returns its claims along with the
+// configuration of its issuer.
+func (v *Verifier) Verify(token string) (*Claims, IssuerConfig, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, IssuerConfig{}, xerrors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, IssuerConfig{}, xerrors.Errorf("failed to decode header: %v", err)
+	}
+
+	var claims Claims
+
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, IssuerConfig{}, xerrors.Errorf("failed to decode claims: %v", err)
+	}
+
+	err = decodeSegment(parts[1], &claims.raw)
+	if err != nil {
+		return nil, IssuerConfig{}, xerrors.Errorf("failed to decode claims: %v", err)
+	}
+
+	iss, found := v.issuers[claims.Issuer]
+	if !found {
+		return nil, IssuerConfig{}, xerrors.Errorf("unknown issuer '%s'", claims.Issuer)
+	}
+
+	key, err := iss.keys.get(header.Kid)
+	if err != nil {
+		return nil, IssuerConfig{}, xerrors.Errorf("failed to get key: %v", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, IssuerConfig{}, xerrors.Errorf("failed to decode signature: %v", err)
+	}
+
+	err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, IssuerConfig{}, xerrors.Errorf("invalid signature: %v", err)
+	}
+
+	now := v.now()
+
+	if claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(leeway)) {
+		return nil, IssuerConfig{}, xerrors.New("token expired")
+	}
+
+	if claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, IssuerConfig{}, xerrors.New("token not valid yet")
+	}
+
+	if iss.config.Audience != "" && !claims.Audience.contains(iss.config.Audience) {
+		return nil, IssuerConfig{}, xerrors.Errorf("token not issued for '%s'",
+			iss.config.Audience)
+	}
+
+	if claims.Subject == "" {
+		return nil, IssuerConfig{}, xerrors.New("subject is missing")
+	}
+
+	return &claims, iss.config, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return xerrors.Errorf("key doesn't match algorithm %s", alg)
+		}
+
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return xerrors.Errorf("key doesn't match algorithm %s", alg)
+		}
+
+		if len(sig) != 64 {
+			return xerrors.Errorf("wrong signature length: %d", len(sig))
+		}
+
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return xerrors.New("verification failed")
+		}
+
+		return nil
+	default:
+		return xerrors.Errorf("unsupported algorithm '%s'", alg)
+	}
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	buf, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return xerrors.Errorf("failed to decode base64: %v", err)
+	}
+
+	err = json.Unmarshal(buf, v)
+	if err != nil {
+		return xerrors.Errorf("failed to decode json: %v", err)
+	}
+
+	return nil
+}
+
+// keySet holds the public keys of an issuer, fetched from its JWKS endpoint.
+type keySet struct {
+	sync.Mutex
+
+	config  IssuerConfig
+	client  *http.Client
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newKeySet(config IssuerConfig, client *http.Client) *keySet {
+	return &keySet{
+		config: config,
+		client: client,
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// get returns the key with the given ID. The keys are fetched again if the ID
+// is unknown, to follow the rotation of the keys by the issuer.
+func (ks *keySet) get(kid string) (crypto.PublicKey, error) {
+	ks.Lock()
+	defer ks.Unlock()
+
+	key, found := ks.keys[kid]
+	if found {
+		return key, nil
+	}
+
+	if time.Since(ks.fetched) < refreshInterval {
+		return nil, xerrors.Errorf("unknown key '%s'", kid)
+	}
+
+	err := ks.fetch()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to fetch keys: %v", err)
+	}
+
+	key, found = ks.keys[kid]
+	if !found {
+		return nil, xerrors.Errorf("unknown key '%s'", kid)
+	}
+
+	return key, nil
+}
+
+func (ks *keySet) fetch() error {
+	jwksURL := ks.config.JWKSURL
+
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+
+		err := ks.getJSON(strings.TrimSuffix(ks.config.URL, "/")+
+			"/.well-known/openid-configuration", &discovery)
+		if err != nil {
+			return xerrors.Errorf("failed to discover issuer: %v", err)
+		}
+
+		jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err := ks.getJSON(jwksURL, &jwks)
+	if err != nil {
+		return xerrors.Errorf("failed to get JWKS: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+
+	for _, k := range jwks.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			// keys of other types are ignored, as the tokens signed with them
+			// would be refused anyway.
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	ks.keys = keys
+	ks.fetched = time.Now()
+
+	return nil
+}
+
+func (ks *keySet) getJSON(url string, v interface{}) error {
+	resp, err := ks.client.Get(url)
+	if err != nil {
+		return xerrors.Errorf("failed to get %s: %v", url, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return xerrors.Errorf("unexpected status for %s: %s", url, resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		return xerrors.Errorf("failed to decode %s: %v", url, err)
+	}
+
+	return nil
+}
+
+// jwk is a JSON Web Key, as defined in RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid modulus: %v", err)
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid exponent: %v", err)
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, xerrors.Errorf("unsupported curve '%s'", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid x: %v", err)
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid y: %v", err)
+		}
+
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, xerrors.New("point not on curve")
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, xerrors.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode base64: %v", err)
+	}
+
+	return new(big.Int).SetBytes(buf), nil
+}
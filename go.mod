@@ -3,12 +3,15 @@ module github.com/ldsec/medchain
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v0.3.1
+	github.com/jackc/pgx v3.6.2+incompatible
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/stretchr/testify v1.5.1
 	go.dedis.ch/cothority/v3 v3.4.7
 	go.dedis.ch/kyber/v3 v3.0.13
 	go.dedis.ch/onet/v3 v3.2.8
 	go.dedis.ch/protobuf v1.0.11
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	golang.org/x/sys v0.0.0-20210119212857-b64e53b001e4 // indirect
 	golang.org/x/text v0.3.3 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
@@ -0,0 +1,303 @@
+// Package health provides the liveness and readiness endpoints of a MedChain
+// conode, for container orchestration.
+//
+// The conode is live once its services are started. It is ready when the
+// ByzCoin proxy database answers, when the proxy follows a chain held by the
+// conode, and, if a maximum is set, when the last block of every chain is
+// recent enough.
+package health
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ServiceName is the name of the health service.
+const ServiceName = "MedChainHealth"
+
+// The names of the checks of the readiness.
+const (
+	DatabaseCheck      = "proxy database"
+	ChainFollowedCheck = "chain followed"
+	BlockAgeCheck      = "latest block age"
+)
+
+// instance is the service of the conode, used by the handlers. There is only
+// one conode per process, except in the tests.
+var instance struct {
+	sync.Mutex
+	service *Service
+}
+
+// Register registers the health service. The readiness fails if the last
+// block of a chain is older than maxBlockAge, unless it is zero. It must be
+// called before the conode is started.
+func Register(maxBlockAge time.Duration) error {
+	_, err := onet.RegisterNewService(ServiceName, func(c *onet.Context) (onet.Service, error) {
+		s := &Service{
+			ServiceProcessor: onet.NewServiceProcessor(c),
+			maxBlockAge:      maxBlockAge,
+		}
+
+		instance.Lock()
+		instance.service = s
+		instance.Unlock()
+
+		return s, nil
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to register health: %v", err)
+	}
+
+	return nil
+}
+
+// Handler returns the handler of /healthz and /readyz for the service of the
+// conode. They answer 503 until the conode is started.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		s := current()
+		if s == nil {
+			http.Error(w, "conode not started", http.StatusServiceUnavailable)
+			return
+		}
+
+		s.ServeLive(w, r)
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		s := current()
+		if s == nil {
+			http.Error(w, "conode not started", http.StatusServiceUnavailable)
+			return
+		}
+
+		s.ServeReady(w, r)
+	})
+
+	return mux
+}
+
+func current() *Service {
+	instance.Lock()
+	defer instance.Unlock()
+
+	return instance.service
+}
+
+// Service checks the health of the conode.
+type Service struct {
+	*onet.ServiceProcessor
+
+	maxBlockAge time.Duration
+}
+
+// Check is the result of a check of the readiness.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message"`
+}
+
+// Readiness is the result of the checks of the readiness.
+type Readiness struct {
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+// ServeLive answers that the conode is live.
+func (s *Service) ServeLive(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// ServeReady answers the result of the checks, with the status 503 if the
+// conode is not ready.
+func (s *Service) ServeReady(w http.ResponseWriter, _ *http.Request) {
+	readiness := s.Ready()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(readiness)
+}
+
+// Ready runs the checks of the readiness.
+func (s *Service) Ready() Readiness {
+	checks := []Check{
+		s.check(DatabaseCheck, s.checkDatabase),
+		s.check(ChainFollowedCheck, s.checkChainFollowed),
+		s.check(BlockAgeCheck, s.checkBlockAge),
+	}
+
+	readiness := Readiness{Ready: true, Checks: checks}
+
+	for _, check := range checks {
+		readiness.Ready = readiness.Ready && check.OK
+	}
+
+	return readiness
+}
+
+func (s *Service) check(name string, fn func() (string, error)) Check {
+	msg, err := fn()
+	if err != nil {
+		return Check{Name: name, Message: err.Error()}
+	}
+
+	return Check{Name: name, OK: true, Message: msg}
+}
+
+// checkDatabase runs a query on the database of the proxy.
+func (s *Service) checkDatabase() (string, error) {
+	_, err := s.query("SELECT 1")
+	if err != nil {
+		return "", xerrors.Errorf("failed to query: %v", err)
+	}
+
+	return "reachable", nil
+}
+
+// checkChainFollowed checks that the last block stored by the proxy is the last
+// one, or the one before, of a chain held by the conode.
+func (s *Service) checkChainFollowed() (string, error) {
+	res, err := s.query(`SELECT encode(hash, 'hex') AS hash FROM cothority.block
+ORDER BY block_id DESC LIMIT 1`)
+	if err != nil {
+		return "", xerrors.Errorf("failed to query: %v", err)
+	}
+
+	var rows []struct {
+		Hash string
+	}
+
+	err = json.Unmarshal(res, &rows)
+	if err != nil {
+		return "", xerrors.Errorf("failed to decode result: %v", err)
+	}
+
+	if len(rows) == 0 {
+		return "", xerrors.New("no block stored by the proxy")
+	}
+
+	hash, err := hex.DecodeString(rows[0].Hash)
+	if err != nil {
+		return "", xerrors.Errorf("failed to decode hash: %v", err)
+	}
+
+	db := s.skipchainDB()
+
+	stored := db.GetByID(hash)
+	if stored == nil {
+		return "", xerrors.Errorf("last stored block %x is not held by the conode", hash)
+	}
+
+	latest, err := db.GetLatestByID(stored.SkipChainID())
+	if err != nil {
+		return "", xerrors.Errorf("failed to get latest block: %v", err)
+	}
+
+	if latest.Index-stored.Index > 1 {
+		return "", xerrors.Errorf("proxy at block %d of chain %x, conode at block %d",
+			stored.Index, stored.SkipChainID(), latest.Index)
+	}
+
+	return fmt.Sprintf("chain %x at block %d", stored.SkipChainID(), stored.Index), nil
+}
+
+// checkBlockAge checks that the last block of every chain held by the conode
+// is recent enough.
+func (s *Service) checkBlockAge() (string, error) {
+	if s.maxBlockAge == 0 {
+		return "not checked", nil
+	}
+
+	resp, err := s.byzcoin().GetAllByzCoinIDs(&byzcoin.GetAllByzCoinIDsRequest{})
+	if err != nil {
+		return "", xerrors.Errorf("failed to get chains: %v", err)
+	}
+
+	if len(resp.IDs) == 0 {
+		return "", xerrors.New("no chain held by the conode")
+	}
+
+	var oldest time.Duration
+
+	for _, id := range resp.IDs {
+		age, err := s.blockAge(id)
+		if err != nil {
+			return "", xerrors.Errorf("failed to get age of chain %x: %v", id, err)
+		}
+
+		if age > s.maxBlockAge {
+			return "", xerrors.Errorf("last block of chain %x is %s old, more than %s",
+				id, age.Round(time.Second), s.maxBlockAge)
+		}
+
+		if age > oldest {
+			oldest = age
+		}
+	}
+
+	return fmt.Sprintf("oldest is %s", oldest.Round(time.Second)), nil
+}
+
+// blockAge returns the time since the last block of the chain.
+func (s *Service) blockAge(id skipchain.SkipBlockID) (time.Duration, error) {
+	latest, err := s.skipchainDB().GetLatestByID(id)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to get latest block: %v", err)
+	}
+
+	var header byzcoin.DataHeader
+
+	err = protobuf.Decode(latest.Data, &header)
+	if err != nil {
+		return 0, xerrors.Errorf("failed to decode header: %v", err)
+	}
+
+	return time.Since(time.Unix(0, header.Timestamp)), nil
+}
+
+// query runs the query with the proxy service, which is either bypros or the
+// SQLite indexer.
+func (s *Service) query(query string) ([]byte, error) {
+	proxy, ok := s.Service(bypros.ServiceName).(interface {
+		Query(*bypros.Query) (*bypros.QueryReply, error)
+	})
+	if !ok {
+		return nil, xerrors.New("proxy service not available")
+	}
+
+	reply, err := proxy.Query(&bypros.Query{Query: query})
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Result, nil
+}
+
+func (s *Service) byzcoin() *byzcoin.Service {
+	return s.Service(byzcoin.ServiceName).(*byzcoin.Service)
+}
+
+func (s *Service) skipchainDB() *skipchain.SkipBlockDB {
+	return s.Service(skipchain.ServiceName).(*skipchain.Service).GetDB()
+}
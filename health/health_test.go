@@ -0,0 +1,111 @@
+package health
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/indexer"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// The proxy of the tests is the SQLite indexer, as PostgreSQL is not
+// available.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "health")
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	err = indexer.Register(filepath.Join(dir, "indexer.db"))
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	err = Register(0)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestService_Ready(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	// not started
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	servers, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		nil, signer.Identity())
+	require.NoError(t, err)
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	s := servers[0].Service(ServiceName).(*Service)
+
+	readiness := s.Ready()
+	require.False(t, readiness.Ready)
+	require.Equal(t, []Check{
+		{Name: DatabaseCheck, OK: true, Message: "reachable"},
+		{Name: ChainFollowedCheck, Message: "no block stored by the proxy"},
+		{Name: BlockAgeCheck, OK: true, Message: "not checked"},
+	}, readiness.Checks)
+
+	rec = httptest.NewRecorder()
+	s.ServeReady(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	require.NoError(t, bypros.NewClient().Follow(roster.List[0], roster.List[0], bcl.ID))
+
+	require.Eventually(t, func() bool {
+		return s.Ready().Ready
+	}, 5*time.Second, 100*time.Millisecond)
+
+	rec = httptest.NewRecorder()
+	s.ServeReady(rec, httptest.NewRequest("GET", "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var res Readiness
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	require.True(t, res.Ready)
+	require.Len(t, res.Checks, 3)
+
+	s.maxBlockAge = time.Hour
+	require.True(t, s.Ready().Ready)
+
+	s.maxBlockAge = time.Nanosecond
+	readiness = s.Ready()
+	require.False(t, readiness.Ready)
+	require.False(t, readiness.Checks[2].OK)
+	require.Contains(t, readiness.Checks[2].Message, "old, more than 1ns")
+
+	// one of the nodes of the test is the instance of the handlers
+	rec = httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "ok\n", rec.Body.String())
+}
@@ -0,0 +1,430 @@
+// Package indexer is an alternative to the ByzCoin proxy (bypros) that needs
+// no external database. It stores the blocks of the chain in an embedded
+// SQLite database, with the same tables as the proxy, and answers the same
+// requests under the same service name. The MedChain clients, the listing of
+// the projects and the audit reports work unchanged with either.
+//
+// Instead of connecting to the websocket of a node, the indexer follows the
+// chains of the conode it runs on. The conode must therefore hold the chains.
+// Unlike the proxy, it can follow several chains, one per consortium the
+// conode takes part in, and records the skipchain ID of every block.
+package indexer
+
+import (
+	"fmt"
+	"sync"
+
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// Register replaces the ByzCoin proxy service by the indexer, storing the
+// blocks in the SQLite database at the given path. It must be called before
+// the conode is started.
+func Register(path string) error {
+	err := onet.UnregisterService(bypros.ServiceName)
+	if err != nil {
+		return xerrors.Errorf("failed to unregister proxy: %v", err)
+	}
+
+	_, err = onet.RegisterNewService(bypros.ServiceName, func(c *onet.Context) (onet.Service, error) {
+		return newService(c, path)
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to register indexer: %v", err)
+	}
+
+	return nil
+}
+
+// Service is the indexer service.
+type Service struct {
+	*onet.ServiceProcessor
+
+	storage *SQLite
+
+	// the chains known by the indexer, by skipchain ID
+	sync.Mutex
+	chains map[string]*chain
+}
+
+// chain is the state of a chain indexed by the service. The fields but the
+// last block are protected by the lock of the service.
+type chain struct {
+	scID      skipchain.SkipBlockID
+	following bool
+	stop      chan bool
+	done      chan struct{}
+	queue     []*skipchain.SkipBlock
+
+	// indexing is held while blocks are stored, last is the last stored
+	// block of the chain.
+	indexing sync.Mutex
+	last     *skipchain.SkipBlock
+}
+
+func newService(c *onet.Context, path string) (*Service, error) {
+	storage, err := NewSQLite(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open storage: %v", err)
+	}
+
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		storage:          storage,
+		chains:           make(map[string]*chain),
+	}
+
+	err = s.RegisterHandlers(s.Follow, s.Unfollow, s.Query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to register handlers: %v", err)
+	}
+
+	err = s.RegisterStreamingHandler(s.CatchUP)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to register streaming handler: %v", err)
+	}
+
+	return s, nil
+}
+
+// Follow catches up with the chain stored by the conode, then indexes every
+// new block. The target of the request is ignored. Several chains can be
+// followed at once.
+func (s *Service) Follow(req *bypros.Follow) (*bypros.EmptyReply, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	c, err := s.getChain(req.ScID)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get chain: %v", err)
+	}
+
+	if c.following {
+		return nil, xerrors.Errorf("already following %x", req.ScID)
+	}
+
+	blocks, stop, err := s.byzcoin().StreamTransactions(&byzcoin.StreamingRequest{
+		ID: req.ScID,
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("failed to stream blocks: %v", err)
+	}
+
+	done := make(chan struct{})
+	wake := make(chan struct{}, 1)
+
+	c.following = true
+	c.stop = stop
+	c.done = done
+
+	// The blocks are queued as they come, as the stream blocks the
+	// creation of new blocks until they are read.
+	go func() {
+		for resp := range blocks {
+			s.Lock()
+			c.queue = append(c.queue, resp.Block)
+			s.Unlock()
+
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	go s.listen(c, done, wake)
+
+	log.Lvl1("indexer following", req.ScID)
+
+	return &bypros.EmptyReply{}, nil
+}
+
+// listen indexes the blocks of the chain, then the ones of the queue until
+// done is closed.
+func (s *Service) listen(c *chain, done chan struct{}, wake chan struct{}) {
+	err := s.catchUp(c, nil, nil)
+	if err != nil {
+		log.Errorf("failed to catch up: %v", err)
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-wake:
+		}
+
+		s.Lock()
+		queue := c.queue
+		c.queue = nil
+		s.Unlock()
+
+		for _, block := range queue {
+			err := s.index(c, block)
+			if err != nil {
+				log.Errorf("failed to index block %d: %v", block.Index, err)
+			}
+		}
+	}
+}
+
+// Unfollow stops following the chains, as the request of the proxy doesn't
+// tell which one.
+func (s *Service) Unfollow(req *bypros.Unfollow) (*bypros.EmptyReply, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.unfollowAll() == 0 {
+		return nil, xerrors.New("not following")
+	}
+
+	return &bypros.EmptyReply{}, nil
+}
+
+// unfollowAll stops following the chains and returns how many were followed.
+// It must be called with the lock held.
+func (s *Service) unfollowAll() int {
+	count := 0
+
+	for _, c := range s.chains {
+		if !c.following {
+			continue
+		}
+
+		close(c.stop)
+		close(c.done)
+
+		c.following = false
+		c.queue = nil
+		count++
+	}
+
+	return count
+}
+
+// TestClose stops following the chains, so that the byzcoin service can be
+// closed, and closes the storage.
+func (s *Service) TestClose() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.unfollowAll()
+
+	// the storage is closed once no block is being stored
+	for _, c := range s.chains {
+		c.indexing.Lock()
+		defer c.indexing.Unlock()
+	}
+
+	s.storage.Close()
+}
+
+// Query runs the query on a read-only connection.
+func (s *Service) Query(req *bypros.Query) (*bypros.QueryReply, error) {
+	res, err := s.storage.Query(req.Query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query: %v", err)
+	}
+
+	return &bypros.QueryReply{
+		Result: res,
+	}, nil
+}
+
+// CatchUP indexes the blocks stored by the conode from the given block, or
+// from the genesis block if none is given. The target of the request is
+// ignored.
+func (s *Service) CatchUP(req *bypros.CatchUpMsg) (chan *bypros.CatchUpResponse, chan bool, error) {
+	s.Lock()
+	c, err := s.getChain(req.ScID)
+	s.Unlock()
+
+	if err != nil {
+		return nil, nil, xerrors.Errorf("failed to get chain: %v", err)
+	}
+
+	var from *skipchain.SkipBlock
+
+	if len(req.FromBlock) > 0 {
+		from = s.skipchainDB().GetByID(req.FromBlock)
+		if from == nil {
+			return nil, nil, xerrors.Errorf("block %x not found", req.FromBlock)
+		}
+
+		if !from.SkipChainID().Equal(c.scID) {
+			return nil, nil, xerrors.Errorf("block %x not in chain %x", req.FromBlock, c.scID)
+		}
+	}
+
+	outChan := make(chan *bypros.CatchUpResponse)
+	stopChan := make(chan bool)
+
+	go func() {
+		defer close(outChan)
+
+		count := 0
+
+		err := s.catchUp(c, from, func(block *skipchain.SkipBlock) {
+			count++
+
+			if req.UpdateEvery > 0 && count%req.UpdateEvery == 0 {
+				select {
+				case outChan <- &bypros.CatchUpResponse{
+					Status: bypros.CatchUpStatus{
+						Message:    fmt.Sprintf("parsed block %d", block.Index),
+						BlockIndex: block.Index,
+						BlockHash:  block.Hash,
+					},
+				}:
+				case <-stopChan:
+				}
+			}
+		})
+
+		resp := &bypros.CatchUpResponse{Done: true}
+		if err != nil {
+			resp = &bypros.CatchUpResponse{Err: err.Error()}
+		}
+
+		select {
+		case outChan <- resp:
+		case <-stopChan:
+		}
+	}()
+
+	return outChan, stopChan, nil
+}
+
+// getChain returns the state of the chain, which must be held by the conode.
+// It must be called with the lock held.
+func (s *Service) getChain(scID skipchain.SkipBlockID) (*chain, error) {
+	c, found := s.chains[string(scID)]
+	if found {
+		return c, nil
+	}
+
+	genesis := s.skipchainDB().GetByID(scID)
+	if genesis == nil || genesis.Index != 0 {
+		return nil, xerrors.Errorf("chain %x not stored by this conode", scID)
+	}
+
+	c = &chain{scID: scID}
+	s.chains[string(scID)] = c
+
+	return c, nil
+}
+
+// index stores a new block of the chain, after the ones that might be missing
+// before it.
+func (s *Service) index(c *chain, block *skipchain.SkipBlock) error {
+	c.indexing.Lock()
+	last := c.last
+	c.indexing.Unlock()
+
+	if last == nil || block.Index > last.Index+1 {
+		err := s.catchUp(c, last, nil)
+		if err != nil {
+			return xerrors.Errorf("failed to catch up: %v", err)
+		}
+	}
+
+	c.indexing.Lock()
+	defer c.indexing.Unlock()
+
+	err := s.store(block)
+	if err != nil {
+		return xerrors.Errorf("failed to store block: %v", err)
+	}
+
+	if c.last == nil || block.Index > c.last.Index {
+		c.last = block
+	}
+
+	return nil
+}
+
+// catchUp stores the blocks of the chain from the given block, or the last
+// stored one, by following the forward links of the blocks stored by the
+// conode. The callback, if any, is called for each block.
+func (s *Service) catchUp(c *chain, from *skipchain.SkipBlock, cb func(*skipchain.SkipBlock)) error {
+	c.indexing.Lock()
+	defer c.indexing.Unlock()
+
+	db := s.skipchainDB()
+
+	block := from
+	if block == nil {
+		block = c.last
+	}
+
+	if block == nil {
+		block = db.GetByID(c.scID)
+		if block == nil {
+			return xerrors.Errorf("genesis block %x not found", c.scID)
+		}
+	}
+
+	for block != nil {
+		err := s.store(block)
+		if err != nil {
+			return xerrors.Errorf("failed to store block %d: %v", block.Index, err)
+		}
+
+		if c.last == nil || block.Index > c.last.Index {
+			c.last = block
+		}
+
+		if cb != nil {
+			cb(block)
+		}
+
+		if len(block.ForwardLink) == 0 {
+			break
+		}
+
+		block = db.GetByID(block.ForwardLink[0].To)
+	}
+
+	return nil
+}
+
+// store stores the block if it is not already. It must be called with the
+// indexing lock of its chain held.
+func (s *Service) store(block *skipchain.SkipBlock) error {
+	blockID, err := s.storage.GetBlock(block.Hash)
+	if err != nil {
+		return xerrors.Errorf("failed to get block: %v", err)
+	}
+
+	if blockID != -1 {
+		// the block might have been stored before the skipchain IDs were
+		err = s.storage.SetChain(blockID, block.SkipChainID())
+		if err != nil {
+			return xerrors.Errorf("failed to set chain: %v", err)
+		}
+
+		return nil
+	}
+
+	_, err = s.storage.StoreBlock(block)
+	if err != nil {
+		return xerrors.Errorf("failed to store block: %v", err)
+	}
+
+	log.Lvl3("indexed block", block.Index)
+
+	return nil
+}
+
+func (s *Service) byzcoin() *byzcoin.Service {
+	return s.Service(byzcoin.ServiceName).(*byzcoin.Service)
+}
+
+func (s *Service) skipchainDB() *skipchain.SkipBlockDB {
+	return s.Service(skipchain.ServiceName).(*skipchain.Service).GetDB()
+}
@@ -0,0 +1,210 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"github.com/ldsec/medchain/report"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// The nodes of the tests share the database, only the first one follows the
+// chain.
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "indexer")
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	err = Register(filepath.Join(dir, "indexer.db"))
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestService_Follow(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:user", "invoke:project.add"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	proxy := roster.List[0]
+	cl := client.NewClient(bcl, proxy)
+
+	// a block before the indexer follows the chain
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	bp := bypros.NewClient()
+
+	require.NoError(t, bp.Follow(proxy, proxy, bcl.ID))
+	err = bp.Follow(proxy, proxy, bcl.ID)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already following")
+
+	// blocks after
+	user := darc.NewSignerEd25519(nil, nil)
+
+	err = cl.RegisterUser(gDarc.GetBaseID(), "userID", []darc.Identity{user.Identity()}, signer)
+	require.NoError(t, err)
+
+	_, err = cl.Invoke(projectID, contracts.ProjectContractID, contracts.ProjectAddAction,
+		byzcoin.Arguments{
+			{Name: contracts.ProjectUserIDKey, Value: []byte("userID")},
+			{Name: contracts.ProjectQueryTermKey, Value: []byte("q1")},
+		}, signer)
+	require.NoError(t, err)
+
+	_, err = cl.SpawnQuery(projectID, "userID", "queryID", "q1", "", user)
+	require.NoError(t, err)
+
+	var r *report.Report
+
+	// the indexer stores the last block asynchronously
+	for i := 0; i < 10; i++ {
+		r, err = report.NewGenerator(cl, cl).Generate(report.Filter{})
+		require.NoError(t, err)
+
+		if len(r.Events) == 3 {
+			break
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	require.Len(t, r.Events, 3)
+	require.Equal(t, report.ProjectCreated, r.Events[0].Kind)
+	require.Equal(t, report.TermsGranted, r.Events[1].Kind)
+	require.Equal(t, report.QuerySubmitted, r.Events[2].Kind)
+	require.Equal(t, contracts.QueryPendingStatus, r.Events[2].Status)
+	require.Equal(t, []string{user.Identity().String()}, r.Events[2].Signers)
+
+	ids, err := cl.ProjectIDs("name")
+	require.NoError(t, err)
+	require.Equal(t, []byzcoin.InstanceID{projectID}, ids)
+
+	require.NoError(t, bp.Unfollow(proxy))
+	require.Error(t, bp.Unfollow(proxy))
+
+	_, err = cl.ProxyQuery("delete from cothority.block")
+	require.Error(t, err)
+}
+
+func TestService_FollowChains(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(3, true)
+
+	proxy := roster.List[0]
+	bp := bypros.NewClient()
+
+	// two consortia on the same nodes
+	ids := make([]string, 2)
+
+	for i := range ids {
+		genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+			[]string{"spawn:project"}, signer.Identity())
+		require.NoError(t, err)
+
+		genesisMsg.BlockInterval = time.Second
+
+		bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+		require.NoError(t, err)
+
+		require.NoError(t, bp.Follow(proxy, proxy, bcl.ID))
+
+		_, err = client.NewClient(bcl, proxy).SendInstruction(byzcoin.Instruction{
+			InstanceID: byzcoin.NewInstanceID(genesisMsg.GenesisDarc.GetBaseID()),
+			Spawn: &byzcoin.Spawn{
+				ContractID: contracts.ProjectContractID,
+				Args: byzcoin.Arguments{{
+					Name:  contracts.ProjectNameKey,
+					Value: []byte("name"),
+				}},
+			},
+		}, signer)
+		require.NoError(t, err)
+
+		ids[i] = fmt.Sprintf("%x", bcl.ID)
+	}
+
+	err := bp.Follow(proxy, proxy, []byte("unknown"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "not stored by this conode")
+
+	query := fmt.Sprintf(`select encode(block.skipchain_id, 'hex') as chain, count(*) as projects
+from cothority.instruction
+join cothority."transaction" on
+	"transaction".transaction_id = instruction.transaction_id
+join cothority.block on
+	block.block_id = "transaction".block_id
+where instruction.action = 'spawn:project'
+	and encode(block.skipchain_id, 'hex') in ('%s', '%s')
+group by block.skipchain_id
+order by chain`, ids[0], ids[1])
+
+	sort.Strings(ids)
+
+	expected := []map[string]interface{}{
+		{"chain": ids[0], "projects": 1.0},
+		{"chain": ids[1], "projects": 1.0},
+	}
+
+	// the indexer stores the last block asynchronously
+	require.Eventually(t, func() bool {
+		res, err := bp.Query(proxy, query)
+		require.NoError(t, err)
+
+		var rows []map[string]interface{}
+		require.NoError(t, json.Unmarshal(res, &rows))
+
+		return reflect.DeepEqual(expected, rows)
+	}, 10*time.Second, 500*time.Millisecond)
+
+	require.NoError(t, bp.Unfollow(proxy))
+	require.Error(t, bp.Unfollow(proxy))
+}
@@ -0,0 +1,729 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/mattn/go-sqlite3"
+	"go.dedis.ch/cothority/v3/bypros/storage"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// schema is the schema of the ByzCoin proxy (bypros/schema.sql) and the
+// indexes of the first migration, in the SQLite dialect. The tables are in
+// the database attached as "cothority", so that the same queries can be run
+// on both. As "transaction" is a keyword for SQLite, the queries must quote
+// it, which Postgres accepts as well.
+//
+// Unlike the proxy, the indexer follows several chains. The blocks therefore
+// record their skipchain ID, added to the databases created before by
+// chainColumn.
+const schema = `
+CREATE TABLE IF NOT EXISTS cothority.version (
+    schema_version INTEGER PRIMARY KEY,
+    ts TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO cothority.version (schema_version) VALUES (0);
+
+CREATE TABLE IF NOT EXISTS cothority.block (
+    block_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash BLOB NOT NULL,
+    skipchain_id BLOB
+);
+
+CREATE TABLE IF NOT EXISTS cothority."transaction" (
+    transaction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    block_id INTEGER NOT NULL
+        REFERENCES block(block_id)
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    accepted BOOLEAN NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cothority."instructionType" (
+    type_id INTEGER PRIMARY KEY,
+    name VARCHAR(10) NOT NULL
+);
+
+INSERT OR IGNORE INTO cothority."instructionType" (type_id, name) VALUES
+    (1, 'Invalid'), (2, 'Spawn'), (3, 'Invoke'), (4, 'Delete');
+
+CREATE TABLE IF NOT EXISTS cothority.instruction (
+    instruction_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL
+        REFERENCES "transaction"(transaction_id)
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    type_id INTEGER NOT NULL
+        REFERENCES "instructionType"(type_id)
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    action VARCHAR NOT NULL,
+    instance_iid BLOB NOT NULL,
+    contract_iid BLOB NOT NULL,
+    contract_name VARCHAR NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS cothority.argument (
+    argument_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    instruction_id INTEGER NOT NULL
+        REFERENCES instruction(instruction_id)
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    name VARCHAR NOT NULL,
+    value BLOB
+);
+
+CREATE TABLE IF NOT EXISTS cothority.signer (
+    signer_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    instruction_id INTEGER NOT NULL
+        REFERENCES instruction(instruction_id)
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    signature BLOB NOT NULL,
+    counter INTEGER NOT NULL,
+    identity VARCHAR NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS cothority.block_hash_idx
+    ON block (hash);
+CREATE INDEX IF NOT EXISTS cothority.instruction_contract_name_idx
+    ON instruction (contract_name);
+CREATE INDEX IF NOT EXISTS cothority.instruction_action_idx
+    ON instruction (action);
+CREATE INDEX IF NOT EXISTS cothority.instruction_instance_iid_idx
+    ON instruction (instance_iid);
+CREATE INDEX IF NOT EXISTS cothority.argument_instruction_name_idx
+    ON argument (instruction_id, name);
+CREATE INDEX IF NOT EXISTS cothority.argument_name_idx
+    ON argument (name);
+CREATE INDEX IF NOT EXISTS cothority.signer_instruction_idx
+    ON signer (instruction_id);
+`
+
+// views are the views of the medchain schema of the first migration
+// (bypros/migrations/001_medchain.sql), in the SQLite dialect. SQLite has no
+// SQL functions, so the helpers of the migration are inlined as subqueries.
+// A view can only use the tables of its database: they are created in the
+// "cothority" database, which is attached again as "medchain" to the
+// read-only connections, so that the queries on the medchain views run on
+// both.
+const views = `
+CREATE VIEW IF NOT EXISTS cothority.projects AS
+SELECT
+    instruction.instruction_id,
+    block.hash AS block_hash,
+    encode(instruction.contract_iid, 'hex') AS project_id,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'name'
+        LIMIT 1) AS name,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'description'
+        LIMIT 1) AS description,
+    encode(instruction.instance_iid, 'hex') AS darc_id,
+    (SELECT group_concat(identity, ' ') FROM (SELECT identity FROM signer
+        WHERE signer.instruction_id = instruction.instruction_id
+        ORDER BY identity)) AS signers
+FROM instruction
+JOIN "transaction" ON
+    "transaction".transaction_id = instruction.transaction_id
+JOIN block ON
+    block.block_id = "transaction".block_id
+WHERE instruction.action = 'spawn:project'
+    AND "transaction".accepted;
+
+CREATE VIEW IF NOT EXISTS cothority.queries AS
+SELECT
+    instruction.instruction_id,
+    block.hash AS block_hash,
+    "transaction".accepted,
+    encode(sha256('query', instruction.instance_iid,
+        coalesce((SELECT value FROM argument
+            WHERE argument.instruction_id = instruction.instruction_id
+                AND argument.name = 'queryID'
+            LIMIT 1), x'')), 'hex') AS query_iid,
+    encode(instruction.instance_iid, 'hex') AS project_id,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'userID'
+        LIMIT 1) AS user_id,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'queryID'
+        LIMIT 1) AS query_id,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'queryDefinition'
+        LIMIT 1) AS query_definition,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'description'
+        LIMIT 1) AS description,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'issuer'
+        LIMIT 1) AS issuer,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'subjectHash'
+        LIMIT 1) AS subject_hash,
+    (SELECT CAST(status.value AS TEXT)
+        FROM instruction AS last_update
+        JOIN "transaction" AS update_transaction ON
+            update_transaction.transaction_id = last_update.transaction_id
+        JOIN argument AS status ON
+            status.instruction_id = last_update.instruction_id
+                AND status.name = 'status'
+        WHERE last_update.action = 'invoke:query.update'
+            AND last_update.instance_iid = sha256('query', instruction.instance_iid,
+                coalesce((SELECT value FROM argument
+                    WHERE argument.instruction_id = instruction.instruction_id
+                        AND argument.name = 'queryID'
+                    LIMIT 1), x''))
+            AND update_transaction.accepted
+        ORDER BY last_update.instruction_id DESC
+        LIMIT 1) AS last_status,
+    (SELECT group_concat(identity, ' ') FROM (SELECT identity FROM signer
+        WHERE signer.instruction_id = instruction.instruction_id
+        ORDER BY identity)) AS signers
+FROM instruction
+JOIN "transaction" ON
+    "transaction".transaction_id = instruction.transaction_id
+JOIN block ON
+    block.block_id = "transaction".block_id
+WHERE instruction.action = 'spawn:query';
+
+CREATE VIEW IF NOT EXISTS cothority.authorization_events AS
+SELECT
+    instruction.instruction_id,
+    block.hash AS block_hash,
+    "transaction".accepted,
+    instruction.action,
+    CASE instruction.action
+        WHEN 'invoke:project.add' THEN 'grant'
+        WHEN 'invoke:project.remove' THEN 'revoke'
+        WHEN 'invoke:query.approve' THEN 'approve'
+        WHEN 'invoke:query.deny' THEN 'deny'
+        WHEN 'invoke:user.addIdentity' THEN 'addIdentity'
+        WHEN 'invoke:user.removeIdentity' THEN 'removeIdentity'
+    END AS kind,
+    encode(instruction.instance_iid, 'hex') AS instance_id,
+    CASE instruction.contract_name
+        WHEN 'project' THEN (SELECT CAST(value AS TEXT) FROM argument
+            WHERE argument.instruction_id = instruction.instruction_id
+                AND argument.name = 'userID'
+            LIMIT 1)
+        WHEN 'query' THEN (SELECT queries.user_id FROM queries
+            WHERE queries.query_iid = encode(instruction.instance_iid, 'hex')
+                AND queries.accepted
+            LIMIT 1)
+        WHEN 'user' THEN (SELECT CAST(user_id.value AS TEXT)
+            FROM instruction AS spawn
+            JOIN argument AS user_id ON
+                user_id.instruction_id = spawn.instruction_id
+                    AND user_id.name = 'userID'
+            WHERE spawn.action = 'spawn:user'
+                AND sha256('user', user_id.value) = instruction.instance_iid
+            LIMIT 1)
+    END AS user_id,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'queryTerm'
+        LIMIT 1) AS query_terms,
+    (SELECT encode(value, 'hex') FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'datasetID'
+        LIMIT 1) AS dataset_id,
+    (SELECT CAST(value AS TEXT) FROM argument
+        WHERE argument.instruction_id = instruction.instruction_id
+            AND argument.name = 'identity'
+        LIMIT 1) AS identities,
+    (SELECT group_concat(identity, ' ') FROM (SELECT identity FROM signer
+        WHERE signer.instruction_id = instruction.instruction_id
+        ORDER BY identity)) AS signers
+FROM instruction
+JOIN "transaction" ON
+    "transaction".transaction_id = instruction.transaction_id
+JOIN block ON
+    block.block_id = "transaction".block_id
+WHERE instruction.action IN (
+    'invoke:project.add',
+    'invoke:project.remove',
+    'invoke:query.approve',
+    'invoke:query.deny',
+    'invoke:user.addIdentity',
+    'invoke:user.removeIdentity');
+`
+
+// chainIndex is created once the skipchain ID column exists.
+const chainIndex = `CREATE INDEX IF NOT EXISTS cothority.block_skipchain_id_idx
+    ON block (skipchain_id)`
+
+// drivers counts the SQLite drivers registered, each database needing its own
+// to attach its file.
+var drivers int64
+
+// SQLite stores the blocks in an embedded SQLite database, with the same
+// tables as the ByzCoin proxy.
+//
+// - implements storage.Storage
+type SQLite struct {
+	db   *sql.DB
+	dbRo *sql.DB
+}
+
+var _ storage.Storage = (*SQLite)(nil)
+
+// NewSQLite opens the database at the given path, creating it if needed.
+func NewSQLite(path string) (*SQLite, error) {
+	db, err := open(path, false)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open db: %v", err)
+	}
+
+	_, err = db.Exec(schema)
+	if err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("failed to create schema: %v", err)
+	}
+
+	err = chainColumn(db)
+	if err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("failed to add skipchain ID: %v", err)
+	}
+
+	_, err = db.Exec(views)
+	if err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("failed to create views: %v", err)
+	}
+
+	dbRo, err := open(path, true)
+	if err != nil {
+		db.Close()
+		return nil, xerrors.Errorf("failed to open dbRo: %v", err)
+	}
+
+	return &SQLite{
+		db:   db,
+		dbRo: dbRo,
+	}, nil
+}
+
+// chainColumn adds the skipchain ID to the blocks of the databases created
+// when the indexer followed a single chain. Their blocks have a NULL ID until
+// SetChain is called for them.
+func chainColumn(db *sql.DB) error {
+	rows, err := db.Query(`PRAGMA cothority.table_info(block)`)
+	if err != nil {
+		return xerrors.Errorf("failed to get columns: %v", err)
+	}
+
+	found := false
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, kind       string
+			dflt             interface{}
+		)
+
+		err = rows.Scan(&cid, &name, &kind, &notNull, &dflt, &pk)
+		if err != nil {
+			rows.Close()
+			return xerrors.Errorf("failed to scan column: %v", err)
+		}
+
+		found = found || name == "skipchain_id"
+	}
+
+	rows.Close()
+
+	if !found {
+		_, err = db.Exec(`ALTER TABLE cothority.block ADD COLUMN skipchain_id BLOB`)
+		if err != nil {
+			return xerrors.Errorf("failed to add column: %v", err)
+		}
+	}
+
+	_, err = db.Exec(chainIndex)
+	if err != nil {
+		return xerrors.Errorf("failed to create index: %v", err)
+	}
+
+	return nil
+}
+
+// open opens a pool of connections to an in-memory database, on which the
+// file is attached as "cothority", and as "medchain" for the read-only
+// connections. The functions used by the MedChain queries
+// that SQLite lacks are defined on each connection.
+func open(path string, readOnly bool) (*sql.DB, error) {
+	name := fmt.Sprintf("sqlite3_medchain_%d", atomic.AddInt64(&drivers, 1))
+
+	sql.Register(name, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			err := conn.RegisterFunc("encode", encode, true)
+			if err != nil {
+				return xerrors.Errorf("failed to register encode: %v", err)
+			}
+
+			err = conn.RegisterFunc("decode", decode, true)
+			if err != nil {
+				return xerrors.Errorf("failed to register decode: %v", err)
+			}
+
+			err = conn.RegisterFunc("sha256", hash, true)
+			if err != nil {
+				return xerrors.Errorf("failed to register sha256: %v", err)
+			}
+
+			pragmas := []string{
+				"PRAGMA foreign_keys = ON",
+				"PRAGMA busy_timeout = 5000",
+			}
+
+			if readOnly {
+				pragmas = append(pragmas, "PRAGMA query_only = ON")
+			}
+
+			// the path is quoted as an SQL string
+			quoted := strings.ReplaceAll(path, "'", "''")
+			stmts := []string{fmt.Sprintf("ATTACH DATABASE '%s' AS cothority", quoted)}
+
+			if readOnly {
+				// the medchain views are stored with the tables
+				stmts = append(stmts, fmt.Sprintf("ATTACH DATABASE '%s' AS medchain", quoted))
+			}
+
+			for _, stmt := range append(stmts, pragmas...) {
+				_, err = conn.Exec(stmt, nil)
+				if err != nil {
+					return xerrors.Errorf("failed to run '%s': %v", stmt, err)
+				}
+			}
+
+			return nil
+		},
+	})
+
+	db, err := sql.Open(name, ":memory:")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to open: %v", err)
+	}
+
+	if !readOnly {
+		// SQLite allows a single writer
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, nil
+}
+
+// encode implements the Postgres function on binary strings.
+func encode(data []byte, format string) (string, error) {
+	switch format {
+	case "hex":
+		return hex.EncodeToString(data), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data), nil
+	default:
+		return "", xerrors.Errorf("unknown format '%s'", format)
+	}
+}
+
+// decode implements the Postgres function on binary strings.
+func decode(data string, format string) ([]byte, error) {
+	switch format {
+	case "hex":
+		return hex.DecodeString(data)
+	case "base64":
+		return base64.StdEncoding.DecodeString(data)
+	default:
+		return nil, xerrors.Errorf("unknown format '%s'", format)
+	}
+}
+
+// hash returns the SHA-256 of the concatenation of its arguments, or NULL if
+// one of them is NULL. Unlike the Postgres function, which takes a single
+// binary string, it is variadic since the SQLite concatenation of binary
+// strings returns a text.
+func hash(values ...interface{}) ([]byte, error) {
+	h := sha256.New()
+
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+			return nil, nil
+		case []byte:
+			h.Write(v)
+		case string:
+			h.Write([]byte(v))
+		default:
+			return nil, xerrors.Errorf("unsupported type %T", value)
+		}
+	}
+
+	return h.Sum(nil), nil
+}
+
+// Close closes the connections.
+func (s *SQLite) Close() {
+	s.db.Close()
+	s.dbRo.Close()
+}
+
+// GetBlock implements storage.Storage. It returns -1 if the block is not found,
+// otherwise its primary key.
+func (s *SQLite) GetBlock(blockHash []byte) (int, error) {
+	var blockID int
+
+	err := s.dbRo.QueryRow(`SELECT block_id FROM cothority.block WHERE hash = ?`,
+		blockHash).Scan(&blockID)
+	if err == sql.ErrNoRows {
+		return -1, nil
+	}
+
+	if err != nil {
+		return -1, xerrors.Errorf("failed to fetch block: %v", err)
+	}
+
+	return blockID, nil
+}
+
+// SetChain records the skipchain ID of a block stored before the ID was, and
+// does nothing otherwise.
+func (s *SQLite) SetChain(blockID int, scID skipchain.SkipBlockID) error {
+	_, err := s.db.Exec(`UPDATE cothority.block SET skipchain_id = ?
+		WHERE block_id = ? AND skipchain_id IS NULL`, []byte(scID), blockID)
+	if err != nil {
+		return xerrors.Errorf("failed to update block: %v", err)
+	}
+
+	return nil
+}
+
+// StoreBlock implements storage.Storage. It stores the block and its
+// transactions as the ByzCoin proxy does, and returns its primary key.
+func (s *SQLite) StoreBlock(block *skipchain.SkipBlock) (int, error) {
+	var body byzcoin.DataBody
+
+	err := protobuf.Decode(block.Payload, &body)
+	if err != nil {
+		return -1, xerrors.Errorf("failed to decode block payload: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return -1, xerrors.Errorf("failed to begin transaction: %v", err)
+	}
+
+	blockID, err := storeBlock(tx, block.Hash, block.SkipChainID(), body)
+	if err != nil {
+		tx.Rollback()
+		return -1, xerrors.Errorf("failed to store block: %v", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return -1, xerrors.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return blockID, nil
+}
+
+func storeBlock(tx *sql.Tx, hash, scID []byte, body byzcoin.DataBody) (int, error) {
+	blockID, err := insert(tx, `INSERT INTO cothority.block (hash, skipchain_id)
+		VALUES (?, ?)`, hash, scID)
+	if err != nil {
+		return -1, xerrors.Errorf("failed to insert block: %v", err)
+	}
+
+	for _, result := range body.TxResults {
+		transactionID, err := insert(tx, `INSERT INTO cothority."transaction"
+			(accepted, block_id) VALUES (?, ?)`, result.Accepted, blockID)
+		if err != nil {
+			return -1, xerrors.Errorf("failed to insert transaction: %v", err)
+		}
+
+		for _, instruction := range result.ClientTransaction.Instructions {
+			err = storeInstruction(tx, instruction, transactionID)
+			if err != nil {
+				return -1, xerrors.Errorf("failed to store instruction: %v", err)
+			}
+		}
+	}
+
+	return blockID, nil
+}
+
+func storeInstruction(tx *sql.Tx, instruction byzcoin.Instruction, transactionID int) error {
+	contractIID := instruction.InstanceID
+
+	if instruction.GetType() == byzcoin.SpawnType {
+		contractIID = instruction.DeriveID("")
+	}
+
+	if byzcoin.ConfigInstanceID.Equal(instruction.InstanceID) {
+		contractIID = byzcoin.ConfigInstanceID
+	} else if byzcoin.NamingInstanceID.Equal(instruction.InstanceID) {
+		contractIID = byzcoin.NamingInstanceID
+	}
+
+	typeID := 1
+
+	switch instruction.GetType() {
+	case byzcoin.SpawnType:
+		typeID = 2
+	case byzcoin.InvokeType:
+		typeID = 3
+	case byzcoin.DeleteType:
+		typeID = 4
+	}
+
+	instructionID, err := insert(tx, `INSERT INTO cothority.instruction
+		(transaction_id, type_id, action, instance_iid, contract_iid, contract_name)
+		VALUES (?, ?, ?, ?, ?, ?)`, transactionID, typeID, instruction.Action(),
+		instruction.InstanceID.Slice(), contractIID.Slice(), instruction.ContractID())
+	if err != nil {
+		return xerrors.Errorf("failed to insert instruction: %v", err)
+	}
+
+	if len(instruction.SignerIdentities) != len(instruction.Signatures) ||
+		len(instruction.SignerCounter) != len(instruction.Signatures) {
+
+		return xerrors.Errorf("invalid instruction: %v", instruction)
+	}
+
+	for i, signature := range instruction.Signatures {
+		_, err = insert(tx, `INSERT INTO cothority.signer
+			(identity, signature, counter, instruction_id) VALUES (?, ?, ?, ?)`,
+			instruction.SignerIdentities[i].String(), signature,
+			int64(instruction.SignerCounter[i]), instructionID)
+		if err != nil {
+			return xerrors.Errorf("failed to insert signer: %v", err)
+		}
+	}
+
+	for _, name := range instruction.Arguments().Names() {
+		_, err = insert(tx, `INSERT INTO cothority.argument
+			(name, value, instruction_id) VALUES (?, ?, ?)`,
+			name, instruction.Arguments().Search(name), instructionID)
+		if err != nil {
+			return xerrors.Errorf("failed to insert argument: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// insert executes the statement and returns the ID of the inserted row.
+func insert(tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return -1, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, xerrors.Errorf("failed to get ID: %v", err)
+	}
+
+	return int(id), nil
+}
+
+// Query implements storage.Storage. It runs the query on a read-only
+// connection and returns the rows in JSON, as the ByzCoin proxy does.
+func (s *SQLite) Query(query string) ([]byte, error) {
+	rows, err := s.dbRo.Query(query)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to execute query: %v", err)
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to get column types: %v", err)
+	}
+
+	result := []map[string]interface{}{}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		for i := range values {
+			values[i] = new(interface{})
+		}
+
+		err = rows.Scan(values...)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to scan: %v", err)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+
+		for i, column := range columns {
+			row[column.Name()] = jsonValue(column.DatabaseTypeName(),
+				*values[i].(*interface{}))
+		}
+
+		result = append(result, row)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read rows: %v", err)
+	}
+
+	buf, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to marshal JSON: %v", err)
+	}
+
+	return buf, nil
+}
+
+// jsonValue converts a value as the ByzCoin proxy does: booleans and integers
+// are kept, everything else is a string, NULL values being zero values.
+func jsonValue(columnType string, value interface{}) interface{} {
+	switch columnType {
+	case "BOOLEAN":
+		switch v := value.(type) {
+		case bool:
+			return v
+		case int64:
+			return v != 0
+		default:
+			return false
+		}
+	case "INTEGER":
+		if v, ok := value.(int64); ok {
+			return v
+		}
+
+		return 0
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case bool:
+		return v
+	case int64:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
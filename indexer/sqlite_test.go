@@ -0,0 +1,325 @@
+package indexer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+)
+
+func TestSQLite_StoreBlock(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+
+	body := byzcoin.DataBody{TxResults: byzcoin.TxResults{{
+		ClientTransaction: byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{{
+			InstanceID: byzcoin.NewInstanceID([]byte("darc")),
+			Spawn: &byzcoin.Spawn{
+				ContractID: "project",
+				Args:       byzcoin.Arguments{{Name: "name", Value: []byte("name")}},
+			},
+			SignerIdentities: []darc.Identity{signer.Identity()},
+			SignerCounter:    []uint64{1},
+			Signatures:       [][]byte{[]byte("signature")},
+		}}},
+		Accepted: true,
+	}, {
+		ClientTransaction: byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{{
+			InstanceID: byzcoin.NewInstanceID([]byte("project")),
+			Invoke: &byzcoin.Invoke{
+				ContractID: "project",
+				Command:    "add",
+			},
+		}}},
+		Accepted: false,
+	}}}
+
+	payload, err := protobuf.Encode(&body)
+	require.NoError(t, err)
+
+	block := skipchain.NewSkipBlock()
+	block.Payload = payload
+	block.Hash = block.CalculateHash()
+
+	id, err := db.GetBlock(block.Hash)
+	require.NoError(t, err)
+	require.Equal(t, -1, id)
+
+	id, err = db.StoreBlock(block)
+	require.NoError(t, err)
+
+	stored, err := db.GetBlock(block.Hash)
+	require.NoError(t, err)
+	require.Equal(t, id, stored)
+
+	// the same block can't be stored twice
+	_, err = db.StoreBlock(block)
+	require.Error(t, err)
+
+	res, err := db.Query(`select
+	instruction.instruction_id as id,
+	"transaction".accepted as accepted,
+	instruction.action as action,
+	encode(instruction.contract_iid, 'hex') as contract,
+	argument.name as name,
+	argument.value = decode('6e616d65', 'hex') as matches,
+	signer.identity as identity
+from cothority.instruction
+join cothority."transaction" on
+	"transaction".transaction_id = instruction.transaction_id
+left join cothority.argument on
+	argument.instruction_id = instruction.instruction_id
+left join cothority.signer on
+	signer.instruction_id = instruction.instruction_id
+order by instruction.instruction_id`)
+	require.NoError(t, err)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(res, &rows))
+
+	derived := body.TxResults[0].ClientTransaction.Instructions[0].DeriveID("")
+
+	require.Equal(t, []map[string]interface{}{{
+		"id":       1.0,
+		"accepted": true,
+		"action":   "spawn:project",
+		"contract": derived.String(),
+		"name":     "name",
+		"matches":  1.0,
+		"identity": signer.Identity().String(),
+	}, {
+		"id":       2.0,
+		"accepted": false,
+		"action":   "invoke:project.add",
+		"contract": byzcoin.NewInstanceID([]byte("project")).String(),
+		"name":     "",
+		"matches":  "",
+		"identity": "",
+	}}, rows)
+
+	// the queries are read-only
+	_, err = db.Query("delete from cothority.block")
+	require.Error(t, err)
+
+	_, err = db.Query("select encode(hash, 'unknown') from cothority.block")
+	require.Error(t, err)
+}
+
+func TestSQLite_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := NewSQLite(path)
+	require.NoError(t, err)
+
+	block := skipchain.NewSkipBlock()
+	block.Hash = block.CalculateHash()
+
+	_, err = db.StoreBlock(block)
+	require.NoError(t, err)
+
+	db.Close()
+
+	db, err = NewSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	id, err := db.GetBlock(block.Hash)
+	require.NoError(t, err)
+	require.NotEqual(t, -1, id)
+}
+
+func TestSQLite_ChainColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// a database of the indexer following a single chain
+	old, err := open(path, false)
+	require.NoError(t, err)
+
+	_, err = old.Exec(`CREATE TABLE cothority.block (
+    block_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash BLOB NOT NULL
+);
+INSERT INTO cothority.block (hash) VALUES (x'01');`)
+	require.NoError(t, err)
+	require.NoError(t, old.Close())
+
+	db, err := NewSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	genesis := skipchain.NewSkipBlock()
+	genesis.Hash = genesis.CalculateHash()
+
+	_, err = db.StoreBlock(genesis)
+	require.NoError(t, err)
+
+	query := `select encode(hash, 'hex') as hash, skipchain_id is null as legacy
+from cothority.block order by block_id`
+
+	res, err := db.Query(query)
+	require.NoError(t, err)
+
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(res, &rows))
+
+	require.Equal(t, []map[string]interface{}{
+		{"hash": "01", "legacy": 1.0},
+		{"hash": hex.EncodeToString(genesis.Hash), "legacy": 0.0},
+	}, rows)
+
+	// the chain of the old blocks is set when they are indexed again
+	require.NoError(t, db.SetChain(1, genesis.Hash))
+	require.NoError(t, db.SetChain(2, []byte("other")))
+
+	res, err = db.Query(`select encode(skipchain_id, 'hex') as chain
+from cothority.block order by block_id`)
+	require.NoError(t, err)
+
+	require.JSONEq(t, fmt.Sprintf(`[{"chain": "%x"}, {"chain": "%x"}]`,
+		genesis.Hash, genesis.Hash), string(res))
+}
+
+func TestSQLite_Views(t *testing.T) {
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	darcID := byzcoin.NewInstanceID([]byte("darc"))
+
+	signed := func(inst byzcoin.Instruction) byzcoin.Instruction {
+		inst.SignerIdentities = []darc.Identity{signer.Identity()}
+		inst.SignerCounter = []uint64{1}
+		inst.Signatures = [][]byte{[]byte("signature")}
+		return inst
+	}
+
+	spawnProject := signed(byzcoin.Instruction{
+		InstanceID: darcID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: "project",
+			Args:       byzcoin.Arguments{{Name: "name", Value: []byte("name")}},
+		},
+	})
+	projectID := spawnProject.DeriveID("")
+
+	spawnUser := signed(byzcoin.Instruction{
+		InstanceID: darcID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: "user",
+			Args:       byzcoin.Arguments{{Name: "userID", Value: []byte("alice")}},
+		},
+	})
+
+	queryIID := sha256.Sum256(append(append([]byte("query"), projectID.Slice()...), "q1"...))
+	userIID := sha256.Sum256([]byte("useralice"))
+
+	body := byzcoin.DataBody{TxResults: byzcoin.TxResults{{
+		ClientTransaction: byzcoin.ClientTransaction{Instructions: byzcoin.Instructions{
+			spawnProject,
+			spawnUser,
+			signed(byzcoin.Instruction{
+				InstanceID: projectID,
+				Invoke: &byzcoin.Invoke{
+					ContractID: "project",
+					Command:    "add",
+					Args: byzcoin.Arguments{
+						{Name: "userID", Value: []byte("alice")},
+						{Name: "queryTerm", Value: []byte("count")},
+					},
+				},
+			}),
+			signed(byzcoin.Instruction{
+				InstanceID: projectID,
+				Spawn: &byzcoin.Spawn{
+					ContractID: "query",
+					Args: byzcoin.Arguments{
+						{Name: "userID", Value: []byte("alice")},
+						{Name: "queryID", Value: []byte("q1")},
+						{Name: "queryDefinition", Value: []byte("count")},
+					},
+				},
+			}),
+			signed(byzcoin.Instruction{
+				InstanceID: byzcoin.NewInstanceID(queryIID[:]),
+				Invoke: &byzcoin.Invoke{
+					ContractID: "query",
+					Command:    "update",
+					Args:       byzcoin.Arguments{{Name: "status", Value: []byte("success")}},
+				},
+			}),
+			signed(byzcoin.Instruction{
+				InstanceID: byzcoin.NewInstanceID(queryIID[:]),
+				Invoke: &byzcoin.Invoke{
+					ContractID: "query",
+					Command:    "approve",
+					Args:       byzcoin.Arguments{{Name: "datasetID", Value: []byte("ds")}},
+				},
+			}),
+			signed(byzcoin.Instruction{
+				InstanceID: byzcoin.NewInstanceID(userIID[:]),
+				Invoke: &byzcoin.Invoke{
+					ContractID: "user",
+					Command:    "addIdentity",
+					Args:       byzcoin.Arguments{{Name: "identity", Value: []byte("ed25519:id")}},
+				},
+			}),
+		}},
+		Accepted: true,
+	}}}
+
+	payload, err := protobuf.Encode(&body)
+	require.NoError(t, err)
+
+	block := skipchain.NewSkipBlock()
+	block.Payload = payload
+	block.Hash = block.CalculateHash()
+
+	_, err = db.StoreBlock(block)
+	require.NoError(t, err)
+
+	res, err := db.Query(`select instruction_id, encode(block_hash, 'hex') as block,
+	project_id, name, darc_id, signers from medchain.projects`)
+	require.NoError(t, err)
+
+	require.JSONEq(t, fmt.Sprintf(`[{"instruction_id": 1, "block": "%x",
+		"project_id": "%s", "name": "name", "darc_id": "%s", "signers": "%s"}]`,
+		block.Hash, projectID, darcID, signer.Identity()), string(res))
+
+	res, err = db.Query(`select accepted, query_iid, project_id, user_id, query_id,
+	query_definition, last_status from medchain.queries`)
+	require.NoError(t, err)
+
+	require.JSONEq(t, fmt.Sprintf(`[{"accepted": true, "query_iid": "%x",
+		"project_id": "%s", "user_id": "alice", "query_id": "q1",
+		"query_definition": "count", "last_status": "success"}]`,
+		queryIID, projectID), string(res))
+
+	res, err = db.Query(`select kind, instance_id, user_id, query_terms, dataset_id,
+	identities from medchain.authorization_events order by instruction_id`)
+	require.NoError(t, err)
+
+	require.JSONEq(t, fmt.Sprintf(`[
+		{"kind": "grant", "instance_id": "%s", "user_id": "alice", "query_terms": "count",
+			"dataset_id": "", "identities": ""},
+		{"kind": "approve", "instance_id": "%x", "user_id": "alice", "query_terms": "",
+			"dataset_id": "%x", "identities": ""},
+		{"kind": "addIdentity", "instance_id": "%x", "user_id": "alice", "query_terms": "",
+			"dataset_id": "", "identities": "ed25519:id"}]`,
+		projectID, queryIID, "ds", userIID), string(res))
+
+	// the views are read-only
+	_, err = db.Query("delete from medchain.projects")
+	require.Error(t, err)
+}
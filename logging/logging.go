@@ -0,0 +1,237 @@
+// Package logging writes the logs of a MedChain conode as JSON lines, so that
+// they can be indexed by a log pipeline.
+//
+// Once enabled, every message of onet is written as a JSON object instead of
+// text, with the node and the package of the caller. The contracts log their
+// decisions with Decision, which adds the contract, the instance and the
+// instruction, and the reason of the decision.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// DecisionLevel is the debug level of the decisions of the contracts.
+const DecisionLevel = 2
+
+// The levels of onet that are not debug levels.
+const (
+	lvlWarning = iota - 20
+	lvlError
+	lvlFatal
+	lvlPanic
+	lvlInfo
+	lvlPrint
+)
+
+// silentLevel is below every level of onet, so that the standard logger of
+// onet, which can't be removed, doesn't print anything.
+const silentLevel = lvlWarning - 1
+
+// active is the JSON logger, if enabled.
+var active struct {
+	sync.Mutex
+	logger *jsonLogger
+	key    int
+}
+
+// Entry is a line of the logs.
+type Entry struct {
+	Time        string `json:"time"`
+	Level       string `json:"level"`
+	Debug       int    `json:"debug,omitempty"`
+	Node        string `json:"node,omitempty"`
+	Service     string `json:"service,omitempty"`
+	Contract    string `json:"contract,omitempty"`
+	Instance    string `json:"instance,omitempty"`
+	Instruction string `json:"instruction,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	Message     string `json:"msg"`
+}
+
+// EnableJSON replaces the text output of onet by JSON lines written to w, for
+// the messages up to the debug level. The node is added to every line.
+func EnableJSON(w io.Writer, level int, node string) {
+	DisableJSON()
+
+	l := &jsonLogger{
+		info: &log.LoggerInfo{DebugLvl: level, RawMessage: true},
+		w:    w,
+		node: node,
+	}
+
+	active.Lock()
+	active.logger = l
+	active.key = log.RegisterLogger(l)
+	active.Unlock()
+
+	log.SetDebugVisible(silentLevel)
+}
+
+// DisableJSON restores the text output of onet, with the debug level of the
+// JSON logger.
+func DisableJSON() {
+	active.Lock()
+	defer active.Unlock()
+
+	if active.logger == nil {
+		return
+	}
+
+	log.UnregisterLogger(active.key)
+	log.SetDebugVisible(active.logger.info.DebugLvl)
+
+	active.logger = nil
+}
+
+// Decision logs a decision of a contract on the instruction, with its reason if
+// any. The instance is the one of the instruction, or the one created by a
+// spawn when it is given.
+func Decision(contractID string, inst byzcoin.Instruction, instance byzcoin.InstanceID,
+	msg string, reason string) {
+
+	if instance.Equal(byzcoin.InstanceID{}) {
+		instance = inst.InstanceID
+	}
+
+	entry := Entry{
+		Service:     "contracts",
+		Contract:    contractID,
+		Instance:    instance.String(),
+		Instruction: inst.Action(),
+		Reason:      reason,
+		Message:     msg,
+	}
+
+	active.Lock()
+	l := active.logger
+	active.Unlock()
+
+	if l != nil {
+		if DecisionLevel <= l.info.DebugLvl {
+			l.write(DecisionLevel, entry)
+		}
+		return
+	}
+
+	text := fmt.Sprintf("%s [contract=%s instance=%s instruction=%s]", msg,
+		entry.Contract, entry.Instance, entry.Instruction)
+	if reason != "" {
+		text += ": " + reason
+	}
+
+	log.Lvl2(text)
+}
+
+// jsonLogger implements log.Logger.
+type jsonLogger struct {
+	sync.Mutex
+	info *log.LoggerInfo
+	w    io.Writer
+	node string
+}
+
+// Log implements log.Logger. It is called by onet with its lock held, and
+// must therefore not log.
+func (l *jsonLogger) Log(level int, msg string) {
+	l.write(level, Entry{Service: callerPackage(), Message: msg})
+}
+
+// Close implements log.Logger.
+func (l *jsonLogger) Close() {}
+
+// GetLoggerInfo implements log.Logger.
+func (l *jsonLogger) GetLoggerInfo() *log.LoggerInfo {
+	return l.info
+}
+
+func (l *jsonLogger) write(level int, entry Entry) {
+	entry.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	entry.Node = l.node
+	entry.Level = levelName(level)
+
+	if entry.Level == "debug" {
+		entry.Debug = level
+		if level < 0 {
+			entry.Debug = -level
+		}
+	}
+
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		// the entry only holds strings
+		panic(err)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.w.Write(append(buf, '\n'))
+}
+
+func levelName(level int) string {
+	switch level {
+	case lvlWarning:
+		return "warning"
+	case lvlError:
+		return "error"
+	case lvlFatal:
+		return "fatal"
+	case lvlPanic:
+		return "panic"
+	case lvlInfo, lvlPrint:
+		return "info"
+	}
+
+	return "debug"
+}
+
+// callerPackage returns the name of the package that called onet, such as
+// byzcoin or skipchain.
+func callerPackage() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+
+		fn := frame.Function
+		if fn != "" && !strings.HasPrefix(fn, "go.dedis.ch/onet/v3/log.") {
+			return packageName(fn)
+		}
+
+		if !more {
+			return ""
+		}
+	}
+}
+
+// packageName returns the name of the package of the function, such as onet
+// for go.dedis.ch/onet/v3.(*Server).Start.
+func packageName(fn string) string {
+	slash := strings.LastIndex(fn, "/")
+	if dot := strings.Index(fn[slash+1:], "."); dot >= 0 {
+		fn = fn[:slash+1+dot]
+	}
+
+	elements := strings.Split(fn, "/")
+	name := elements[len(elements)-1]
+
+	// the major version of a module is not the name of its package
+	if len(elements) > 1 && len(name) > 1 && name[0] == 'v' &&
+		strings.Trim(name[1:], "0123456789") == "" {
+		name = elements[len(elements)-2]
+	}
+
+	return name
+}
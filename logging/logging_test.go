@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/onet/v3/log"
+)
+
+func TestEnableJSON(t *testing.T) {
+	level := log.DebugVisible()
+	defer log.SetDebugVisible(level)
+
+	buf := new(bytes.Buffer)
+
+	EnableJSON(buf, 2, "tls://127.0.0.1:7770")
+
+	log.Lvl1("hello")
+	log.Lvl3("not visible")
+	log.Warn("careful")
+
+	inst := byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID([]byte("project")),
+		Spawn:      &byzcoin.Spawn{ContractID: "query"},
+	}
+	queryID := byzcoin.NewInstanceID([]byte("query"))
+
+	Decision("query", inst, queryID, "query rejected", "not authorized")
+
+	DisableJSON()
+	require.Equal(t, 2, log.DebugVisible())
+
+	log.Lvl1("not logged in JSON")
+
+	var entries []Entry
+
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		require.NotEmpty(t, entry.Time)
+
+		entry.Time = ""
+		entries = append(entries, entry)
+	}
+
+	require.Equal(t, []Entry{
+		{Level: "debug", Debug: 1, Node: "tls://127.0.0.1:7770", Service: "logging",
+			Message: "hello"},
+		{Level: "warning", Node: "tls://127.0.0.1:7770", Service: "logging",
+			Message: "careful"},
+		{Level: "debug", Debug: 2, Node: "tls://127.0.0.1:7770", Service: "contracts",
+			Contract: "query", Instance: queryID.String(), Instruction: "spawn:query",
+			Reason: "not authorized", Message: "query rejected"},
+	}, entries)
+}
+
+func TestPackageName(t *testing.T) {
+	require.Equal(t, "onet", packageName("go.dedis.ch/onet/v3.(*Server).Start"))
+	require.Equal(t, "byzcoin", packageName("go.dedis.ch/cothority/v3/byzcoin.(*Service).start"))
+	require.Equal(t, "contracts", packageName("github.com/ldsec/medchain/contracts.observe"))
+	require.Equal(t, "main", packageName("main.main"))
+}
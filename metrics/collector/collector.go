@@ -0,0 +1,244 @@
+// Package collector updates the MedChain metrics from the blocks added to the
+// chains held by the conode.
+package collector
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/ldsec/medchain/metrics"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+// ServiceName is the name of the collector service.
+const ServiceName = "MedChainMetrics"
+
+// pollInterval is the interval at which the collector looks for new chains.
+var pollInterval = 5 * time.Second
+
+// authorizationActions are the actions counted as changes of authorizations.
+var authorizationActions = map[string]bool{
+	"invoke:" + contracts.ProjectContractID + "." + contracts.ProjectAddAction:      true,
+	"invoke:" + contracts.ProjectContractID + "." + contracts.ProjectRemoveAction:   true,
+	"invoke:" + contracts.QueryContractID + "." + contracts.QueryApproveAction:      true,
+	"invoke:" + contracts.QueryContractID + "." + contracts.QueryDenyAction:         true,
+	"invoke:" + contracts.UserContractID + "." + contracts.UserAddIdentityAction:    true,
+	"invoke:" + contracts.UserContractID + "." + contracts.UserRemoveIdentityAction: true,
+}
+
+// Register registers the collector service. It must be called before the
+// conode is started.
+func Register() error {
+	_, err := onet.RegisterNewService(ServiceName, newService)
+	if err != nil {
+		return xerrors.Errorf("failed to register collector: %v", err)
+	}
+
+	return nil
+}
+
+// Service follows the chains held by the conode and updates the metrics with
+// their new blocks.
+type Service struct {
+	*onet.ServiceProcessor
+
+	sync.Mutex
+	// the stop channels of the streams, by chain
+	streams map[string]chan bool
+	closed  chan struct{}
+	done    sync.WaitGroup
+}
+
+func newService(c *onet.Context) (onet.Service, error) {
+	s := &Service{
+		ServiceProcessor: onet.NewServiceProcessor(c),
+		streams:          make(map[string]chan bool),
+		closed:           make(chan struct{}),
+	}
+
+	s.done.Add(1)
+	go s.poll()
+
+	return s, nil
+}
+
+// TestClose stops following the chains, so that the byzcoin service can be
+// closed.
+func (s *Service) TestClose() {
+	s.Lock()
+
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+
+	for id, stop := range s.streams {
+		close(stop)
+		delete(s.streams, id)
+	}
+
+	s.Unlock()
+
+	s.done.Wait()
+}
+
+// poll follows the new chains until the service is closed.
+func (s *Service) poll() {
+	defer s.done.Done()
+
+	for {
+		select {
+		case <-s.closed:
+			return
+		case <-time.After(pollInterval):
+		}
+
+		err := s.followChains()
+		if err != nil {
+			log.Warnf("failed to follow chains: %v", err)
+		}
+	}
+}
+
+// followChains starts to follow the chains that are not followed yet.
+func (s *Service) followChains() error {
+	resp, err := s.byzcoin().GetAllByzCoinIDs(&byzcoin.GetAllByzCoinIDsRequest{})
+	if err != nil {
+		return xerrors.Errorf("failed to get chains: %v", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	select {
+	case <-s.closed:
+		return nil
+	default:
+	}
+
+	for _, id := range resp.IDs {
+		_, found := s.streams[string(id)]
+		if found {
+			continue
+		}
+
+		err = s.follow(id)
+		if err != nil {
+			return xerrors.Errorf("failed to follow %x: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+// follow streams the blocks of the chain. It must be called with the lock
+// held.
+func (s *Service) follow(id skipchain.SkipBlockID) error {
+	latest, err := s.skipchainDB().GetLatestByID(id)
+	if err != nil {
+		return xerrors.Errorf("failed to get latest block: %v", err)
+	}
+
+	metrics.BlockHeight.Set(float64(latest.Index), hex.EncodeToString(id))
+
+	blocks, stop, err := s.byzcoin().StreamTransactions(&byzcoin.StreamingRequest{
+		ID: id,
+	})
+	if err != nil {
+		return xerrors.Errorf("failed to stream blocks: %v", err)
+	}
+
+	s.streams[string(id)] = stop
+
+	go func() {
+		for resp := range blocks {
+			err := s.collect(id, resp.Block)
+			if err != nil {
+				log.Warnf("failed to collect metrics of block %d: %v", resp.Block.Index, err)
+			}
+		}
+	}()
+
+	log.Lvlf2("collecting metrics of chain %x", id)
+
+	return nil
+}
+
+// collect updates the metrics of the chain with the transactions of the
+// block.
+func (s *Service) collect(id skipchain.SkipBlockID, block *skipchain.SkipBlock) error {
+	chain := hex.EncodeToString(id)
+
+	metrics.BlockHeight.Set(float64(block.Index), chain)
+
+	var body byzcoin.DataBody
+
+	err := protobuf.Decode(block.Payload, &body)
+	if err != nil {
+		return xerrors.Errorf("failed to decode body: %v", err)
+	}
+
+	for _, tx := range body.TxResults {
+		if !tx.Accepted {
+			metrics.RejectedTransactions.Inc(chain)
+			continue
+		}
+
+		for _, inst := range tx.ClientTransaction.Instructions {
+			action := inst.Action()
+
+			switch {
+			case action == "spawn:"+contracts.ProjectContractID:
+				metrics.Projects.Inc(chain)
+			case action == "spawn:"+contracts.QueryContractID:
+				metrics.Queries.Inc(chain, s.queryStatus(id, inst))
+			case authorizationActions[action]:
+				metrics.Authorizations.Inc(chain, action)
+			}
+		}
+	}
+
+	return nil
+}
+
+// queryStatus returns the status of the query spawned by the instruction, as
+// it is in the state change of the spawn. The status stored on the chain
+// might already have been updated by a later block.
+func (s *Service) queryStatus(id skipchain.SkipBlockID, inst byzcoin.Instruction) string {
+	queryID := string(inst.Spawn.Args.Search(contracts.QueryQueryIDKey))
+
+	// the version of an instance starts at 0 when it is spawned
+	resp, err := s.byzcoin().GetInstanceVersion(&byzcoin.GetInstanceVersion{
+		SkipChainID: id,
+		InstanceID:  contracts.NewQueryInstanceID(inst.InstanceID, queryID),
+		Version:     0,
+	})
+	if err != nil {
+		log.Warnf("failed to get state change: %v", err)
+		return "unknown"
+	}
+
+	query, err := contracts.DecodeQueryContract(resp.StateChange.Value)
+	if err != nil {
+		log.Warnf("failed to decode query: %v", err)
+		return "unknown"
+	}
+
+	return query.Status
+}
+
+func (s *Service) byzcoin() *byzcoin.Service {
+	return s.Service(byzcoin.ServiceName).(*byzcoin.Service)
+}
+
+func (s *Service) skipchainDB() *skipchain.SkipBlockDB {
+	return s.Service(skipchain.ServiceName).(*skipchain.Service).GetDB()
+}
@@ -0,0 +1,153 @@
+package collector
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/client"
+	"github.com/ldsec/medchain/contracts"
+	"github.com/ldsec/medchain/metrics"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3"
+	"go.dedis.ch/cothority/v3/bypros"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/onet/v3"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// The nodes of the tests share the metrics, every block is therefore
+// collected once per node.
+const nodes = 3
+
+func TestMain(m *testing.M) {
+	err := onet.UnregisterService(bypros.ServiceName)
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	err = Register()
+	if err != nil {
+		log.ErrFatal(err)
+	}
+
+	pollInterval = 100 * time.Millisecond
+
+	os.Exit(m.Run())
+}
+
+func TestService_Collect(t *testing.T) {
+	local := onet.NewTCPTest(cothority.Suite)
+	defer local.CloseAll()
+
+	signer := darc.NewSignerEd25519(nil, nil)
+	_, roster, _ := local.GenTree(nodes, true)
+
+	genesisMsg, err := byzcoin.DefaultGenesisMsg(byzcoin.CurrentVersion, roster,
+		[]string{"spawn:project", "spawn:user", "invoke:project.add"}, signer.Identity())
+	require.NoError(t, err)
+	gDarc := &genesisMsg.GenesisDarc
+
+	genesisMsg.BlockInterval = time.Second
+
+	bcl, _, err := byzcoin.NewLedger(genesisMsg, false)
+	require.NoError(t, err)
+
+	chain := hex.EncodeToString(bcl.ID)
+
+	// the chain is followed from its current block
+	require.Eventually(t, func() bool {
+		return metrics.BlockHeight.Value(chain) == 0 && followed(local, bcl.ID)
+	}, 5*time.Second, 100*time.Millisecond)
+
+	projects := metrics.Projects.Value(chain)
+	pending := metrics.Queries.Value(chain, contracts.QueryPendingStatus)
+	rejected := metrics.Queries.Value(chain, contracts.QueryRejectedStatus)
+	succeeded := metrics.Queries.Value(chain, contracts.QuerySuccessStatus)
+	grants := metrics.Authorizations.Value(chain, "invoke:project.add")
+	refused := metrics.RejectedTransactions.Value(chain)
+
+	cl := client.NewClient(bcl, nil)
+
+	ctx, err := cl.SendInstruction(byzcoin.Instruction{
+		InstanceID: byzcoin.NewInstanceID(gDarc.GetBaseID()),
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{{
+				Name:  contracts.ProjectNameKey,
+				Value: []byte("name"),
+			}},
+		},
+	}, signer)
+	require.NoError(t, err)
+
+	projectID := ctx.Instructions[0].DeriveID("")
+
+	user := darc.NewSignerEd25519(nil, nil)
+
+	err = cl.RegisterUser(gDarc.GetBaseID(), "userID", []darc.Identity{user.Identity()}, signer)
+	require.NoError(t, err)
+
+	_, err = cl.SpawnQuery(projectID, "userID", "query1", "q1", "", user)
+	require.NoError(t, err)
+
+	_, err = cl.Invoke(projectID, contracts.ProjectContractID, contracts.ProjectAddAction,
+		byzcoin.Arguments{
+			{Name: contracts.ProjectUserIDKey, Value: []byte("userID")},
+			{Name: contracts.ProjectQueryTermKey, Value: []byte("q1")},
+		}, signer)
+	require.NoError(t, err)
+
+	queryID, err := cl.SpawnQuery(projectID, "userID", "query2", "q1", "", user)
+	require.NoError(t, err)
+
+	// the status at the spawn is counted, whatever the status is when the
+	// block is collected
+	_, err = cl.Invoke(queryID, contracts.QueryContractID, contracts.QueryUpdateAction,
+		byzcoin.Arguments{
+			{Name: contracts.QueryStatusKey, Value: []byte(contracts.QuerySuccessStatus)},
+		}, user)
+	require.NoError(t, err)
+
+	// refused by the DARC
+	_, err = cl.Invoke(projectID, contracts.ProjectContractID, contracts.ProjectRemoveAction,
+		byzcoin.Arguments{
+			{Name: contracts.ProjectUserIDKey, Value: []byte("userID")},
+			{Name: contracts.ProjectQueryTermKey, Value: []byte("q1")},
+		}, signer)
+	require.Error(t, err)
+
+	require.Eventually(t, func() bool {
+		return metrics.RejectedTransactions.Value(chain)-refused == nodes
+	}, 10*time.Second, 100*time.Millisecond)
+
+	require.Equal(t, float64(nodes), metrics.Projects.Value(chain)-projects)
+	require.Equal(t, float64(nodes), metrics.Queries.Value(chain, contracts.QueryRejectedStatus)-rejected)
+	require.Equal(t, float64(nodes), metrics.Queries.Value(chain, contracts.QueryPendingStatus)-pending)
+	require.Equal(t, succeeded, metrics.Queries.Value(chain, contracts.QuerySuccessStatus))
+	require.Equal(t, float64(nodes), metrics.Authorizations.Value(chain, "invoke:project.add")-grants)
+	require.Greater(t, metrics.BlockHeight.Value(chain), 4.0)
+
+	// the contracts measure their execution
+	require.NotZero(t, metrics.ContractDuration.Count(contracts.QueryContractID, "spawn"))
+	require.NotZero(t, metrics.ContractDuration.Count(contracts.ProjectContractID, "invoke"))
+}
+
+// followed returns true if the collector of every node follows the chain.
+func followed(local *onet.LocalTest, id []byte) bool {
+	for _, srv := range local.Servers {
+		s := srv.Service(ServiceName).(*Service)
+
+		s.Lock()
+		_, found := s.streams[string(id)]
+		s.Unlock()
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
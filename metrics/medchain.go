@@ -0,0 +1,37 @@
+package metrics
+
+// The metrics of MedChain. The counters are updated by the collector from the
+// blocks added to the chains since the conode started, and are labelled with
+// the hex-encoded skipchain ID of the chain, so that a conode can serve
+// several consortia. The duration of the contracts is measured by the
+// contracts on every execution, which don't know the chain they run on.
+var (
+	// Projects counts the projects created, by chain.
+	Projects = NewCounter("medchain_projects_created_total",
+		"Projects created, by chain.", "chain")
+
+	// Queries counts the queries spawned, by chain and by the status given
+	// by the project.
+	Queries = NewCounter("medchain_queries_spawned_total",
+		"Queries spawned, by chain and status.", "chain", "status")
+
+	// Authorizations counts the changes of authorizations, by action: query
+	// terms granted or revoked on projects, custodian decisions, and
+	// identities of users added or removed, by chain.
+	Authorizations = NewCounter("medchain_authorization_changes_total",
+		"Changes of authorizations, by chain and action.", "chain", "action")
+
+	// RejectedTransactions counts the transactions refused by the ledger, by
+	// chain.
+	RejectedTransactions = NewCounter("medchain_rejected_transactions_total",
+		"Transactions refused by the ledger, by chain.", "chain")
+
+	// ContractDuration measures the execution of the MedChain contracts, by
+	// contract and type of instruction.
+	ContractDuration = NewHistogram("medchain_contract_duration_seconds",
+		"Execution time of the MedChain contracts.", DefaultBuckets, "contract", "type")
+
+	// BlockHeight is the index of the last block of each chain.
+	BlockHeight = NewGauge("byzcoin_block_height",
+		"Index of the last block of the chain.", "chain")
+)
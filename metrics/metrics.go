@@ -0,0 +1,410 @@
+// Package metrics exposes the metrics of a MedChain conode in the Prometheus
+// text format. It only implements the counters, gauges and histograms used by
+// MedChain, without any dependency.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric is a family of metrics that can be exposed.
+type Metric interface {
+	// Name returns the name of the family.
+	Name() string
+	// Write writes the family in the Prometheus text format.
+	Write(w io.Writer) error
+}
+
+// Registry holds the metrics to expose.
+type Registry struct {
+	sync.Mutex
+	metrics map[string]Metric
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]Metric),
+	}
+}
+
+// DefaultRegistry holds the metrics of MedChain.
+var DefaultRegistry = NewRegistry()
+
+// Register adds the metric to the registry. It panics if a metric with the
+// same name is already registered, as this is a programming error.
+func (r *Registry) Register(m Metric) {
+	r.Lock()
+	defer r.Unlock()
+
+	_, found := r.metrics[m.Name()]
+	if found {
+		panic("metric already registered: " + m.Name())
+	}
+
+	r.metrics[m.Name()] = m
+}
+
+// Write writes all the metrics, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.Lock()
+
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+
+	metrics := make([]Metric, len(names))
+
+	sort.Strings(names)
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+
+	r.Unlock()
+
+	for _, m := range metrics {
+		err := m.Write(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	err := r.Write(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// family holds the values of a metric for each combination of the values of
+// its labels.
+type family struct {
+	sync.Mutex
+	name   string
+	help   string
+	kind   string
+	labels []string
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+
+	// only for histograms
+	buckets []uint64
+	count   uint64
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	f := &family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+
+	// a metric without labels is exposed from the start
+	if len(labels) == 0 {
+		f.series[""] = &series{}
+	}
+
+	return f
+}
+
+// Name implements Metric.
+func (f *family) Name() string {
+	return f.name
+}
+
+// key checks the number of label values and returns the key of their
+// series. It doesn't need the lock as the labels are never modified.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d",
+			f.name, len(f.labels), len(values)))
+	}
+
+	return strings.Join(values, "\xff")
+}
+
+// get returns the series of the key. It must be called with the lock held.
+func (f *family) get(key string, values []string) *series {
+	s, found := f.series[key]
+	if !found {
+		s = &series{labels: append([]string{}, values...)}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+// sorted returns the series sorted by the values of their labels. It must be
+// called with the lock held.
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	res := make([]*series, len(keys))
+	for i, key := range keys {
+		res[i] = f.series[key]
+	}
+
+	return res
+}
+
+// Write implements Metric.
+func (f *family) Write(w io.Writer) error {
+	f.Lock()
+	defer f.Unlock()
+
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name,
+		escapeHelp(f.help), f.name, f.kind)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range f.sorted() {
+		_, err = fmt.Fprintf(w, "%s%s %s\n", f.name, formatLabels(f.labels, s.labels, "", ""),
+			formatValue(s.value))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Counter is a metric that can only increase.
+type Counter struct {
+	*family
+}
+
+// NewCounter creates a counter with the given labels and registers it in the
+// default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	DefaultRegistry.Register(c)
+
+	return c
+}
+
+// Inc increments the counter of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds a positive value to the counter of the label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("counter cannot decrease")
+	}
+
+	key := c.key(values)
+
+	c.Lock()
+	c.get(key, values).value += v
+	c.Unlock()
+}
+
+// Value returns the value of the counter of the label values.
+func (c *Counter) Value(values ...string) float64 {
+	key := c.key(values)
+
+	c.Lock()
+	defer c.Unlock()
+
+	return c.get(key, values).value
+}
+
+// Gauge is a metric that can be set to any value.
+type Gauge struct {
+	*family
+}
+
+// NewGauge creates a gauge with the given labels and registers it in the
+// default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	DefaultRegistry.Register(g)
+
+	return g
+}
+
+// Set sets the value of the gauge of the label values.
+func (g *Gauge) Set(v float64, values ...string) {
+	key := g.key(values)
+
+	g.Lock()
+	g.get(key, values).value = v
+	g.Unlock()
+}
+
+// Value returns the value of the gauge of the label values.
+func (g *Gauge) Value(values ...string) float64 {
+	key := g.key(values)
+
+	g.Lock()
+	defer g.Unlock()
+
+	return g.get(key, values).value
+}
+
+// DefaultBuckets are the upper bounds of the buckets of the histograms, in
+// seconds.
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// Histogram counts the observed values in buckets.
+type Histogram struct {
+	*family
+	bounds []float64
+}
+
+// NewHistogram creates a histogram with the given upper bounds and labels,
+// and registers it in the default registry.
+func NewHistogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		family: newFamily(name, help, "histogram", labels),
+		bounds: bounds,
+	}
+	DefaultRegistry.Register(h)
+
+	return h
+}
+
+// Observe adds a value to the histogram of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	key := h.key(values)
+
+	h.Lock()
+	defer h.Unlock()
+
+	s := h.get(key, values)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.bounds))
+	}
+
+	for i, bound := range h.bounds {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+
+	s.value += v
+	s.count++
+}
+
+// ObserveSince adds the duration since start, in seconds.
+func (h *Histogram) ObserveSince(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count returns the number of values observed for the label values.
+func (h *Histogram) Count(values ...string) uint64 {
+	key := h.key(values)
+
+	h.Lock()
+	defer h.Unlock()
+
+	return h.get(key, values).count
+}
+
+// Write implements Metric.
+func (h *Histogram) Write(w io.Writer) error {
+	h.Lock()
+	defer h.Unlock()
+
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name,
+		escapeHelp(h.help), h.name)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range h.sorted() {
+		for i, bound := range h.bounds {
+			var count uint64
+			if s.buckets != nil {
+				count = s.buckets[i]
+			}
+
+			_, err = fmt.Fprintf(w, "%s_bucket%s %d\n", h.name,
+				formatLabels(h.labels, s.labels, "le", formatValue(bound)), count)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, formatLabels(h.labels, s.labels, "le", "+Inf"), s.count,
+			h.name, formatLabels(h.labels, s.labels, "", ""), formatValue(s.value),
+			h.name, formatLabels(h.labels, s.labels, "", ""), s.count)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// formatLabels returns the labels with their values, and the extra label if
+// any, as in {a="1",b="2"}.
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+escapeValue(values[i])+`"`)
+	}
+
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var valueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeValue(s string) string {
+	return valueReplacer.Replace(s)
+}
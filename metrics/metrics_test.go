@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	counter := &Counter{newFamily("test_total", "A counter\nwith two lines.", "counter",
+		[]string{"status"})}
+	gauge := &Gauge{newFamily("test_gauge", "A gauge.", "gauge", nil)}
+	histogram := &Histogram{
+		family: newFamily("test_seconds", "A histogram.", "histogram", []string{"type"}),
+		bounds: []float64{0.1, 1},
+	}
+
+	r := NewRegistry()
+	r.Register(counter)
+	r.Register(gauge)
+	r.Register(histogram)
+
+	require.Panics(t, func() { r.Register(counter) })
+
+	counter.Inc("pending")
+	counter.Add(2, `re"jected`)
+	counter.Inc("pending")
+	require.Equal(t, 2.0, counter.Value("pending"))
+	require.Panics(t, func() { counter.Add(-1, "pending") })
+	require.Panics(t, func() { counter.Inc() })
+
+	gauge.Set(42)
+	gauge.Set(12)
+	require.Equal(t, 12.0, gauge.Value())
+
+	histogram.Observe(0.05, "spawn")
+	histogram.Observe(0.5, "spawn")
+	histogram.Observe(5, "spawn")
+	require.Equal(t, uint64(3), histogram.Count("spawn"))
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, r.Write(buf))
+
+	require.Equal(t, `# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 12
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{type="spawn",le="0.1"} 1
+test_seconds_bucket{type="spawn",le="1"} 2
+test_seconds_bucket{type="spawn",le="+Inf"} 3
+test_seconds_sum{type="spawn"} 5.55
+test_seconds_count{type="spawn"} 3
+# HELP test_total A counter\nwith two lines.
+# TYPE test_total counter
+test_total{status="pending"} 2
+test_total{status="re\"jected"} 2
+`, buf.String())
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, buf.String(), rec.Body.String())
+}
@@ -0,0 +1,150 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// The formats a report can be written in.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatHTML = "html"
+)
+
+// Write writes the report in the given format.
+func (r Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatCSV:
+		return r.WriteCSV(w)
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatHTML:
+		return r.WriteHTML(w)
+	default:
+		return xerrors.Errorf("unknown format '%s'", format)
+	}
+}
+
+var csvHeader = []string{"time", "block", "accepted", "kind", "action", "projectID",
+	"projectName", "userID", "queryID", "terms", "status", "reason", "signers"}
+
+// WriteCSV writes the events of the report, one per line.
+func (r Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+
+	err := out.Write(csvHeader)
+	if err != nil {
+		return xerrors.Errorf("failed to write header: %v", err)
+	}
+
+	for _, e := range r.Events {
+		err = out.Write([]string{
+			e.Time.UTC().Format(time.RFC3339),
+			strconv.Itoa(e.BlockIndex),
+			strconv.FormatBool(e.Accepted),
+			e.Kind,
+			e.Action,
+			e.ProjectID,
+			e.ProjectName,
+			e.UserID,
+			e.QueryID,
+			e.Terms,
+			e.Status,
+			e.Reason,
+			strings.Join(e.Signers, " "),
+		})
+		if err != nil {
+			return xerrors.Errorf("failed to write event: %v", err)
+		}
+	}
+
+	out.Flush()
+
+	return out.Error()
+}
+
+// WriteJSON writes the report in JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(r)
+	if err != nil {
+		return xerrors.Errorf("failed to encode report: %v", err)
+	}
+
+	return nil
+}
+
+// WriteHTML writes the report as a standalone HTML page, styled to be printed
+// or converted to PDF.
+func (r Report) WriteHTML(w io.Writer) error {
+	err := htmlTemplate.Execute(w, struct {
+		Report
+		Summary Summary
+	}{r, r.Summary()})
+	if err != nil {
+		return xerrors.Errorf("failed to execute template: %v", err)
+	}
+
+	return nil
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+
+		return t.UTC().Format("2006-01-02 15:04:05 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MedChain audit report</title>
+<style>
+@page { size: A4 landscape; margin: 1cm; }
+body { font-family: sans-serif; font-size: 10pt; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #999; padding: 2px 4px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+tr { page-break-inside: avoid; }
+td.id { font-family: monospace; font-size: 8pt; word-break: break-all; }
+tr.refused { color: #a00; }
+</style>
+</head>
+<body>
+<h1>MedChain audit report</h1>
+<p>
+Generated on {{date .Generated}}<br>
+Period: {{date .Filter.From}} to {{date .Filter.To}}<br>
+{{if .Filter.ProjectID}}Project: {{.Filter.ProjectID}}<br>{{end}}
+{{if .Filter.UserID}}User: {{.Filter.UserID}}<br>{{end}}
+</p>
+<h2>Summary</h2>
+<table>
+<tr><th>Grants</th><th>Revocations</th><th>Queries submitted</th><th>Queries rejected</th><th>Refused transactions</th></tr>
+<tr><td>{{.Summary.Grants}}</td><td>{{.Summary.Revocations}}</td><td>{{.Summary.Submitted}}</td><td>{{.Summary.Rejected}}</td><td>{{.Summary.Refused}}</td></tr>
+</table>
+<h2>Events</h2>
+<table>
+<tr><th>Time</th><th>Block</th><th>Event</th><th>Project</th><th>User</th><th>Query</th><th>Terms</th><th>Status</th><th>Reason</th><th>Signers</th></tr>
+{{range .Events}}<tr{{if not .Accepted}} class="refused"{{end}}>
+<td>{{date .Time}}</td><td>{{.BlockIndex}}</td><td>{{.Kind}}</td>
+<td class="id">{{.ProjectID}}{{if .ProjectName}} ({{.ProjectName}}){{end}}</td>
+<td>{{.UserID}}</td><td>{{.QueryID}}</td><td>{{.Terms}}</td><td>{{.Status}}</td><td>{{.Reason}}</td>
+<td class="id">{{range .Signers}}{{.}}<br>{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
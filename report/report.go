@@ -0,0 +1,667 @@
+// Package report generates audit reports of the MedChain activity: who was
+// granted which query terms and when, which queries were submitted, and which
+// were rejected and why.
+//
+// The events are read from the medchain views of the ByzCoin proxy (bypros),
+// which decode the instructions according to the MedChain contracts, and the
+// filters are applied by the SQL queries. The time of the events and the
+// state of the queries when they were spawned are read from the chain.
+package report
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"golang.org/x/xerrors"
+)
+
+// The kinds of events of a report.
+const (
+	ProjectCreated = "projectCreated"
+	TermsGranted   = "termsGranted"
+	TermsRevoked   = "termsRevoked"
+	QuerySubmitted = "querySubmitted"
+	QueryApproved  = "queryApproved"
+	QueryDenied    = "queryDenied"
+	QueryUpdated   = "queryUpdated"
+)
+
+// DB runs read-only SQL queries on the proxy tables and returns the rows
+// encoded in JSON, as done by the ByzCoin proxy.
+//
+// - implemented by client.Client
+type DB interface {
+	ProxyQuery(query string) ([]byte, error)
+}
+
+// Chain reads the blocks and the queries from the chain.
+//
+// - implemented by client.Client
+type Chain interface {
+	BlockTime(hash skipchain.SkipBlockID) (int, time.Time, error)
+	GetSpawnedQuery(id byzcoin.InstanceID) (*contracts.QueryContract, error)
+}
+
+// Filter selects the events of a report. Zero values select everything.
+type Filter struct {
+	From time.Time
+	To   time.Time
+	// ProjectID is the hex-encoded instance ID of a project.
+	ProjectID string
+	UserID    string
+}
+
+// Event is an action on the MedChain contracts.
+type Event struct {
+	Time       time.Time `json:"time"`
+	BlockIndex int       `json:"blockIndex"`
+	// Accepted tells if the transaction was accepted by the chain.
+	Accepted  bool   `json:"accepted"`
+	Kind      string `json:"kind"`
+	Action    string `json:"action"`
+	ProjectID string `json:"projectID,omitempty"`
+	// ProjectName is only set when the project is created.
+	ProjectName string `json:"projectName,omitempty"`
+	UserID      string `json:"userID,omitempty"`
+	QueryID     string `json:"queryID,omitempty"`
+	// Terms are the query terms granted or revoked, or the query definition.
+	Terms   string   `json:"terms,omitempty"`
+	Status  string   `json:"status,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+	Signers []string `json:"signers"`
+}
+
+// Report is the list of events matching a filter.
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Filter    Filter    `json:"filter"`
+	Events    []Event   `json:"events"`
+}
+
+// Summary counts the events of a report.
+type Summary struct {
+	Grants      int
+	Revocations int
+	Submitted   int
+	Rejected    int
+	Refused     int
+}
+
+// Summary returns the counts of the events of the report.
+func (r Report) Summary() Summary {
+	var s Summary
+
+	for _, e := range r.Events {
+		switch {
+		case !e.Accepted:
+			s.Refused++
+		case e.Kind == TermsGranted:
+			s.Grants++
+		case e.Kind == TermsRevoked:
+			s.Revocations++
+		case e.Kind == QuerySubmitted:
+			s.Submitted++
+
+			if e.Status == contracts.QueryRejectedStatus {
+				s.Rejected++
+			}
+		}
+	}
+
+	return s
+}
+
+// Generator generates reports.
+type Generator struct {
+	db    DB
+	chain Chain
+	// now is replaced in the tests.
+	now func() time.Time
+}
+
+// NewGenerator creates a report generator.
+func NewGenerator(db DB, chain Chain) *Generator {
+	return &Generator{
+		db:    db,
+		chain: chain,
+		now:   time.Now,
+	}
+}
+
+// row is a row of the queries of the events. The columns that don't apply to
+// an event are empty.
+type row struct {
+	ID       int    `json:"id"`
+	Block    string `json:"block"`
+	Accepted bool   `json:"accepted"`
+	Action   string `json:"action"`
+	// ProjectID is the hex-encoded instance ID of the project.
+	ProjectID   string `json:"project_id"`
+	ProjectName string `json:"project_name"`
+	UserID      string `json:"user_id"`
+	QueryID     string `json:"query_id"`
+	// QueryIID is the hex-encoded instance ID of the query.
+	QueryIID string `json:"query_iid"`
+	Terms    string `json:"terms"`
+	// Status is hex-encoded.
+	Status string `json:"status"`
+	// Signers are separated by spaces.
+	Signers string `json:"signers"`
+}
+
+// The queries of the events, completed with the conditions of the filter.
+// They use the medchain views, and only joins and the encode function
+// otherwise, so that they can be answered by both the ByzCoin proxy and the
+// SQLite indexer.
+const (
+	// projectsQuery selects the creations of projects, which are all
+	// accepted.
+	projectsQuery = `select
+	projects.instruction_id as id,
+	encode(projects.block_hash, 'hex') as block,
+	'spawn:project' as action,
+	projects.project_id as project_id,
+	projects.name as project_name,
+	projects.signers as signers
+from medchain.projects
+where %s
+order by projects.instruction_id`
+
+	// authorizationsQuery selects the grants and revocations of query terms,
+	// and the decisions of the custodians.
+	authorizationsQuery = `select
+	events.instruction_id as id,
+	encode(events.block_hash, 'hex') as block,
+	events.accepted as accepted,
+	events.action as action,
+	case when events.kind in ('grant', 'revoke') then events.instance_id
+		else queries.project_id end as project_id,
+	events.user_id as user_id,
+	queries.query_id as query_id,
+	coalesce(events.query_terms, events.dataset_id) as terms,
+	events.signers as signers
+from medchain.authorization_events as events
+left join medchain.queries on
+	queries.query_iid = events.instance_id
+	and queries.accepted
+where events.kind in ('grant', 'revoke', 'approve', 'deny')
+	and %s
+order by events.instruction_id`
+
+	// queriesQuery selects the submissions of queries.
+	queriesQuery = `select
+	queries.instruction_id as id,
+	encode(queries.block_hash, 'hex') as block,
+	queries.accepted as accepted,
+	'spawn:query' as action,
+	queries.project_id as project_id,
+	queries.user_id as user_id,
+	queries.query_id as query_id,
+	queries.query_iid as query_iid,
+	queries.query_definition as terms,
+	queries.signers as signers
+from medchain.queries
+where %s
+order by queries.instruction_id`
+
+	// updatesQuery selects the updates of the status of the queries, which
+	// have no view.
+	updatesQuery = `select
+	instruction.instruction_id as id,
+	encode(block.hash, 'hex') as block,
+	"transaction".accepted as accepted,
+	instruction.action as action,
+	queries.project_id as project_id,
+	queries.user_id as user_id,
+	queries.query_id as query_id,
+	encode(status.value, 'hex') as status
+from cothority.instruction
+join cothority."transaction" on
+	"transaction".transaction_id = instruction.transaction_id
+join cothority.block on
+	block.block_id = "transaction".block_id
+join medchain.queries on
+	queries.query_iid = encode(instruction.instance_iid, 'hex')
+	and queries.accepted
+left join cothority.argument as status on
+	status.instruction_id = instruction.instruction_id
+	and status.name = 'status'
+where instruction.action = 'invoke:query.update'
+	and %s
+order by instruction.instruction_id`
+
+	// signersQuery selects the signers of the updates.
+	signersQuery = `select
+	signer.instruction_id as id,
+	signer.identity as identity
+from cothority.signer
+join cothority.instruction on
+	instruction.instruction_id = signer.instruction_id
+where instruction.action = 'invoke:query.update'
+	and %s
+order by signer.signer_id`
+
+	// boundsQuery selects the first and last block IDs.
+	boundsQuery = `select
+	coalesce(min(block_id), 0) as min,
+	coalesce(max(block_id), -1) as max
+from cothority.block`
+
+	// blockQuery selects the first block from an ID.
+	blockQuery = `select
+	block_id as id,
+	encode(hash, 'hex') as hash
+from cothority.block
+where block_id >= %d
+order by block_id
+limit 1`
+)
+
+// actionKinds maps the instruction actions to the kinds of events.
+var actionKinds = map[string]string{
+	"spawn:" + contracts.ProjectContractID:                                        ProjectCreated,
+	"invoke:" + contracts.ProjectContractID + "." + contracts.ProjectAddAction:    TermsGranted,
+	"invoke:" + contracts.ProjectContractID + "." + contracts.ProjectRemoveAction: TermsRevoked,
+	"spawn:" + contracts.QueryContractID:                                          QuerySubmitted,
+	"invoke:" + contracts.QueryContractID + "." + contracts.QueryApproveAction:    QueryApproved,
+	"invoke:" + contracts.QueryContractID + "." + contracts.QueryDenyAction:       QueryDenied,
+	"invoke:" + contracts.QueryContractID + "." + contracts.QueryUpdateAction:     QueryUpdated,
+}
+
+// Generate reads the events matching the filter and returns their report.
+func (g *Generator) Generate(filter Filter) (*Report, error) {
+	if filter.ProjectID != "" {
+		_, err := hex.DecodeString(filter.ProjectID)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid project ID: %v", err)
+		}
+	}
+
+	blocks := make(map[string]blockInfo)
+
+	first, last, err := g.blockRange(filter, blocks)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to find blocks: %v", err)
+	}
+
+	rows, err := g.readRows(filter, first, last)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read events: %v", err)
+	}
+
+	report := &Report{
+		Generated: g.now(),
+		Filter:    filter,
+		Events:    make([]Event, 0, len(rows)),
+	}
+
+	for _, r := range rows {
+		block, err := g.getBlock(r.Block, blocks)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get block: %v", err)
+		}
+
+		event, err := g.newEvent(r)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to read event: %v", err)
+		}
+
+		event.Time = block.time
+		event.BlockIndex = block.index
+
+		report.Events = append(report.Events, event)
+	}
+
+	return report, nil
+}
+
+// readRows reads the events selected by the filter in the blocks from first
+// to last excluded, in the order they were added to the chain.
+func (g *Generator) readRows(filter Filter, first, last int) ([]*row, error) {
+	inBlocks := func(hash string) string {
+		return fmt.Sprintf(`%s in (select hash from cothority.block
+		where block_id >= %d and block_id < %d)`, hash, first, last)
+	}
+
+	queries := map[string][]string{
+		authorizationsQuery: {
+			inBlocks("events.block_hash"),
+			equals(`case when events.kind in ('grant', 'revoke') then events.instance_id
+		else queries.project_id end`, filter.ProjectID),
+			equals("events.user_id", filter.UserID),
+		},
+		queriesQuery: {
+			inBlocks("queries.block_hash"),
+			equals("queries.project_id", filter.ProjectID),
+			equals("queries.user_id", filter.UserID),
+		},
+	}
+
+	// the creation of a project has no user
+	if filter.UserID == "" {
+		queries[projectsQuery] = []string{
+			inBlocks("projects.block_hash"),
+			equals("projects.project_id", filter.ProjectID),
+		}
+	}
+
+	var rows []*row
+
+	for query, conditions := range queries {
+		var res []*row
+
+		err := g.query(fmt.Sprintf(query, where(conditions...)), &res)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to query events: %v", err)
+		}
+
+		rows = append(rows, res...)
+	}
+
+	updates, err := g.readUpdates(filter, first, last)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read updates: %v", err)
+	}
+
+	rows = append(rows, updates...)
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	return rows, nil
+}
+
+// readUpdates reads the updates of the queries selected by the filter, with
+// their signers.
+func (g *Generator) readUpdates(filter Filter, first, last int) ([]*row, error) {
+	condition := where(
+		fmt.Sprintf("block.block_id >= %d and block.block_id < %d", first, last),
+		equals("queries.project_id", filter.ProjectID),
+		equals("queries.user_id", filter.UserID),
+	)
+
+	var rows []*row
+
+	err := g.query(fmt.Sprintf(updatesQuery, condition), &rows)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query updates: %v", err)
+	}
+
+	if len(rows) == 0 {
+		return rows, nil
+	}
+
+	byID := make(map[int]*row, len(rows))
+	ids := make([]string, len(rows))
+
+	for i, r := range rows {
+		byID[r.ID] = r
+		ids[i] = strconv.Itoa(r.ID)
+	}
+
+	var signers []signer
+
+	err = g.query(fmt.Sprintf(signersQuery, "signer.instruction_id in ("+
+		strings.Join(ids, ", ")+")"), &signers)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to query signers: %v", err)
+	}
+
+	for _, s := range signers {
+		r := byID[s.ID]
+		if r != nil {
+			r.Signers = strings.TrimSpace(r.Signers + " " + s.Identity)
+		}
+	}
+
+	return rows, nil
+}
+
+// signer is a row of signersQuery.
+type signer struct {
+	ID       int    `json:"id"`
+	Identity string `json:"identity"`
+}
+
+// where joins the conditions that are not empty, or returns a condition that
+// always holds.
+func where(conditions ...string) string {
+	var res []string
+
+	for _, c := range conditions {
+		if c != "" {
+			res = append(res, c)
+		}
+	}
+
+	if len(res) == 0 {
+		return "1 = 1"
+	}
+
+	return strings.Join(res, "\n\tand ")
+}
+
+// equals returns the condition that the expression is equal to the value, or
+// an empty condition if the value is empty.
+func equals(expr, value string) string {
+	if value == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s = %s", expr, quote(value))
+}
+
+// quote returns the value as an SQL string.
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+func (g *Generator) query(query string, rows interface{}) error {
+	res, err := g.db.ProxyQuery(query)
+	if err != nil {
+		return xerrors.Errorf("failed to query: %v", err)
+	}
+
+	err = json.Unmarshal(res, rows)
+	if err != nil {
+		return xerrors.Errorf("failed to decode rows: %v", err)
+	}
+
+	return nil
+}
+
+type blockInfo struct {
+	index int
+	time  time.Time
+}
+
+// getBlock returns the index and the time of the block, which are cached in
+// the map.
+func (g *Generator) getBlock(hash string, blocks map[string]blockInfo) (blockInfo, error) {
+	block, found := blocks[hash]
+	if found {
+		return block, nil
+	}
+
+	id, err := hex.DecodeString(hash)
+	if err != nil {
+		return blockInfo{}, xerrors.Errorf("invalid block hash: %v", err)
+	}
+
+	index, t, err := g.chain.BlockTime(id)
+	if err != nil {
+		return blockInfo{}, xerrors.Errorf("failed to get block time: %v", err)
+	}
+
+	block = blockInfo{index: index, time: t}
+	blocks[hash] = block
+
+	return block, nil
+}
+
+// blockRange returns the IDs of the first block of the date range and of the
+// first block after it. As the blocks are stored in the order of the chain,
+// their times increase with their IDs, and the bounds are found by a binary
+// search that reads the time of a few blocks only.
+func (g *Generator) blockRange(filter Filter, blocks map[string]blockInfo) (int, int, error) {
+	var bounds []struct {
+		Min int `json:"min"`
+		Max int `json:"max"`
+	}
+
+	err := g.query(boundsQuery, &bounds)
+	if err != nil {
+		return 0, 0, xerrors.Errorf("failed to query bounds: %v", err)
+	}
+
+	if len(bounds) != 1 {
+		return 0, 0, xerrors.Errorf("unexpected bounds: %v", bounds)
+	}
+
+	first := bounds[0].Min
+	last := bounds[0].Max + 1
+
+	if !filter.From.IsZero() {
+		first, err = g.firstBlock(filter.From, first, last, blocks)
+		if err != nil {
+			return 0, 0, xerrors.Errorf("failed to find first block: %v", err)
+		}
+	}
+
+	if !filter.To.IsZero() {
+		last, err = g.firstBlock(filter.To, first, last, blocks)
+		if err != nil {
+			return 0, 0, xerrors.Errorf("failed to find last block: %v", err)
+		}
+	}
+
+	return first, last, nil
+}
+
+// firstBlock returns the ID from which the blocks between lo and hi excluded
+// are not older than t, or hi if they all are.
+func (g *Generator) firstBlock(t time.Time, lo, hi int,
+	blocks map[string]blockInfo) (int, error) {
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		var res []struct {
+			ID   int    `json:"id"`
+			Hash string `json:"hash"`
+		}
+
+		err := g.query(fmt.Sprintf(blockQuery, mid), &res)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to query block: %v", err)
+		}
+
+		if len(res) == 0 {
+			return 0, xerrors.Errorf("no block from %d", mid)
+		}
+
+		block, err := g.getBlock(res[0].Hash, blocks)
+		if err != nil {
+			return 0, xerrors.Errorf("failed to get block: %v", err)
+		}
+
+		if block.time.Before(t) {
+			lo = res[0].ID + 1
+		} else {
+			// the IDs between mid and the block are not used
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// newEvent returns the event of the row.
+func (g *Generator) newEvent(r *row) (Event, error) {
+	signers := []string{}
+	if r.Signers != "" {
+		signers = strings.Split(r.Signers, " ")
+	}
+
+	sort.Strings(signers)
+
+	event := Event{
+		Accepted:  r.Accepted,
+		Kind:      actionKinds[r.Action],
+		Action:    r.Action,
+		ProjectID: r.ProjectID,
+		UserID:    r.UserID,
+		QueryID:   r.QueryID,
+		Terms:     r.Terms,
+		Signers:   signers,
+	}
+
+	if event.Kind != ProjectCreated && !r.Accepted {
+		event.Reason = "transaction refused by the chain"
+		return event, nil
+	}
+
+	switch event.Kind {
+	case ProjectCreated:
+		// only the accepted creations are in the view
+		event.Accepted = true
+		event.ProjectName = r.ProjectName
+	case QuerySubmitted:
+		queryIID, err := hex.DecodeString(r.QueryIID)
+		if err != nil {
+			return Event{}, xerrors.Errorf("invalid query ID: %v", err)
+		}
+
+		// the status when the query was spawned, as it might have been
+		// updated since
+		query, err := g.chain.GetSpawnedQuery(byzcoin.NewInstanceID(queryIID))
+		if err != nil {
+			return Event{}, xerrors.Errorf("failed to get query: %v", err)
+		}
+
+		event.Status = query.Status
+		event.Reason = rejectionReason(query)
+	case QueryDenied:
+		event.Reason = fmt.Sprintf("denied by the custodian of dataset %s", r.Terms)
+	case QueryUpdated:
+		status, err := hex.DecodeString(r.Status)
+		if err != nil {
+			return Event{}, xerrors.Errorf("invalid status: %v", err)
+		}
+
+		event.Status = string(status)
+	}
+
+	return event, nil
+}
+
+// rejectionReason explains why a query is rejected when it is spawned, or
+// returns an empty string if it is not. The denials of the custodians come
+// later, with their own events.
+func rejectionReason(query *contracts.QueryContract) string {
+	if query.Status != contracts.QueryRejectedStatus {
+		return ""
+	}
+
+	if query.RejectionReason != "" {
+		return query.RejectionReason
+	}
+
+	// the queries spawned before the reason was stored
+	if len(query.Datasets) == 0 && len(query.ConsentRefusals) != 0 {
+		refusal := query.ConsentRefusals[0]
+		return fmt.Sprintf("consent rule %s of dataset %s refuses the query definition",
+			refusal.Category, refusal.DatasetID)
+	}
+
+	return "user not authorized for the query definition on the project or its datasets"
+}
@@ -0,0 +1,360 @@
+package report
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ldsec/medchain/contracts"
+	"github.com/ldsec/medchain/indexer"
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cothority/v3/byzcoin"
+	"go.dedis.ch/cothority/v3/darc"
+	"go.dedis.ch/cothority/v3/skipchain"
+	"go.dedis.ch/protobuf"
+	"golang.org/x/xerrors"
+)
+
+var (
+	darcID    = byzcoin.NewInstanceID([]byte("darc"))
+	datasetID = byzcoin.NewInstanceID([]byte("dataset"))
+	day1      = time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2      = day1.Add(24 * time.Hour)
+	day3      = day2.Add(24 * time.Hour)
+	admin     = darc.NewSignerEd25519(nil, nil).Identity()
+	custodian = darc.NewSignerEd25519(nil, nil).Identity()
+	alice     = darc.NewSignerEd25519(nil, nil).Identity()
+	bob       = darc.NewSignerEd25519(nil, nil).Identity()
+	// projectID is the instance ID derived by the spawn of the project.
+	projectID = spawnProject().DeriveID("")
+)
+
+func TestGenerator_Generate(t *testing.T) {
+	g := newTestGenerator(t)
+
+	report, err := g.Generate(Filter{})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 8)
+
+	created := report.Events[0]
+	require.Equal(t, ProjectCreated, created.Kind)
+	require.True(t, created.Accepted)
+	require.Equal(t, projectID.String(), created.ProjectID)
+	require.Equal(t, "name", created.ProjectName)
+	require.Equal(t, day1, created.Time)
+	require.Equal(t, 1, created.BlockIndex)
+
+	grant := report.Events[1]
+	require.Equal(t, TermsGranted, grant.Kind)
+	require.Equal(t, projectID.String(), grant.ProjectID)
+	require.Equal(t, "alice", grant.UserID)
+	require.Equal(t, "q1,q2", grant.Terms)
+	require.Equal(t, []string{admin.String()}, grant.Signers)
+
+	submitted := report.Events[2]
+	require.Equal(t, QuerySubmitted, submitted.Kind)
+	require.Equal(t, projectID.String(), submitted.ProjectID)
+	require.Equal(t, "alice", submitted.UserID)
+	require.Equal(t, "query1", submitted.QueryID)
+	require.Equal(t, "q1", submitted.Terms)
+	require.Equal(t, contracts.QueryAwaitingApprovalStatus, submitted.Status)
+	require.Empty(t, submitted.Reason)
+	require.Equal(t, day2, submitted.Time)
+	require.Equal(t, 2, submitted.BlockIndex)
+
+	// the status at the spawn, not the one of the update
+	require.Equal(t, contracts.QueryPendingStatus, report.Events[3].Status)
+
+	rejected := report.Events[4]
+	require.Equal(t, contracts.QueryRejectedStatus, rejected.Status)
+	require.Equal(t, "user alice has not attested version 1 of the data use agreement",
+		rejected.Reason)
+
+	refused := report.Events[5]
+	require.False(t, refused.Accepted)
+	require.Equal(t, "bob", refused.UserID)
+	require.Equal(t, "transaction refused by the chain", refused.Reason)
+
+	denied := report.Events[6]
+	require.Equal(t, QueryDenied, denied.Kind)
+	require.Equal(t, projectID.String(), denied.ProjectID)
+	require.Equal(t, "alice", denied.UserID)
+	require.Equal(t, "query1", denied.QueryID)
+	require.Equal(t, datasetID.String(), denied.Terms)
+	require.Equal(t, "denied by the custodian of dataset "+datasetID.String(), denied.Reason)
+	require.Equal(t, []string{custodian.String()}, denied.Signers)
+
+	updated := report.Events[7]
+	require.Equal(t, QueryUpdated, updated.Kind)
+	require.Equal(t, "query2", updated.QueryID)
+	require.Equal(t, contracts.QuerySuccessStatus, updated.Status)
+	require.Equal(t, []string{admin.String()}, updated.Signers)
+	require.Equal(t, day3, updated.Time)
+
+	require.Equal(t, Summary{Grants: 1, Submitted: 3, Rejected: 1, Refused: 1},
+		report.Summary())
+
+	// date range, the end is excluded
+	report, err = g.Generate(Filter{From: day1, To: day2})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 2)
+
+	report, err = g.Generate(Filter{From: day2})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 6)
+
+	report, err = g.Generate(Filter{From: day2.Add(time.Hour), To: day3})
+	require.NoError(t, err)
+	require.Empty(t, report.Events)
+
+	report, err = g.Generate(Filter{From: day3.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Empty(t, report.Events)
+
+	report, err = g.Generate(Filter{UserID: "bob"})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 1)
+
+	report, err = g.Generate(Filter{UserID: "alice", From: day3})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 2)
+
+	report, err = g.Generate(Filter{ProjectID: projectID.String()})
+	require.NoError(t, err)
+	require.Len(t, report.Events, 8)
+
+	report, err = g.Generate(Filter{ProjectID: "00"})
+	require.NoError(t, err)
+	require.Empty(t, report.Events)
+
+	// the values are quoted
+	report, err = g.Generate(Filter{UserID: "' or ''='"})
+	require.NoError(t, err)
+	require.Empty(t, report.Events)
+
+	_, err = g.Generate(Filter{ProjectID: "' or ''='"})
+	require.Error(t, err)
+}
+
+func TestRejectionReason(t *testing.T) {
+	query := &contracts.QueryContract{Status: contracts.QueryPendingStatus}
+	require.Empty(t, rejectionReason(query))
+
+	query.Status = contracts.QueryRejectedStatus
+	require.Equal(t, "user not authorized for the query definition on the project or its datasets",
+		rejectionReason(query))
+
+	query.ConsentRefusals = contracts.ConsentRefusals{{DatasetID: "ds", Category: "no-genetic-research"}}
+	require.Equal(t, "consent rule no-genetic-research of dataset ds refuses the query definition",
+		rejectionReason(query))
+
+	query.RejectionReason = "user alice has not attested version 2 of the data use agreement"
+	require.Equal(t, query.RejectionReason, rejectionReason(query))
+}
+
+func TestReport_Write(t *testing.T) {
+	g := newTestGenerator(t)
+
+	report, err := g.Generate(Filter{UserID: "alice"})
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, report.Write(buf, FormatCSV))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 7)
+	require.Equal(t, strings.Join(csvHeader, ","), lines[0])
+	require.Equal(t, "2021-03-01T12:00:00Z,1,true,termsGranted,invoke:project.add,"+
+		projectID.String()+",,alice,,\"q1,q2\",,,"+admin.String(), lines[1])
+
+	buf.Reset()
+	require.NoError(t, report.Write(buf, FormatJSON))
+
+	var decoded Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, report.Events, decoded.Events)
+
+	buf.Reset()
+	require.NoError(t, report.Write(buf, FormatHTML))
+	require.Contains(t, buf.String(), "<td>alice</td><td>query1</td>")
+	require.Contains(t, buf.String(), "denied by the custodian of dataset "+datasetID.String())
+
+	require.EqualError(t, report.Write(buf, "pdf"), "unknown format 'pdf'")
+}
+
+// -----------------------------------------------------------------------------
+// Utility functions
+
+// newTestGenerator returns a generator reading the events from an SQLite
+// indexer, which stores three blocks:
+//  1. the creation of the project and a grant to alice
+//  2. the submissions of query1, query2 and query4 by alice, and of query3 by
+//     bob in a refused transaction
+//  3. the denial of query1 by a custodian, and the update of query2
+func newTestGenerator(t *testing.T) *Generator {
+	db, err := indexer.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+
+	chain := fakeChain{
+		blocks: make(map[string]blockInfo),
+		queries: map[byzcoin.InstanceID]*contracts.QueryContract{
+			contracts.NewQueryInstanceID(projectID, "query1"): {
+				Status: contracts.QueryAwaitingApprovalStatus,
+			},
+			contracts.NewQueryInstanceID(projectID, "query2"): {
+				Status: contracts.QueryPendingStatus,
+			},
+			contracts.NewQueryInstanceID(projectID, "query4"): {
+				Status:          contracts.QueryRejectedStatus,
+				RejectionReason: "user alice has not attested version 1 of the data use agreement",
+			},
+		},
+	}
+
+	grant := invoke(projectID, contracts.ProjectContractID, contracts.ProjectAddAction, admin,
+		byzcoin.Argument{Name: contracts.ProjectUserIDKey, Value: []byte("alice")},
+		byzcoin.Argument{Name: contracts.ProjectQueryTermKey, Value: []byte("q1,q2")})
+
+	deny := invoke(contracts.NewQueryInstanceID(projectID, "query1"), contracts.QueryContractID,
+		contracts.QueryDenyAction, custodian,
+		byzcoin.Argument{Name: contracts.QueryDatasetIDKey, Value: datasetID.Slice()})
+
+	update := invoke(contracts.NewQueryInstanceID(projectID, "query2"), contracts.QueryContractID,
+		contracts.QueryUpdateAction, admin,
+		byzcoin.Argument{Name: contracts.QueryStatusKey, Value: []byte(contracts.QuerySuccessStatus)})
+
+	for i, block := range []struct {
+		time time.Time
+		txs  byzcoin.TxResults
+	}{{
+		time: day1,
+		txs:  byzcoin.TxResults{accepted(spawnProject()), accepted(grant)},
+	}, {
+		time: day2,
+		txs: byzcoin.TxResults{
+			accepted(spawnQuery("query1", alice)),
+			accepted(spawnQuery("query2", alice)),
+			accepted(spawnQuery("query4", alice)),
+			{ClientTransaction: byzcoin.ClientTransaction{
+				Instructions: byzcoin.Instructions{spawnQuery("query3", bob)},
+			}},
+		},
+	}, {
+		time: day3,
+		txs:  byzcoin.TxResults{accepted(deny), accepted(update)},
+	}} {
+		payload, err := protobuf.Encode(&byzcoin.DataBody{TxResults: block.txs})
+		require.NoError(t, err)
+
+		sb := skipchain.NewSkipBlock()
+		sb.Index = i + 1
+		sb.Payload = payload
+		sb.Hash = sb.CalculateHash()
+
+		_, err = db.StoreBlock(sb)
+		require.NoError(t, err)
+
+		chain.blocks[hex.EncodeToString(sb.Hash)] = blockInfo{index: sb.Index, time: block.time}
+	}
+
+	return NewGenerator(proxyDB{db}, chain)
+}
+
+func spawnProject() byzcoin.Instruction {
+	return signed(byzcoin.Instruction{
+		InstanceID: darcID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.ProjectContractID,
+			Args: byzcoin.Arguments{
+				{Name: contracts.ProjectNameKey, Value: []byte("name")},
+			},
+		},
+	}, admin)
+}
+
+func spawnQuery(queryID string, user darc.Identity) byzcoin.Instruction {
+	userID := "alice"
+	if user.Equal(&bob) {
+		userID = "bob"
+	}
+
+	return signed(byzcoin.Instruction{
+		InstanceID: projectID,
+		Spawn: &byzcoin.Spawn{
+			ContractID: contracts.QueryContractID,
+			Args: byzcoin.Arguments{
+				{Name: contracts.QueryUserIDKey, Value: []byte(userID)},
+				{Name: contracts.QueryQueryIDKey, Value: []byte(queryID)},
+				{Name: contracts.QueryQueryDefinitionKey, Value: []byte("q1")},
+			},
+		},
+	}, user)
+}
+
+func invoke(id byzcoin.InstanceID, contractID, command string, identity darc.Identity,
+	args ...byzcoin.Argument) byzcoin.Instruction {
+
+	return signed(byzcoin.Instruction{
+		InstanceID: id,
+		Invoke: &byzcoin.Invoke{
+			ContractID: contractID,
+			Command:    command,
+			Args:       args,
+		},
+	}, identity)
+}
+
+// signed sets the signer of the instruction, as stored by the indexer.
+func signed(inst byzcoin.Instruction, identity darc.Identity) byzcoin.Instruction {
+	inst.SignerIdentities = []darc.Identity{identity}
+	inst.SignerCounter = []uint64{1}
+	inst.Signatures = [][]byte{[]byte("signature")}
+
+	return inst
+}
+
+func accepted(inst byzcoin.Instruction) byzcoin.TxResult {
+	return byzcoin.TxResult{
+		ClientTransaction: byzcoin.ClientTransaction{
+			Instructions: byzcoin.Instructions{inst},
+		},
+		Accepted: true,
+	}
+}
+
+// proxyDB answers the queries with the indexer, as the proxy would.
+type proxyDB struct {
+	db *indexer.SQLite
+}
+
+func (p proxyDB) ProxyQuery(query string) ([]byte, error) {
+	return p.db.Query(query)
+}
+
+type fakeChain struct {
+	blocks  map[string]blockInfo
+	queries map[byzcoin.InstanceID]*contracts.QueryContract
+}
+
+func (c fakeChain) BlockTime(hash skipchain.SkipBlockID) (int, time.Time, error) {
+	block, found := c.blocks[hex.EncodeToString(hash)]
+	if !found {
+		return 0, time.Time{}, xerrors.New("block not found")
+	}
+
+	return block.index, block.time, nil
+}
+
+func (c fakeChain) GetSpawnedQuery(id byzcoin.InstanceID) (*contracts.QueryContract, error) {
+	query, found := c.queries[id]
+	if !found {
+		return nil, xerrors.New("query not found")
+	}
+
+	return query, nil
+}
@@ -0,0 +1,415 @@
+// Package secrets encrypts the files holding private keys, like the
+// private.toml of the conodes and the key files of the CLI, with a passphrase.
+//
+// The key is derived from the passphrase with scrypt, and the file is
+// encrypted with AES-GCM. The encrypted file is a JSON object holding the
+// parameters of the derivation, so that they can be increased later.
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/xerrors"
+)
+
+// The sources of the passphrase, tried in this order before prompting it.
+const (
+	PassphraseEnv     = "MEDCHAIN_PASSPHRASE"
+	PassphraseFileEnv = "MEDCHAIN_PASSPHRASE_FILE"
+)
+
+// version is the version of the format of the encrypted files.
+const version = 1
+
+// The parameters of scrypt for the new files, taking about 100ms.
+var (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// The bounds of the parameters of scrypt read from the files, so that a
+// corrupted or malicious file can't make the derivation allocate gigabytes of
+// memory or run for hours.
+const (
+	maxScryptN      = 1 << 20
+	maxScryptR      = 16
+	maxScryptP      = 16
+	maxScryptMemory = 1 << 30
+)
+
+const keyLength = 32
+
+// envelope is the content of an encrypted file.
+type envelope struct {
+	Version    int    `json:"medchain_encrypted"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// IsEncrypted returns true if the data is an encrypted file.
+func IsEncrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return false
+	}
+
+	var env envelope
+
+	err := json.Unmarshal(data, &env)
+
+	return err == nil && env.Version > 0
+}
+
+// Encrypt encrypts the data with the passphrase.
+func Encrypt(data, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, xerrors.New("empty passphrase")
+	}
+
+	env := envelope{
+		Version: version,
+		KDF:     "scrypt",
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Salt:    make([]byte, 16),
+	}
+
+	_, err := rand.Read(env.Salt)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate salt: %v", err)
+	}
+
+	aead, err := env.aead(passphrase)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create cipher: %v", err)
+	}
+
+	env.Nonce = make([]byte, aead.NonceSize())
+
+	_, err = rand.Read(env.Nonce)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to generate nonce: %v", err)
+	}
+
+	env.Ciphertext = aead.Seal(nil, env.Nonce, data, nil)
+
+	buf, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return nil, xerrors.Errorf("failed to encode: %v", err)
+	}
+
+	return append(buf, '\n'), nil
+}
+
+// Decrypt decrypts an encrypted file with the passphrase.
+func Decrypt(data, passphrase []byte) ([]byte, error) {
+	var env envelope
+
+	err := json.Unmarshal(data, &env)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to decode: %v", err)
+	}
+
+	if env.Version != version {
+		return nil, xerrors.Errorf("unknown version: %d", env.Version)
+	}
+
+	if env.KDF != "scrypt" {
+		return nil, xerrors.Errorf("unknown key derivation: %s", env.KDF)
+	}
+
+	err = env.checkParams()
+	if err != nil {
+		return nil, xerrors.Errorf("invalid scrypt parameters: %v", err)
+	}
+
+	aead, err := env.aead(passphrase)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create cipher: %v", err)
+	}
+
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, xerrors.Errorf("invalid nonce size: %d", len(env.Nonce))
+	}
+
+	plain, err := aead.Open(nil, env.Nonce, env.Ciphertext, nil)
+	if err != nil {
+		return nil, xerrors.New("wrong passphrase or corrupted file")
+	}
+
+	return plain, nil
+}
+
+// checkParams checks the parameters of scrypt against the bounds.
+func (env envelope) checkParams() error {
+	if env.N < 2 || env.N > maxScryptN || env.N&(env.N-1) != 0 {
+		return xerrors.Errorf("N must be a power of 2 up to %d: %d", maxScryptN, env.N)
+	}
+
+	if env.R < 1 || env.R > maxScryptR {
+		return xerrors.Errorf("r must be between 1 and %d: %d", maxScryptR, env.R)
+	}
+
+	if env.P < 1 || env.P > maxScryptP {
+		return xerrors.Errorf("p must be between 1 and %d: %d", maxScryptP, env.P)
+	}
+
+	// scrypt allocates 128*N*r bytes
+	if 128*env.N*env.R > maxScryptMemory {
+		return xerrors.Errorf("N=%d and r=%d need more than %d bytes", env.N, env.R,
+			maxScryptMemory)
+	}
+
+	return nil
+}
+
+func (env envelope) aead(passphrase []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, env.Salt, env.N, env.R, env.P, keyLength)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to derive key: %v", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to create block cipher: %v", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// ReadFile reads the file, and decrypts it with the passphrase if it is
+// encrypted.
+func ReadFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read file: %v", err)
+	}
+
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	passphrase := passphrases.get(path)
+	if passphrase == nil {
+		passphrase, err = Passphrase(fmt.Sprintf("Passphrase of %s: ", path))
+		if err != nil {
+			return nil, xerrors.Errorf("failed to get passphrase: %v", err)
+		}
+	}
+
+	plain, err := Decrypt(data, passphrase)
+	if err != nil {
+		// the file may have been encrypted again by another process
+		passphrases.set(path, nil)
+		return nil, xerrors.Errorf("failed to decrypt %s: %v", path, err)
+	}
+
+	passphrases.set(path, passphrase)
+
+	return plain, nil
+}
+
+// WriteFile writes the data to the file, encrypted with the passphrase if
+// encrypt is true. The data is written to a temporary file in the same
+// folder, which then replaces the file, so that the file is left untouched
+// if the encryption or the write fails.
+func WriteFile(path string, data []byte, perm os.FileMode, encrypt bool) error {
+	var passphrase []byte
+
+	if encrypt {
+		var err error
+
+		// a new passphrase is always asked, and confirmed, even if the file
+		// was decrypted before
+		passphrase, err = NewPassphrase(fmt.Sprintf("New passphrase of %s: ", path))
+		if err != nil {
+			return xerrors.Errorf("failed to get passphrase: %v", err)
+		}
+
+		data, err = Encrypt(data, passphrase)
+		if err != nil {
+			return xerrors.Errorf("failed to encrypt: %v", err)
+		}
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return xerrors.Errorf("failed to create temporary file: %v", err)
+	}
+
+	// nothing to remove once renamed
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return xerrors.Errorf("failed to write file: %v", err)
+	}
+
+	err = os.Chmod(tmp.Name(), perm)
+	if err != nil {
+		return xerrors.Errorf("failed to set permissions: %v", err)
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return xerrors.Errorf("failed to replace file: %v", err)
+	}
+
+	// the file is read with the passphrase it is now encrypted with, if any
+	passphrases.set(path, passphrase)
+
+	return nil
+}
+
+// passphraseCache holds the passphrases of the files read or written by the
+// process, so that the passphrase of a file is only asked once per process.
+type passphraseCache struct {
+	sync.Mutex
+	byPath map[string][]byte
+}
+
+var passphrases = passphraseCache{byPath: make(map[string][]byte)}
+
+func (c *passphraseCache) get(path string) []byte {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.byPath[cacheKey(path)]
+}
+
+// set caches the passphrase of the file, or forgets it if nil.
+func (c *passphraseCache) set(path string, passphrase []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	if passphrase == nil {
+		delete(c.byPath, cacheKey(path))
+	} else {
+		c.byPath[cacheKey(path)] = passphrase
+	}
+}
+
+// cacheKey returns the absolute path of the file, so that a file has a single
+// entry whatever the working directory.
+func cacheKey(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	return abs
+}
+
+// Passphrase returns the passphrase of the MEDCHAIN_PASSPHRASE variable, or
+// of the file given by MEDCHAIN_PASSPHRASE_FILE, or asks it on the terminal.
+func Passphrase(prompt string) ([]byte, error) {
+	return getPassphrase(prompt, false)
+}
+
+// NewPassphrase is Passphrase for a passphrase used to encrypt: when asked on
+// the terminal, it is asked twice so that a typo doesn't leave a file nobody
+// can decrypt.
+func NewPassphrase(prompt string) ([]byte, error) {
+	return getPassphrase(prompt, true)
+}
+
+func getPassphrase(prompt string, confirm bool) ([]byte, error) {
+	passphrase, err := readPassphrase(prompt, confirm)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, xerrors.New("empty passphrase")
+	}
+
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		return []byte(env), nil
+	}
+
+	if file := os.Getenv(PassphraseFileEnv); file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, xerrors.Errorf("failed to open passphrase file: %v", err)
+		}
+
+		defer f.Close()
+
+		// only the first line, without the new line of the editors
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && line == "" {
+			return nil, xerrors.Errorf("failed to read passphrase file: %v", err)
+		}
+
+		return []byte(strings.TrimRight(line, "\r\n")), nil
+	}
+
+	passphrase, err := promptPassphrase(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		again, err := promptPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(passphrase, again) {
+			return nil, xerrors.New("the passphrases don't match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, xerrors.Errorf("no terminal to ask the passphrase, set %s or %s",
+			PassphraseEnv, PassphraseFileEnv)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return nil, xerrors.Errorf("failed to read passphrase: %v", err)
+	}
+
+	return passphrase, nil
+}
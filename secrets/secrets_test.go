@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncrypt(t *testing.T) {
+	// fast derivation for the tests
+	scryptN = 1 << 10
+
+	data := []byte("Private = \"abc\"\n")
+
+	enc, err := Encrypt(data, []byte("pass"))
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(enc))
+	require.False(t, IsEncrypted(data))
+	require.NotContains(t, string(enc), "abc")
+
+	plain, err := Decrypt(enc, []byte("pass"))
+	require.NoError(t, err)
+	require.Equal(t, data, plain)
+
+	_, err = Decrypt(enc, []byte("wrong"))
+	require.EqualError(t, err, "wrong passphrase or corrupted file")
+
+	_, err = Encrypt(data, nil)
+	require.EqualError(t, err, "empty passphrase")
+}
+
+func TestReadWriteFile(t *testing.T) {
+	scryptN = 1 << 10
+
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	passFile := filepath.Join(dir, "passphrase")
+	require.NoError(t, ioutil.WriteFile(passFile, []byte("from file\n"), 0600))
+
+	os.Setenv(PassphraseFileEnv, passFile)
+	defer os.Unsetenv(PassphraseFileEnv)
+
+	path := filepath.Join(dir, "private.toml")
+	data := []byte("secret")
+
+	require.NoError(t, WriteFile(path, data, 0600, true))
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(raw))
+
+	plain, err := Decrypt(raw, []byte("from file"))
+	require.NoError(t, err)
+	require.Equal(t, data, plain)
+
+	plain, err = ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, plain)
+
+	// plain files are read as is
+	require.NoError(t, WriteFile(path, data, 0600, false))
+
+	plain, err = ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, plain)
+}
+
+// Each file is read with its own passphrase, and a new passphrase is asked to
+// encrypt even if the file was decrypted before.
+func TestReadWriteFile_Passphrases(t *testing.T) {
+	scryptN = 1 << 10
+
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer os.Unsetenv(PassphraseEnv)
+
+	first := filepath.Join(dir, "first.cfg")
+	second := filepath.Join(dir, "second.cfg")
+
+	os.Setenv(PassphraseEnv, "one")
+	require.NoError(t, WriteFile(first, []byte("first"), 0600, true))
+
+	plain, err := ReadFile(first)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), plain)
+
+	os.Setenv(PassphraseEnv, "two")
+	require.NoError(t, WriteFile(second, []byte("second"), 0600, true))
+
+	raw, err := ioutil.ReadFile(second)
+	require.NoError(t, err)
+
+	_, err = Decrypt(raw, []byte("two"))
+	require.NoError(t, err)
+
+	plain, err = ReadFile(second)
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), plain)
+
+	// the passphrase of the first file is still known
+	plain, err = ReadFile(first)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), plain)
+
+	// re-encrypting the first file uses the new passphrase
+	require.NoError(t, WriteFile(first, []byte("first"), 0600, true))
+
+	raw, err = ioutil.ReadFile(first)
+	require.NoError(t, err)
+
+	_, err = Decrypt(raw, []byte("two"))
+	require.NoError(t, err)
+
+	// a wrong passphrase is not kept
+	os.Setenv(PassphraseEnv, "three")
+	passphrases.set(first, nil)
+
+	_, err = ReadFile(first)
+	require.Error(t, err)
+
+	os.Setenv(PassphraseEnv, "two")
+
+	plain, err = ReadFile(first)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), plain)
+}
+
+func TestDecrypt_ScryptParams(t *testing.T) {
+	scryptN = 1 << 10
+
+	enc, err := Encrypt([]byte("secret"), []byte("pass"))
+	require.NoError(t, err)
+
+	var env envelope
+	require.NoError(t, json.Unmarshal(enc, &env))
+
+	for _, params := range [][3]int{{1 << 30, 8, 1}, {1000, 8, 1}, {1 << 10, 1 << 20, 1},
+		{1 << 10, 8, 1 << 20}, {1 << 20, 16, 1}, {0, 8, 1}} {
+
+		bad := env
+		bad.N, bad.R, bad.P = params[0], params[1], params[2]
+
+		buf, err := json.Marshal(bad)
+		require.NoError(t, err)
+
+		_, err = Decrypt(buf, []byte("pass"))
+		require.Error(t, err, params)
+		require.Contains(t, err.Error(), "invalid scrypt parameters", params)
+	}
+}
+
+// The key files are read-only, and are replaced when they are converted.
+func TestWriteFile_Replace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "key.cfg")
+	require.NoError(t, WriteFile(path, []byte("v1"), 0400, false))
+	require.NoError(t, WriteFile(path, []byte("v2"), 0400, false))
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2"), data)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0400), info.Mode().Perm())
+
+	// no temporary file is left behind
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}